@@ -1,15 +1,19 @@
 package main
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/kvark128/OnlineLibrary/internal/cache"
 	"github.com/kvark128/OnlineLibrary/internal/config"
 	"github.com/kvark128/OnlineLibrary/internal/gui"
 	"github.com/kvark128/OnlineLibrary/internal/lang"
 	"github.com/kvark128/OnlineLibrary/internal/log"
 	"github.com/kvark128/OnlineLibrary/internal/manager"
+	"github.com/kvark128/OnlineLibrary/internal/stats"
 	"github.com/kvark128/OnlineLibrary/internal/waveout"
 )
 
@@ -22,6 +26,7 @@ func main() {
 	logger := log.New(os.Stdout, log.Info, "\t")
 	configFile := filepath.Join(userDataDir, config.ConfigFile)
 	logFile := filepath.Join(userDataDir, config.LogFile)
+	statisticsFile := filepath.Join(userDataDir, config.StatisticsFile)
 
 	if fl, err := os.Create(logFile); err == nil {
 		logger.SetOutput(fl)
@@ -35,6 +40,20 @@ func main() {
 		logger.Error("Loading config file: %v", err)
 	}
 
+	statistics := stats.New()
+	logger.Info("Loading statistics file from %v", statisticsFile)
+	if err := statistics.Load(statisticsFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Error("Loading statistics file: %v", err)
+	}
+
+	cacheDir := filepath.Join(userDataDir, config.CacheDirName)
+	fragmentCache, err := cache.Open(cacheDir, conf.CacheLimit())
+	if err != nil {
+		logger.Error("Opening fragments cache: %v", err)
+	} else {
+		logger.Info("Fragments cache in %v uses %v bytes", cacheDir, fragmentCache.Size())
+	}
+
 	if level, err := log.StringToLevel(conf.General.LogLevel); err == nil {
 		logger.SetLevel(level)
 	}
@@ -61,13 +80,17 @@ func main() {
 	// Filling in the menu with the available providers
 	menuBar.SetProvidersMenu(conf.Services, "")
 
-	// Setting label for the pause timer in the menu
-	menuBar.SetPauseTimerLabel(int(conf.General.PauseTimer.Minutes()))
+	// Filling in the menus with the equalizer presets
+	menuBar.SetEqualizerMenu(conf.General.Equalizer)
+	menuBar.SetBookEqualizerMenu("")
+
+	menuBar.SetNormalizationChecked(conf.General.Normalization)
+	menuBar.SetSmartRewindChecked(conf.General.SmartRewind)
 
 	// Filling in the menu with the supported log levels
 	menuBar.SetLogLevelMenu(logger.SupportedLevels(), logger.Level())
 
-	mng := manager.NewManager(wnd, logger)
+	mng := manager.NewManager(wnd, logger, statistics, fragmentCache)
 	done := make(chan bool)
 	go mng.Start(conf, done)
 	wnd.Run()
@@ -85,5 +108,15 @@ func main() {
 	if err := conf.Save(configFile); err != nil {
 		logger.Error("Saving config file: %v", err)
 	}
+	logger.Info("Saving statistics file to %v", statisticsFile)
+	if err := statistics.Save(statisticsFile); err != nil {
+		logger.Error("Saving statistics file: %v", err)
+	}
+	if fragmentCache != nil {
+		logger.Info("Saving fragments cache index to %v", cacheDir)
+		if err := fragmentCache.Save(); err != nil {
+			logger.Error("Saving fragments cache index: %v", err)
+		}
+	}
 	logger.Info("Exiting")
 }
@@ -0,0 +1,272 @@
+//go:build windows
+
+// AAC decoding by the decoder transform of Media Foundation
+
+#define COBJMACROS
+#include <windows.h>
+#include <mfapi.h>
+#include <mferror.h>
+#include <mftransform.h>
+#include <stdlib.h>
+#include <string.h>
+#include "aac.h"
+
+// The size of the HEAACWAVEINFO fields following WAVEFORMATEX
+#define HEAAC_INFO_SIZE 12
+
+struct aac_decoder {
+	IMFTransform *transform;
+	IMFSample *output;
+	DWORD output_size;
+	int sample_rate;
+	int channels;
+};
+
+static HRESULT startup(void) {
+	static LONG started;
+	HRESULT hr = CoInitializeEx(NULL, COINIT_MULTITHREADED);
+	if (FAILED(hr) && hr != RPC_E_CHANGED_MODE) {
+		return hr;
+	}
+	if (InterlockedCompareExchange(&started, 1, 0) == 0) {
+		return MFStartup(MF_VERSION, MFSTARTUP_LITE);
+	}
+	return S_OK;
+}
+
+static HRESULT create_transform(IMFTransform **transform) {
+	MFT_REGISTER_TYPE_INFO input = {MFMediaType_Audio, MFAudioFormat_AAC};
+	IMFActivate **activates = NULL;
+	UINT32 count = 0;
+	HRESULT hr = MFTEnumEx(MFT_CATEGORY_AUDIO_DECODER, MFT_ENUM_FLAG_SYNCMFT | MFT_ENUM_FLAG_SORTANDFILTER, &input, NULL, &activates, &count);
+	if (FAILED(hr)) {
+		return hr;
+	}
+	hr = MF_E_TOPO_CODEC_NOT_FOUND;
+	for (UINT32 i = 0; i < count; i++) {
+		if (FAILED(hr)) {
+			hr = IMFActivate_ActivateObject(activates[i], &IID_IMFTransform, (void **)transform);
+		}
+		IMFActivate_Release(activates[i]);
+	}
+	CoTaskMemFree(activates);
+	return hr;
+}
+
+static HRESULT set_input_type(IMFTransform *transform, const unsigned char *config, int config_size, int sample_rate, int channels) {
+	IMFMediaType *type = NULL;
+	HRESULT hr = MFCreateMediaType(&type);
+	if (FAILED(hr)) {
+		return hr;
+	}
+
+	// The user data is the HEAACWAVEINFO structure without WAVEFORMATEX, followed by the AudioSpecificConfig
+	UINT8 user_data[HEAAC_INFO_SIZE + 64] = {0};
+	if (config_size > (int)sizeof(user_data) - HEAAC_INFO_SIZE) {
+		config_size = sizeof(user_data) - HEAAC_INFO_SIZE;
+	}
+	user_data[2] = 0xFE; // wAudioProfileLevelIndication is unknown
+	memcpy(user_data + HEAAC_INFO_SIZE, config, config_size);
+
+	IMFMediaType_SetGUID(type, &MF_MT_MAJOR_TYPE, &MFMediaType_Audio);
+	IMFMediaType_SetGUID(type, &MF_MT_SUBTYPE, &MFAudioFormat_AAC);
+	IMFMediaType_SetUINT32(type, &MF_MT_AUDIO_SAMPLES_PER_SECOND, sample_rate);
+	IMFMediaType_SetUINT32(type, &MF_MT_AUDIO_NUM_CHANNELS, channels);
+	IMFMediaType_SetUINT32(type, &MF_MT_AUDIO_BITS_PER_SAMPLE, 16);
+	IMFMediaType_SetUINT32(type, &MF_MT_AAC_PAYLOAD_TYPE, 0); // Raw access units without headers
+	IMFMediaType_SetBlob(type, &MF_MT_USER_DATA, user_data, HEAAC_INFO_SIZE + config_size);
+	hr = IMFTransform_SetInputType(transform, 0, type, 0);
+	IMFMediaType_Release(type);
+	return hr;
+}
+
+static HRESULT set_output_type(aac_decoder *dec) {
+	IMFMediaType *type = NULL;
+	HRESULT hr;
+	for (DWORD i = 0; SUCCEEDED(hr = IMFTransform_GetOutputAvailableType(dec->transform, 0, i, &type)); i++) {
+		GUID subtype;
+		UINT32 bits = 0, rate = 0, channels = 0;
+		IMFMediaType_GetGUID(type, &MF_MT_SUBTYPE, &subtype);
+		IMFMediaType_GetUINT32(type, &MF_MT_AUDIO_BITS_PER_SAMPLE, &bits);
+		IMFMediaType_GetUINT32(type, &MF_MT_AUDIO_SAMPLES_PER_SECOND, &rate);
+		IMFMediaType_GetUINT32(type, &MF_MT_AUDIO_NUM_CHANNELS, &channels);
+		if (IsEqualGUID(&subtype, &MFAudioFormat_PCM) && bits == 16) {
+			hr = IMFTransform_SetOutputType(dec->transform, 0, type, 0);
+			IMFMediaType_Release(type);
+			if (SUCCEEDED(hr)) {
+				dec->sample_rate = rate;
+				dec->channels = channels;
+			}
+			break;
+		}
+		IMFMediaType_Release(type);
+	}
+	if (FAILED(hr)) {
+		return hr;
+	}
+
+	MFT_OUTPUT_STREAM_INFO info;
+	hr = IMFTransform_GetOutputStreamInfo(dec->transform, 0, &info);
+	if (FAILED(hr)) {
+		return hr;
+	}
+	if (dec->output != NULL) {
+		IMFSample_Release(dec->output);
+		dec->output = NULL;
+	}
+	if (info.dwFlags & (MFT_OUTPUT_STREAM_PROVIDES_SAMPLES | MFT_OUTPUT_STREAM_CAN_PROVIDE_SAMPLES)) {
+		return S_OK;
+	}
+
+	// The decoder needs a buffer for the output. HE-AAC frames contain 2048 samples
+	dec->output_size = info.cbSize;
+	if (dec->output_size < (DWORD)(2048 * 2 * dec->channels)) {
+		dec->output_size = 2048 * 2 * dec->channels;
+	}
+	IMFMediaBuffer *buffer = NULL;
+	hr = MFCreateSample(&dec->output);
+	if (SUCCEEDED(hr)) {
+		hr = MFCreateMemoryBuffer(dec->output_size, &buffer);
+	}
+	if (SUCCEEDED(hr)) {
+		hr = IMFSample_AddBuffer(dec->output, buffer);
+		IMFMediaBuffer_Release(buffer);
+	}
+	return hr;
+}
+
+aac_decoder *aac_create(const unsigned char *config, int config_size, int sample_rate, int channels, long *result) {
+	aac_decoder *dec = calloc(1, sizeof(aac_decoder));
+	if (dec == NULL) {
+		*result = E_OUTOFMEMORY;
+		return NULL;
+	}
+	HRESULT hr = startup();
+	if (SUCCEEDED(hr)) {
+		hr = create_transform(&dec->transform);
+	}
+	if (SUCCEEDED(hr)) {
+		hr = set_input_type(dec->transform, config, config_size, sample_rate, channels);
+	}
+	if (SUCCEEDED(hr)) {
+		hr = set_output_type(dec);
+	}
+	if (SUCCEEDED(hr)) {
+		hr = IMFTransform_ProcessMessage(dec->transform, MFT_MESSAGE_NOTIFY_BEGIN_STREAMING, 0);
+	}
+	*result = hr;
+	if (FAILED(hr)) {
+		aac_destroy(dec);
+		return NULL;
+	}
+	return dec;
+}
+
+int aac_sample_rate(aac_decoder *dec) {
+	return dec->sample_rate;
+}
+
+int aac_channels(aac_decoder *dec) {
+	return dec->channels;
+}
+
+static HRESULT copy_sample(IMFSample *sample, unsigned char *out, int out_size, int *out_len) {
+	IMFMediaBuffer *buffer = NULL;
+	HRESULT hr = IMFSample_ConvertToContiguousBuffer(sample, &buffer);
+	if (FAILED(hr)) {
+		return hr;
+	}
+	BYTE *data = NULL;
+	DWORD length = 0;
+	hr = IMFMediaBuffer_Lock(buffer, &data, NULL, &length);
+	if (SUCCEEDED(hr)) {
+		if ((int)length > out_size - *out_len) {
+			length = out_size - *out_len;
+		}
+		memcpy(out + *out_len, data, length);
+		*out_len += length;
+		IMFMediaBuffer_Unlock(buffer);
+		IMFMediaBuffer_SetCurrentLength(buffer, 0);
+	}
+	IMFMediaBuffer_Release(buffer);
+	return hr;
+}
+
+long aac_decode(aac_decoder *dec, const unsigned char *frame, int frame_size, unsigned char *out, int out_size, int *out_len) {
+	*out_len = 0;
+	IMFSample *input = NULL;
+	IMFMediaBuffer *buffer = NULL;
+	HRESULT hr = MFCreateSample(&input);
+	if (SUCCEEDED(hr)) {
+		hr = MFCreateMemoryBuffer(frame_size, &buffer);
+	}
+	if (SUCCEEDED(hr)) {
+		BYTE *data = NULL;
+		hr = IMFMediaBuffer_Lock(buffer, &data, NULL, NULL);
+		if (SUCCEEDED(hr)) {
+			memcpy(data, frame, frame_size);
+			IMFMediaBuffer_Unlock(buffer);
+			IMFMediaBuffer_SetCurrentLength(buffer, frame_size);
+			hr = IMFSample_AddBuffer(input, buffer);
+		}
+	}
+	if (SUCCEEDED(hr)) {
+		hr = IMFTransform_ProcessInput(dec->transform, 0, input, 0);
+	}
+	if (buffer != NULL) {
+		IMFMediaBuffer_Release(buffer);
+	}
+	if (input != NULL) {
+		IMFSample_Release(input);
+	}
+	if (FAILED(hr)) {
+		return hr;
+	}
+
+	// One access unit can produce several output samples
+	for (;;) {
+		MFT_OUTPUT_DATA_BUFFER output = {0};
+		DWORD status = 0;
+		output.pSample = dec->output;
+		hr = IMFTransform_ProcessOutput(dec->transform, 0, 1, &output, &status);
+		if (output.pEvents != NULL) {
+			IMFCollection_Release(output.pEvents);
+		}
+		if (hr == MF_E_TRANSFORM_NEED_MORE_INPUT) {
+			return S_OK;
+		}
+		if (hr == MF_E_TRANSFORM_STREAM_CHANGE) {
+			hr = set_output_type(dec);
+			if (FAILED(hr)) {
+				return hr;
+			}
+			continue;
+		}
+		if (FAILED(hr)) {
+			return hr;
+		}
+		if (output.pSample != NULL) {
+			hr = copy_sample(output.pSample, out, out_size, out_len);
+			if (output.pSample != dec->output) {
+				IMFSample_Release(output.pSample);
+			}
+			if (FAILED(hr)) {
+				return hr;
+			}
+		}
+	}
+}
+
+void aac_flush(aac_decoder *dec) {
+	IMFTransform_ProcessMessage(dec->transform, MFT_MESSAGE_COMMAND_FLUSH, 0);
+}
+
+void aac_destroy(aac_decoder *dec) {
+	if (dec->output != NULL) {
+		IMFSample_Release(dec->output);
+	}
+	if (dec->transform != NULL) {
+		IMFTransform_Release(dec->transform);
+	}
+	free(dec);
+}
@@ -0,0 +1,85 @@
+//go:build windows
+
+// Package aac decodes raw AAC access units by the decoder built into Windows (Media Foundation)
+package aac
+
+//#cgo LDFLAGS: -lmfplat -lmfuuid -lole32
+//#include <stdlib.h>
+//#include "aac.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+const (
+	// The maximum number of samples per channel in one access unit (HE-AAC)
+	maxFrameSamples = 2048
+	// The output format can change during decoding, so the buffer is allocated for the 7.1 layout
+	maxChannels = 8
+)
+
+type Decoder struct {
+	dec *C.aac_decoder
+	pcm []byte
+}
+
+// NewDecoder creates a decoder of the AAC stream described by the AudioSpecificConfig
+func NewDecoder(config []byte, sampleRate, channels int) (*Decoder, error) {
+	if len(config) == 0 {
+		return nil, errors.New("empty aac config")
+	}
+	cConfig := C.CBytes(config)
+	defer C.free(cConfig)
+
+	var result C.long
+	dec := C.aac_create((*C.uchar)(cConfig), C.int(len(config)), C.int(sampleRate), C.int(channels), &result)
+	if dec == nil {
+		return nil, fmt.Errorf("creating aac decoder: HRESULT 0x%08X", uint32(result))
+	}
+
+	d := &Decoder{dec: dec}
+	d.pcm = make([]byte, maxFrameSamples*maxChannels*C.sizeof_short)
+	runtime.SetFinalizer(d, func(d *Decoder) { d.Close() })
+	return d, nil
+}
+
+// SampleRate returns the sample rate of the decoded audio data. For HE-AAC it is twice the rate of the core stream
+func (d *Decoder) SampleRate() int {
+	return int(C.aac_sample_rate(d.dec))
+}
+
+func (d *Decoder) Channels() int {
+	return int(C.aac_channels(d.dec))
+}
+
+// Decode decodes one access unit and returns 16-bit PCM data. The data is valid until the next call
+func (d *Decoder) Decode(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, nil
+	}
+	var length C.int
+	result := C.aac_decode(d.dec,
+		(*C.uchar)(unsafe.Pointer(&frame[0])), C.int(len(frame)),
+		(*C.uchar)(unsafe.Pointer(&d.pcm[0])), C.int(len(d.pcm)), &length,
+	)
+	if result < 0 {
+		return nil, fmt.Errorf("decoding aac frame: HRESULT 0x%08X", uint32(result))
+	}
+	return d.pcm[:length], nil
+}
+
+// Flush discards the state of the decoder. It must be called before decoding from another position of the stream
+func (d *Decoder) Flush() {
+	C.aac_flush(d.dec)
+}
+
+func (d *Decoder) Close() {
+	if d.dec != nil {
+		C.aac_destroy(d.dec)
+		d.dec = nil
+	}
+}
@@ -0,0 +1,22 @@
+#ifndef AAC_H
+#define AAC_H
+
+typedef struct aac_decoder aac_decoder;
+
+// Creates a decoder of the raw AAC stream described by the AudioSpecificConfig.
+// Returns NULL and sets the HRESULT of the failure if the decoder cannot be created
+aac_decoder *aac_create(const unsigned char *config, int config_size, int sample_rate, int channels, long *result);
+
+// Returns the parameters of the decoded PCM data
+int aac_sample_rate(aac_decoder *dec);
+int aac_channels(aac_decoder *dec);
+
+// Decodes one access unit. Up to out_size bytes of 16-bit PCM data are written to out, the number of bytes is stored in out_len
+long aac_decode(aac_decoder *dec, const unsigned char *frame, int frame_size, unsigned char *out, int out_size, int *out_len);
+
+// Discards the state of the decoder before decoding from a new position
+void aac_flush(aac_decoder *dec);
+
+void aac_destroy(aac_decoder *dec);
+
+#endif
@@ -0,0 +1,32 @@
+//go:build !windows
+
+package aac
+
+import "errors"
+
+var (
+	Unsupported = errors.New("aac decoding is supported only on Windows")
+)
+
+type Decoder struct{}
+
+// NewDecoder always fails, since the decoder of Media Foundation is not available
+func NewDecoder(config []byte, sampleRate, channels int) (*Decoder, error) {
+	return nil, Unsupported
+}
+
+func (d *Decoder) SampleRate() int {
+	return 0
+}
+
+func (d *Decoder) Channels() int {
+	return 0
+}
+
+func (d *Decoder) Decode(frame []byte) ([]byte, error) {
+	return nil, Unsupported
+}
+
+func (d *Decoder) Flush() {}
+
+func (d *Decoder) Close() {}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/kvark128/OnlineLibrary/internal/config"
 	"github.com/kvark128/OnlineLibrary/internal/content"
-	"github.com/kvark128/OnlineLibrary/internal/gui"
 	"github.com/kvark128/OnlineLibrary/internal/log"
 	"github.com/kvark128/OnlineLibrary/internal/player"
 )
@@ -18,15 +17,22 @@ type Book struct {
 	conf  *config.Book
 }
 
-func NewBook(outputDevice string, contentItem content.Item, logger *log.Logger, statusBar *gui.StatusBar) (*Book, error) {
+// NewBook creates a book from the content item and restores its settings.
+// The listening position is rewound by the rules according to the time since the book was last saved
+func NewBook(outputDevice string, newSink player.SinkFactory, contentItem content.Item, rewindRules []player.RewindRule, logger *log.Logger) (*Book, error) {
 	name, err := contentItem.Name()
 	if err != nil {
 		return nil, err
 	}
 
-	dir, err := config.BookDir(name)
-	if err != nil {
-		return nil, err
+	var dir string
+	if locator, ok := contentItem.(content.Locator); ok {
+		dir = locator.Dir()
+	} else {
+		dir, err = config.BookDir(name)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	rsrc, err := contentItem.Resources()
@@ -36,15 +42,26 @@ func NewBook(outputDevice string, contentItem content.Item, logger *log.Logger,
 
 	book := &Book{
 		Item:   contentItem,
-		Player: player.NewPlayer(dir, rsrc, outputDevice, logger, statusBar),
+		Player: player.NewPlayer(dir, rsrc, outputDevice, newSink, logger),
 		Title:  name,
 		conf:   contentItem.Config(),
 	}
 
 	book.SetSpeed(book.conf.Speed)
+	if book.conf.Pitch != 0 {
+		// Books saved by older versions have no pitch value
+		book.SetPitch(book.conf.Pitch)
+	}
+	book.SetSkipSilence(book.conf.SkipSilence)
+	book.SetDurations(book.conf.Durations)
+	book.SetLoudness(book.conf.Loudness)
+	book.SetRewindRules(rewindRules)
 	if bookmark, err := book.Bookmark(config.ListeningPosition); err == nil {
 		book.SetFragment(bookmark.Fragment)
 		book.SetPosition(bookmark.Position)
+		if !book.conf.Saved.IsZero() {
+			book.Rewind(book.RewindAfter(time.Since(book.conf.Saved)))
+		}
 	}
 	return book, nil
 }
@@ -67,6 +84,11 @@ func (book *Book) SetBookmarkWithID(id string) {
 	book.setBookmark(id, "")
 }
 
+// SetTimerBookmark saves the current position to the bookmark of the pause timer, replacing the previous one
+func (book *Book) SetTimerBookmark(name string) {
+	book.setBookmark(config.TimerPosition, name)
+}
+
 func (book *Book) setBookmark(id, name string) {
 	var bookmark config.Bookmark
 	bookmark.Name = name
@@ -111,8 +133,82 @@ func (book *Book) Bookmarks() map[string]string {
 	return bookmarks
 }
 
+// SaveLoop saves the loop being played with the specified name
+func (book *Book) SaveLoop(name string) error {
+	if name == "" {
+		return fmt.Errorf("loop name is missing")
+	}
+	loop, ok := book.Loop()
+	if !ok {
+		return fmt.Errorf("no loop is being played")
+	}
+	if book.conf.Loops == nil {
+		book.conf.Loops = make(map[string]config.Loop)
+	}
+	for id := 1; id <= 255; id++ {
+		loopID := fmt.Sprintf("loop%d", id)
+		if _, ok := book.conf.Loops[loopID]; !ok {
+			book.conf.Loops[loopID] = config.Loop{
+				Name:  name,
+				Start: config.Bookmark{Fragment: loop.StartFragment, Position: loop.Start},
+				End:   config.Bookmark{Fragment: loop.EndFragment, Position: loop.End},
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("all loop ids already used")
+}
+
+func (book *Book) SavedLoop(id string) (config.Loop, error) {
+	if loop, ok := book.conf.Loops[id]; ok {
+		return loop, nil
+	}
+	return config.Loop{}, fmt.Errorf("loop not found")
+}
+
+// PlayLoop starts the saved loop with the specified id
+func (book *Book) PlayLoop(id string) error {
+	loop, err := book.SavedLoop(id)
+	if err != nil {
+		return err
+	}
+	return book.SetLoop(player.Loop{
+		StartFragment: loop.Start.Fragment,
+		Start:         loop.Start.Position,
+		EndFragment:   loop.End.Fragment,
+		End:           loop.End.Position,
+	})
+}
+
+func (book *Book) RemoveLoop(id string) {
+	delete(book.conf.Loops, id)
+}
+
+// Loops returns the names of the saved loops by their ids
+func (book *Book) Loops() map[string]string {
+	loops := make(map[string]string)
+	for id, loop := range book.conf.Loops {
+		loops[id] = loop.Name
+	}
+	return loops
+}
+
+// EqualizerPreset returns the name of the equalizer preset of the book, or an empty string if the global preset is used
+func (book *Book) EqualizerPreset() string {
+	return book.conf.Equalizer
+}
+
+func (book *Book) SetEqualizerPreset(name string) {
+	book.conf.Equalizer = name
+}
+
 func (book *Book) Save() {
 	book.SetBookmarkWithID(config.ListeningPosition)
+	book.conf.Saved = time.Now()
 	book.conf.Speed = book.Speed()
+	book.conf.Pitch = book.Pitch()
+	book.conf.SkipSilence = book.SkipSilence()
+	book.conf.Durations = book.Durations()
+	book.conf.Loudness = book.Loudness()
 	book.SaveConfig()
 }
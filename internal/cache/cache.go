@@ -0,0 +1,197 @@
+// Package cache keeps the fragments of books that were streamed from the network.
+// A fragment is written to the per-book cache directory while it is being played, and only the complete fragment of the expected size
+// is moved to the book directory, where the player finds it next time instead of fetching it again
+package cache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+const indexFile = "index.yaml"
+
+var (
+	SizeMismatch = errors.New("cached fragment size mismatch")
+)
+
+// Entry is a fragment that has been moved by the cache to the book directory
+type Entry struct {
+	Path string    `yaml:"path"`
+	Size int64     `yaml:"size"`
+	Used time.Time `yaml:"used"`
+}
+
+// Cache is the store of streamed fragments. It is safe for concurrent use
+type Cache struct {
+	mu    sync.Mutex
+	dir   string
+	limit int64
+	// Fragments in the book directories, which are removed when the limit is exceeded
+	Entries []Entry `yaml:"entries,omitempty"`
+	// Fragments that are being written at the moment
+	writing map[string]bool
+}
+
+// Open opens the cache in the directory. The total size of the cached fragments does not exceed the limit in bytes.
+// With a zero limit nothing is cached
+func Open(dir string, limit int64) (*Cache, error) {
+	c := &Cache{dir: dir, limit: limit, writing: make(map[string]bool)}
+	// Partially written fragments from the previous session are useless
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			os.RemoveAll(filepath.Join(dir, e.Name()))
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(c); err != nil && err != io.EOF {
+		return nil, err
+	}
+	c.evict()
+	return c, nil
+}
+
+// Save writes the list of cached fragments to the cache directory
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := util.CreateSecureFile(filepath.Join(c.dir, indexFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yaml.NewEncoder(f).Encode(c); err != nil {
+		f.Corrupted()
+		return err
+	}
+	return nil
+}
+
+// SetLimit changes the maximum total size of the cached fragments in bytes
+func (c *Cache) SetLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+	c.evict()
+}
+
+// Size returns the total size of the cached fragments in bytes
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size()
+}
+
+func (c *Cache) size() int64 {
+	var size int64
+	for _, e := range c.Entries {
+		size += e.Size
+	}
+	return size
+}
+
+// Used marks the fragment at the path as recently played, so it is removed later than the others
+func (c *Cache) Used(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.Entries {
+		if c.Entries[i].Path == path {
+			c.Entries[i].Used = time.Now()
+			return
+		}
+	}
+}
+
+// Forget stops managing the fragments in the directory, so they are never removed by the cache.
+// It is used when the book has been downloaded by the user
+func (c *Cache) Forget(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	entries := c.Entries[:0]
+	for _, e := range c.Entries {
+		if !strings.HasPrefix(e.Path, prefix) {
+			entries = append(entries, e)
+		}
+	}
+	c.Entries = entries
+}
+
+// Tee returns the reader of src that writes the data read to the cache. If the fragment has been read completely and has the expected size,
+// it is moved to the path dst on closing. The book name sets the cache directory in which the fragment is written
+func (c *Cache) Tee(src io.ReadSeekCloser, book, name, dst string, size int64) io.ReadSeekCloser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.limit <= 0 || size > c.limit || c.writing[dst] {
+		return src
+	}
+	path := filepath.Join(c.dir, util.ReplaceForbiddenCharacters(book), name)
+	f, err := util.CreateSecureFile(path)
+	if err != nil {
+		return src
+	}
+	c.writing[dst] = true
+	return &reader{ReadSeekCloser: src, cache: c, f: f, path: path, dst: dst, size: size}
+}
+
+// add moves the complete fragment to the book directory and removes the old fragments if the limit is exceeded
+func (c *Cache) add(path, dst string, size int64) error {
+	if !util.FileIsExist(path, size) {
+		os.Remove(path)
+		return SizeMismatch
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModeDir); err != nil {
+		return err
+	}
+	if err := os.Rename(path, dst); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries = append(c.Entries, Entry{Path: dst, Size: size, Used: time.Now()})
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used fragments until the total size fits the limit
+func (c *Cache) evict() {
+	size := c.size()
+	if size <= c.limit {
+		return
+	}
+	sort.SliceStable(c.Entries, func(i, j int) bool { return c.Entries[i].Used.Before(c.Entries[j].Used) })
+	for len(c.Entries) > 0 && size > c.limit {
+		e := c.Entries[0]
+		c.Entries = c.Entries[1:]
+		size -= e.Size
+		// The file could be replaced by the user. Only the fragment written by the cache is removed
+		if util.FileIsExist(e.Path, e.Size) {
+			os.Remove(e.Path)
+		}
+	}
+}
+
+func (c *Cache) done(dst string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.writing, dst)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"io"
+
+	"github.com/kvark128/OnlineLibrary/internal/util"
+)
+
+// The decoder can stop reading before the end of the fragment, for example at the tags.
+// Such a short tail is read on closing to complete the fragment
+const maxTail = 1024 * 64
+
+// reader writes the data read from the source to the cache file. Only the contiguous data from the beginning of the source is written.
+// After a seek forward the writing continues when the reading reaches the written part again
+type reader struct {
+	io.ReadSeekCloser
+	cache   *Cache
+	f       *util.SecureFile
+	path    string
+	dst     string
+	size    int64
+	pos     int64
+	written int64
+	failed  bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	if !r.failed && r.pos <= r.written && r.pos+int64(n) > r.written {
+		if _, e := r.f.Write(p[r.written-r.pos : n]); e != nil {
+			r.failed = true
+		} else {
+			r.written = r.pos + int64(n)
+		}
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeekCloser.Seek(offset, whence)
+	if err != nil {
+		// The position of the source is unknown, so the data can no longer be written in order
+		r.failed = true
+		return pos, err
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+func (r *reader) Close() error {
+	defer r.cache.done(r.dst)
+	if !r.failed && r.written < r.size && r.size-r.written <= maxTail {
+		if _, err := r.ReadSeekCloser.Seek(r.written, io.SeekStart); err == nil {
+			n, _ := io.CopyN(r.f, r.ReadSeekCloser, r.size-r.written)
+			r.written += n
+		}
+	}
+	err := r.ReadSeekCloser.Close()
+	if r.failed || r.written != r.size {
+		r.f.Corrupted()
+		r.f.Close()
+		return err
+	}
+	if e := r.f.Close(); e != nil {
+		return err
+	}
+	if e := r.cache.add(r.path, r.dst, r.size); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
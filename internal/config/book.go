@@ -10,6 +10,8 @@ import (
 var (
 	BookNotFound      = errors.New("book not found")
 	ListeningPosition = "listening_position"
+	// Position at which the pause timer stopped playback
+	TimerPosition = "timer_position"
 )
 
 type Bookmark struct {
@@ -21,13 +23,34 @@ type Bookmark struct {
 	Position time.Duration `yaml:"position"`
 }
 
+// Loop is a named passage of the book between two positions that is played repeatedly
+type Loop struct {
+	Name  string   `yaml:"name"`
+	Start Bookmark `yaml:"start"`
+	End   Bookmark `yaml:"end"`
+}
+
 type Book struct {
 	// Unique ID of the book
 	ID string `yaml:"id"`
 	// Values for speed when playing the book
 	Speed float64 `yaml:"speed,omitempty"`
+	// Value for pitch when playing the book
+	Pitch float64 `yaml:"pitch,omitempty"`
+	// Long pauses are shortened when playing the book
+	SkipSilence bool `yaml:"skip_silence,omitempty"`
+	// Name of the equalizer preset for the book. If empty, the global preset is used
+	Equalizer string `yaml:"equalizer,omitempty"`
 	// Set of bookmarks in the book
 	Bookmarks map[string]Bookmark `yaml:"bookmarks,omitempty"`
+	// Saved loops of the book
+	Loops map[string]Loop `yaml:"loops,omitempty"`
+	// Measured durations of the book resources, by their local URI
+	Durations map[string]time.Duration `yaml:"durations,omitempty"`
+	// Measured loudness of the book resources in LUFS, by their local URI
+	Loudness map[string]float64 `yaml:"loudness,omitempty"`
+	// Time at which the listening position was last saved
+	Saved time.Time `yaml:"saved,omitempty"`
 }
 
 type BookSet []Book
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/kvark128/OnlineLibrary/internal/config"
 	"github.com/kvark128/OnlineLibrary/internal/log"
 )
 
@@ -17,28 +16,45 @@ var (
 )
 
 type Connection struct {
-	url           string
-	ctx           context.Context
-	resp          *http.Response
-	lastErr       error
-	logger        *log.Logger
+	url       string
+	ctx       context.Context
+	transport *Transport
+	resp      *http.Response
+	// Cancels the request of the current response
+	cancel  context.CancelFunc
+	lastErr error
+	logger  *log.Logger
+	// Cancels the current response if reading of its body stalls. Created on the first read of the body
 	timer         *time.Timer
 	reads         int64
 	contentLength int64
+	// Limiters of the reading rate. All of them are applied
+	limiters []*Limiter
 }
 
-func NewConnection(url string, logger *log.Logger) (*Connection, error) {
-	return NewConnectionWithContext(context.TODO(), url, logger)
+func NewConnection(url string, transport *Transport, logger *log.Logger) (*Connection, error) {
+	return NewConnectionWithContext(context.TODO(), url, transport, logger)
 }
 
-func NewConnectionWithContext(ctx context.Context, url string, logger *log.Logger) (*Connection, error) {
+func NewConnectionWithContext(ctx context.Context, url string, transport *Transport, logger *log.Logger) (*Connection, error) {
+	return NewConnectionFrom(ctx, url, 0, transport, logger)
+}
+
+// NewConnectionFrom creates a connection that starts reading the resource at the specified offset.
+// It is used to resume a partially downloaded resource. If the transport is nil, the default transport is used
+func NewConnectionFrom(ctx context.Context, url string, offset int64, transport *Transport, logger *log.Logger) (*Connection, error) {
+	if transport == nil {
+		transport = DefaultTransport()
+	}
 	c := &Connection{
-		url:    url,
-		ctx:    ctx,
-		logger: logger,
+		url:       url,
+		ctx:       ctx,
+		transport: transport,
+		logger:    logger,
+		reads:     offset,
 	}
 
-	contentLength, err := c.createResponse(0)
+	contentLength, err := c.createResponse(offset)
 	if err != nil {
 		return nil, err
 	}
@@ -47,51 +63,76 @@ func NewConnectionWithContext(ctx context.Context, url string, logger *log.Logge
 		return nil, fmt.Errorf("content length <= 0")
 	}
 
-	c.contentLength = contentLength
+	c.contentLength = offset + contentLength
 	return c, nil
 }
 
 func (c *Connection) createResponse(startPos int64) (int64, error) {
+	// The transport limits the time of connecting and of waiting for the response in each attempt of the request
 	ctx, cancelFunc := context.WithCancel(c.ctx)
-	c.timer = time.AfterFunc(config.HTTPTimeout, cancelFunc)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
 	if err != nil {
+		cancelFunc()
 		return 0, err
 	}
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startPos))
 
-	var resp *http.Response
-	for attempt := 0; attempt < 3; attempt++ {
-		resp, err = http.DefaultClient.Do(req)
-		if err == nil {
-			break
-		}
-	}
-	c.timer.Stop()
-
+	resp, err := c.transport.Client().Do(req)
 	if err != nil {
+		cancelFunc()
 		return 0, err
 	}
 
 	if resp.StatusCode != http.StatusPartialContent {
 		resp.Body.Close()
+		cancelFunc()
 		return 0, fmt.Errorf("unexpected http status code: %v", resp.StatusCode)
 	}
 
-	if c.resp != nil {
-		c.resp.Body.Close()
-	}
-
+	c.closeResponse()
 	c.resp = resp
+	c.cancel = cancelFunc
 	return c.resp.ContentLength, nil
 }
 
+// closeResponse closes the body of the current response and cancels its request
+func (c *Connection) closeResponse() error {
+	if c.timer != nil {
+		// The timer cancels the request of this response, so the next response needs a new one
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.resp == nil {
+		return nil
+	}
+	err := c.resp.Body.Close()
+	c.cancel()
+	c.resp, c.cancel = nil, nil
+	return err
+}
+
+// SetLimiters restricts the rate of reading from the connection by the limiters
+func (c *Connection) SetLimiters(limiters ...*Limiter) {
+	c.limiters = limiters
+}
+
 func (c *Connection) Read(p []byte) (int, error) {
 	if c.resp == nil {
 		return 0, ConnectionWasClosed
 	}
 
-	c.timer.Reset(config.HTTPTimeout)
+	// A read must not take more tokens than one second of the slowest limiter, so the rate remains smooth
+	for _, l := range c.limiters {
+		if rate := l.Rate(); rate > 0 && int64(len(p)) > rate {
+			p = p[:rate]
+		}
+	}
+
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.transport.Timeout(), c.cancel)
+	} else {
+		c.timer.Reset(c.transport.Timeout())
+	}
 	n, err := c.resp.Body.Read(p)
 	c.timer.Stop()
 	c.reads += int64(n)
@@ -102,6 +143,12 @@ func (c *Connection) Read(p []byte) (int, error) {
 			err = nil
 		}
 	}
+
+	for _, l := range c.limiters {
+		if e := l.Wait(c.ctx, n); e != nil && err == nil {
+			err = e
+		}
+	}
 	return n, err
 }
 
@@ -141,7 +188,5 @@ func (c *Connection) Close() error {
 	if c.resp == nil {
 		return ConnectionWasClosed
 	}
-	err := c.resp.Body.Close()
-	c.resp = nil
-	return err
+	return c.closeResponse()
 }
@@ -0,0 +1,67 @@
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter restricts the rate of reading by the token bucket algorithm. The bucket holds the tokens for one second of reading.
+// One limiter can be shared by several connections, which then get the rate together. It is safe for concurrent use
+type Limiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter of the rate in bytes per second. Zero rate means no limit
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+// SetRate changes the rate in bytes per second. Zero rate means no limit
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.tokens = float64(rate)
+	l.last = time.Now()
+}
+
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait takes n tokens from the bucket, waiting until the missing tokens are added. The tokens are taken in advance,
+// so the waits of several readers are queued one after another
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > float64(l.rate) {
+		l.tokens = float64(l.rate)
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/config"
+)
+
+const (
+	// Number of retries of a failed request and the delay before the first retry, if they are not set in the config
+	defaultRetries    = 2
+	defaultRetryDelay = time.Millisecond * 500
+	// The delay doubles with every next retry up to the maximum
+	maxRetryDelay = time.Second * 30
+)
+
+// Transport sends the HTTP requests to a service. It is shared by the SOAP client of the service and by the connections for its media,
+// so they go through the same proxy and trust the same certificates. It is safe for concurrent use
+type Transport struct {
+	base       *http.Transport
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	userAgent  string
+}
+
+// NewTransport creates a transport by the configuration. Zero values of the configuration mean the defaults
+func NewTransport(conf config.Transport) (*Transport, error) {
+	t := &Transport{
+		timeout:    conf.Timeout,
+		retries:    conf.Retries,
+		retryDelay: conf.RetryDelay,
+		userAgent:  conf.UserAgent,
+	}
+	if t.timeout <= 0 {
+		t.timeout = config.HTTPTimeout
+	}
+	switch {
+	case t.retries == 0:
+		t.retries = defaultRetries
+	case t.retries < 0:
+		t.retries = 0
+	}
+	if t.retryDelay <= 0 {
+		t.retryDelay = defaultRetryDelay
+	}
+	if t.userAgent == "" {
+		t.userAgent = fmt.Sprintf("%v/%v", config.ProgramName, config.ProgramVersion)
+	}
+
+	dialTimeout := conf.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = t.timeout
+	}
+	t.base = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: dialTimeout, KeepAlive: time.Second * 30}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Second * 90,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: t.timeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: conf.Insecure},
+	}
+
+	if conf.Proxy != "" {
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("proxy: unsupported scheme %q", proxy.Scheme)
+		}
+		t.base.Proxy = http.ProxyURL(proxy)
+	}
+
+	if conf.CABundle != "" {
+		pool, err := certPool(conf.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+		t.base.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
+
+// certPool returns the system certificates together with the certificates from the PEM file.
+// The relative path is resolved against the user data directory
+func certPool(path string) (*x509.CertPool, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.UserData(), path)
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %v", path)
+	}
+	return pool, nil
+}
+
+// Timeout returns the time of waiting for the response and for the data of its body
+func (t *Transport) Timeout() time.Duration {
+	return t.timeout
+}
+
+// RoundTrip sends the request. Only the idempotent requests for media (GET and HEAD) that failed because of the network are retried
+// with increasing delays. Responses of the server, including its errors, are returned as they are, since the SOAP faults of the service
+// come with the status 500, and the operations of the service, such as issuing a book, must not be repeated
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The request of the caller must not be modified
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	retries := t.retries
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || (req.Body != nil && req.Body != http.NoBody) {
+		retries = 0
+	}
+
+	delay := t.retryDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err == nil || attempt >= retries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// Client returns a client that sends the requests through the transport
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// serviceTransport is the transport of a service together with the configuration it was created from
+type serviceTransport struct {
+	conf      config.Transport
+	transport *Transport
+}
+
+var (
+	transportsMu sync.Mutex
+	// Transports of the services by their IDs
+	transports       = make(map[string]serviceTransport)
+	defaultTransport *Transport
+)
+
+// DefaultTransport returns the transport with the default configuration. It is used for the resources that do not belong to any service
+func DefaultTransport() *Transport {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if defaultTransport == nil {
+		// The empty configuration cannot be invalid
+		defaultTransport, _ = NewTransport(config.Transport{})
+	}
+	return defaultTransport
+}
+
+// ServiceTransport returns the transport of the service. The transport is shared by all requests to the service while its configuration stays the same.
+// If the configuration has changed, a new transport is created. If the configuration is invalid, the error is returned together with the default transport
+func ServiceTransport(service *config.Service) (*Transport, error) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if st, ok := transports[service.ID]; ok && st.conf == service.Transport {
+		return st.transport, nil
+	}
+
+	t, err := NewTransport(service.Transport)
+	if err != nil {
+		if defaultTransport == nil {
+			defaultTransport, _ = NewTransport(config.Transport{})
+		}
+		return defaultTransport, err
+	}
+	if st, ok := transports[service.ID]; ok {
+		// Connections of the old configuration are not needed anymore. The requests in flight finish as they are
+		st.transport.base.CloseIdleConnections()
+	}
+	transports[service.ID] = serviceTransport{conf: service.Transport, transport: t}
+	return t, nil
+}
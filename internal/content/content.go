@@ -21,6 +21,12 @@ type Item interface {
 	SaveConfig()
 }
 
+// Locator is implemented by items whose resources are not stored in the book directory derived from the item name
+type Locator interface {
+	// Dir returns the directory relative to which the local URIs of the resources are specified
+	Dir() string
+}
+
 type Issuer interface {
 	Issue() error
 }
@@ -0,0 +1,44 @@
+package content
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+
+	"github.com/kvark128/OnlineLibrary/internal/config"
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"github.com/kvark128/dodp"
+)
+
+// Manifest is the list of resources of a downloaded book in the order of the library.
+// It is saved next to the metadata, so the book can be played and downloaded again without the library
+type Manifest struct {
+	XMLName   xml.Name        `xml:"manifest"`
+	ServiceID string          `xml:"serviceID,attr"`
+	ContentID string          `xml:"contentID,attr"`
+	Resources []dodp.Resource `xml:"resource"`
+}
+
+// Manifester is implemented by local items that have the manifest of the library book
+type Manifester interface {
+	Manifest() (*Manifest, error)
+}
+
+// ReadManifest reads the manifest from the book directory
+func ReadManifest(dir string) (*Manifest, error) {
+	f, err := os.Open(filepath.Join(dir, config.ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mf := new(Manifest)
+	if err := xml.NewDecoder(f).Decode(mf); err != nil {
+		return nil, err
+	}
+	return mf, nil
+}
+
+// Save writes the manifest to the book directory
+func (mf *Manifest) Save(dir string) error {
+	return util.SaveXMLFile(filepath.Join(dir, config.ManifestFileName), mf)
+}
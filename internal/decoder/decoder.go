@@ -0,0 +1,170 @@
+package decoder
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported audio format")
+)
+
+// Decoder decodes an audio stream to 16-bit signed little-endian PCM data with interleaved channels
+type Decoder interface {
+	// Read reads the decoded audio data
+	Read(p []byte) (int, error)
+	// Seek sets the position in the decoded audio data in bytes
+	Seek(offset int64, whence int) (int64, error)
+	SampleRate() int
+	Channels() int
+	// Duration returns the duration of the stream. Some decoders have to read the source to find it out
+	Duration() (time.Duration, error)
+}
+
+// Index is a seek table of the stream built by the decoder
+type Index interface {
+	Duration() time.Duration
+}
+
+// Indexer is implemented by decoders that build a seek table of the source.
+// The table can be passed to a new decoder of the same source, so it does not need to be built again
+type Indexer interface {
+	// Index returns the seek table, or nil if it has not been built yet
+	Index() Index
+	SetIndex(index Index)
+}
+
+// Bitrater is implemented by decoders that know the bitrate of the encoded stream
+type Bitrater interface {
+	// Bitrate returns the bitrate in kbps
+	Bitrate() int
+}
+
+// Skipper is implemented by decoders that skip the damaged parts of the stream instead of returning an error
+type Skipper interface {
+	// Skipped returns the number of bytes of the encoded data that could not be decoded
+	Skipped() int64
+}
+
+// Chapter is a named part of the stream
+type Chapter struct {
+	Title string
+	Start time.Duration
+}
+
+// Chapterer is implemented by decoders of containers with embedded chapters
+type Chapterer interface {
+	Chapters() []Chapter
+}
+
+// Source is the encoded data of a resource, positioned at its beginning
+type Source struct {
+	io.ReadSeeker
+	// Size of the encoded data in bytes
+	Size int64
+	// Local sources can be read completely to build exact seek tables. For network sources only the headers should be read
+	Local bool
+}
+
+// Format describes a supported audio format
+type Format struct {
+	Name       string
+	Extensions []string
+	MimeTypes  []string
+	// Book reports that a single file of the format can be a complete book divided into chapters
+	Book bool
+	// Open creates a decoder of the source. The parameters of the audio data must be known when it returns
+	Open func(src Source) (Decoder, error)
+}
+
+var formats []*Format
+
+func init() {
+	Register(LKF)
+	Register(MP3)
+	Register(WAV)
+	Register(FLAC)
+	Register(MP4)
+	Register(OGG)
+}
+
+// Register adds the format to the list of supported formats
+func Register(format *Format) {
+	formats = append(formats, format)
+}
+
+// Lookup returns the format of the file with the specified name and mime type.
+// Some services specify an incorrect mime type, so the extension of the file is checked first
+func Lookup(name, mimeType string) (*Format, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	mimeType = strings.ToLower(mimeType)
+	for _, f := range formats {
+		for _, t := range f.MimeTypes {
+			if t == mimeType {
+				return f, nil
+			}
+		}
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// Supported reports whether the file with the specified name and mime type can be decoded
+func Supported(name, mimeType string) bool {
+	_, err := Lookup(name, mimeType)
+	return err == nil
+}
+
+// MimeTypes returns the mime types of all supported formats
+func MimeTypes() []string {
+	var types []string
+	for _, f := range formats {
+		types = append(types, f.MimeTypes...)
+	}
+	return types
+}
+
+// Open creates a decoder for the encoded data of the file with the specified name and mime type
+func Open(name, mimeType string, src Source) (Decoder, error) {
+	format, err := Lookup(name, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return format.Open(src)
+}
+
+// samplesDuration converts the number of samples per channel to the duration
+func samplesDuration(samples int64, sampleRate int) time.Duration {
+	if sampleRate == 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(sampleRate)
+}
+
+// seekPosition returns the absolute position for Seek, aligned to the beginning of the sample
+func seekPosition(offset int64, whence int, current, end int64, sampleSize int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = current + offset
+	case io.SeekEnd:
+		pos = end + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	return pos - pos%int64(sampleSize), nil
+}
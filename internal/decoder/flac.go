@@ -0,0 +1,840 @@
+package decoder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+var FLAC = &Format{
+	Name:       "FLAC",
+	Extensions: []string{".flac"},
+	MimeTypes:  []string{"audio/flac", "audio/x-flac"},
+	Open:       openFLAC,
+}
+
+var (
+	ErrInvalidFLAC = errors.New("invalid flac")
+)
+
+// Seeking by bisection stops when the searched range is smaller than this
+const flacBisectionLimit = 1024 * 64
+
+// The maximum number of bytes to search for the frame header
+const flacMaxSyncSearch = 1024 * 256
+
+type flacStreamInfo struct {
+	minBlockSize  int
+	maxBlockSize  int
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	totalSamples  int64
+}
+
+type flacSeekPoint struct {
+	sample int64
+	offset int64
+}
+
+type flacFrameHeader struct {
+	blockSize     int
+	sampleRate    int
+	channels      int
+	assignment    int
+	bitsPerSample int
+	firstSample   int64
+}
+
+// flacDecoder decodes the FLAC stream with any number of bits per sample to 16-bit samples
+type flacDecoder struct {
+	src  io.ReadSeeker
+	br   *bitReader
+	size int64
+	info flacStreamInfo
+	// Offset of the first frame in the source
+	dataStart int64
+	seekTable []flacSeekPoint
+	// Decoded samples of the current frame for each channel
+	samples [][]int32
+	pcm     []byte
+	// Converted data of the current frame that has not been read yet
+	pcmData []byte
+	// Position of the decoded audio data returned by Read
+	pcmPos int64
+	// After seeking, the position is unknown until the next frame header is read.
+	// Audio data before seekTarget must be discarded
+	seeking    bool
+	seekTarget int64
+	lastError  error
+}
+
+func openFLAC(src Source) (Decoder, error) {
+	d := &flacDecoder{
+		src:  src.ReadSeeker,
+		br:   newBitReader(src.ReadSeeker),
+		size: src.Size,
+	}
+	if err := d.readMetadata(); err != nil {
+		return nil, err
+	}
+	if d.info.sampleRate == 0 || d.info.channels == 0 {
+		return nil, ErrInvalidFLAC
+	}
+	d.samples = make([][]int32, d.info.channels)
+	return d, nil
+}
+
+// readMetadata reads the metadata blocks before the first frame
+func (d *flacDecoder) readMetadata() error {
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(d.br, head[:4]); err != nil {
+		return err
+	}
+	if string(head[:3]) == "ID3" {
+		// Some taggers put the ID3v2 tag before the stream
+		if _, err := io.ReadFull(d.br, head[4:]); err != nil {
+			return err
+		}
+		size := int64(head[6]&0x7f)<<21 | int64(head[7]&0x7f)<<14 | int64(head[8]&0x7f)<<7 | int64(head[9]&0x7f)
+		if _, err := io.CopyN(io.Discard, d.br, size); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(d.br, head[:4]); err != nil {
+			return err
+		}
+	}
+	if string(head[:4]) != "fLaC" {
+		return ErrInvalidFLAC
+	}
+
+	for last := false; !last; {
+		var blockHeader [4]byte
+		if _, err := io.ReadFull(d.br, blockHeader[:]); err != nil {
+			return err
+		}
+		last = blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7f
+		length := int64(blockHeader[1])<<16 | int64(blockHeader[2])<<8 | int64(blockHeader[3])
+
+		switch blockType {
+		case 0: // STREAMINFO
+			if length < 34 {
+				return ErrInvalidFLAC
+			}
+			b := make([]byte, length)
+			if _, err := io.ReadFull(d.br, b); err != nil {
+				return err
+			}
+			d.info.minBlockSize = int(binary.BigEndian.Uint16(b[0:]))
+			d.info.maxBlockSize = int(binary.BigEndian.Uint16(b[2:]))
+			v := binary.BigEndian.Uint64(b[10:])
+			d.info.sampleRate = int(v >> 44)
+			d.info.channels = int(v>>41&0x7) + 1
+			d.info.bitsPerSample = int(v>>36&0x1f) + 1
+			d.info.totalSamples = int64(v & 0xfffffffff)
+		case 3: // SEEKTABLE
+			b := make([]byte, length)
+			if _, err := io.ReadFull(d.br, b); err != nil {
+				return err
+			}
+			for i := 0; i+18 <= len(b); i += 18 {
+				sample := binary.BigEndian.Uint64(b[i:])
+				if sample == 0xffffffffffffffff {
+					// Placeholder point
+					continue
+				}
+				d.seekTable = append(d.seekTable, flacSeekPoint{sample: int64(sample), offset: int64(binary.BigEndian.Uint64(b[i+8:]))})
+			}
+			sort.Slice(d.seekTable, func(i, j int) bool { return d.seekTable[i].sample < d.seekTable[j].sample })
+		default:
+			if _, err := io.CopyN(io.Discard, d.br, length); err != nil {
+				return err
+			}
+		}
+	}
+	d.dataStart = d.br.pos
+	return nil
+}
+
+func (d *flacDecoder) Read(p []byte) (int, error) {
+	for len(d.pcmData) == 0 {
+		if d.lastError != nil {
+			return 0, d.lastError
+		}
+		if err := d.decodeFrame(); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			d.lastError = err
+			return 0, err
+		}
+	}
+	n := copy(p, d.pcmData)
+	d.pcmData = d.pcmData[n:]
+	d.pcmPos += int64(n)
+	return n, nil
+}
+
+// decodeFrame decodes the next frame and converts it to 16-bit samples
+func (d *flacDecoder) decodeFrame() error {
+	h, err := d.readFrameHeader()
+	if err != nil {
+		return err
+	}
+	if h.channels != d.info.channels {
+		return fmt.Errorf("flac: number of channels changed from %v to %v", d.info.channels, h.channels)
+	}
+
+	for ch := 0; ch < h.channels; ch++ {
+		bps := h.bitsPerSample
+		// The side channel has one extra bit
+		switch {
+		case h.assignment == 8 && ch == 1, h.assignment == 9 && ch == 0, h.assignment == 10 && ch == 1:
+			bps++
+		}
+		if cap(d.samples[ch]) < h.blockSize {
+			d.samples[ch] = make([]int32, h.blockSize)
+		}
+		d.samples[ch] = d.samples[ch][:h.blockSize]
+		if err := d.readSubframe(d.samples[ch], bps); err != nil {
+			return err
+		}
+	}
+	// Skipping the padding and CRC-16 of the frame
+	d.br.align()
+	if _, err := d.br.readBits(16); err != nil {
+		return err
+	}
+
+	d.decorrelate(h)
+	d.convert(h)
+
+	if d.seeking {
+		d.seeking = false
+		sampleSize := int64(h.channels * 2)
+		d.pcmPos = h.firstSample * sampleSize
+		if skip := d.seekTarget - d.pcmPos; skip > 0 {
+			// Audio data before the seek position must be dropped
+			if skip > int64(len(d.pcmData)) {
+				skip = int64(len(d.pcmData))
+				// The target is in one of the next frames
+				d.seeking = true
+			}
+			d.pcmData = d.pcmData[skip:]
+			d.pcmPos += skip
+		}
+	}
+	return nil
+}
+
+// readFrameHeader reads the frame header at the current position of the source
+func (d *flacDecoder) readFrameHeader() (flacFrameHeader, error) {
+	var h flacFrameHeader
+	raw := make([]byte, 0, 16)
+	readByte := func() (byte, error) {
+		b, err := d.br.ReadByte()
+		raw = append(raw, b)
+		return b, err
+	}
+
+	b0, err := readByte()
+	if err != nil {
+		return h, err
+	}
+	b1, err := readByte()
+	if err != nil {
+		return h, err
+	}
+	if b0 != 0xff || b1&0xfe != 0xf8 {
+		return h, errors.New("flac: frame sync lost")
+	}
+	variable := b1&1 != 0
+	b2, err := readByte()
+	if err != nil {
+		return h, err
+	}
+	b3, err := readByte()
+	if err != nil {
+		return h, err
+	}
+
+	// Frame number or sample number encoded like UTF-8
+	first, err := readByte()
+	if err != nil {
+		return h, err
+	}
+	number := uint64(first)
+	extra := 0
+	switch {
+	case first&0x80 == 0:
+	case first&0xe0 == 0xc0:
+		number, extra = uint64(first&0x1f), 1
+	case first&0xf0 == 0xe0:
+		number, extra = uint64(first&0x0f), 2
+	case first&0xf8 == 0xf0:
+		number, extra = uint64(first&0x07), 3
+	case first&0xfc == 0xf8:
+		number, extra = uint64(first&0x03), 4
+	case first&0xfe == 0xfc:
+		number, extra = uint64(first&0x01), 5
+	case first == 0xfe:
+		number, extra = 0, 6
+	default:
+		return h, ErrInvalidFLAC
+	}
+	for i := 0; i < extra; i++ {
+		b, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		if b&0xc0 != 0x80 {
+			return h, ErrInvalidFLAC
+		}
+		number = number<<6 | uint64(b&0x3f)
+	}
+
+	switch code := b2 >> 4; {
+	case code == 1:
+		h.blockSize = 192
+	case code >= 2 && code <= 5:
+		h.blockSize = 576 << (code - 2)
+	case code == 6:
+		b, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(b) + 1
+	case code == 7:
+		hi, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		lo, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		h.blockSize = int(hi)<<8 | int(lo) + 1
+	case code >= 8:
+		h.blockSize = 256 << (code - 8)
+	default:
+		return h, ErrInvalidFLAC
+	}
+
+	switch code := b2 & 0x0f; code {
+	case 0:
+		h.sampleRate = d.info.sampleRate
+	case 12:
+		b, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = int(b) * 1000
+	case 13, 14:
+		hi, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		lo, err := readByte()
+		if err != nil {
+			return h, err
+		}
+		h.sampleRate = int(hi)<<8 | int(lo)
+		if code == 14 {
+			h.sampleRate *= 10
+		}
+	case 15:
+		return h, ErrInvalidFLAC
+	default:
+		h.sampleRate = []int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}[code]
+	}
+
+	h.assignment = int(b3 >> 4)
+	switch {
+	case h.assignment < 8:
+		h.channels = h.assignment + 1
+	case h.assignment <= 10:
+		h.channels = 2
+	default:
+		return h, ErrInvalidFLAC
+	}
+
+	switch code := (b3 >> 1) & 0x07; code {
+	case 0:
+		h.bitsPerSample = d.info.bitsPerSample
+	case 3:
+		return h, ErrInvalidFLAC
+	default:
+		h.bitsPerSample = []int{0, 8, 12, 0, 16, 20, 24, 32}[code]
+	}
+
+	crc, err := d.br.ReadByte()
+	if err != nil {
+		return h, err
+	}
+	if crc8(raw) != crc {
+		return h, errors.New("flac: frame header CRC mismatch")
+	}
+
+	if variable {
+		h.firstSample = int64(number)
+	} else {
+		h.firstSample = int64(number) * int64(d.info.maxBlockSize)
+	}
+	return h, nil
+}
+
+// readSubframe decodes one channel of the frame to dst
+func (d *flacDecoder) readSubframe(dst []int32, bps int) error {
+	header, err := d.br.readBits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return ErrInvalidFLAC
+	}
+	kind := int(header>>1) & 0x3f
+	wasted := 0
+	if header&1 != 0 {
+		k, err := d.br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = int(k) + 1
+		bps -= wasted
+	}
+
+	switch {
+	case kind == 0: // CONSTANT
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		for i := range dst {
+			dst[i] = v
+		}
+	case kind == 1: // VERBATIM
+		for i := range dst {
+			if dst[i], err = d.br.readSigned(bps); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12: // FIXED
+		order := kind - 8
+		if err := d.readWarmup(dst, order, bps); err != nil {
+			return err
+		}
+		if err := d.readResidual(dst, order); err != nil {
+			return err
+		}
+		fixedPredict(dst, order)
+	case kind >= 32: // LPC
+		order := kind - 31
+		if err := d.readWarmup(dst, order, bps); err != nil {
+			return err
+		}
+		precision, err := d.br.readBits(4)
+		if err != nil {
+			return err
+		}
+		if precision == 15 {
+			return ErrInvalidFLAC
+		}
+		shift, err := d.br.readSigned(5)
+		if err != nil {
+			return err
+		}
+		if shift < 0 {
+			return ErrInvalidFLAC
+		}
+		coeffs := make([]int32, order)
+		for i := range coeffs {
+			if coeffs[i], err = d.br.readSigned(int(precision) + 1); err != nil {
+				return err
+			}
+		}
+		if err := d.readResidual(dst, order); err != nil {
+			return err
+		}
+		lpcPredict(dst, coeffs, uint(shift))
+	default:
+		return ErrInvalidFLAC
+	}
+
+	if wasted > 0 {
+		for i := range dst {
+			dst[i] <<= uint(wasted)
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readWarmup(dst []int32, order, bps int) error {
+	if order > len(dst) {
+		return ErrInvalidFLAC
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		dst[i] = v
+	}
+	return nil
+}
+
+// readResidual reads the rice coded residual of the prediction into dst after the warm-up samples
+func (d *flacDecoder) readResidual(dst []int32, order int) error {
+	method, err := d.br.readBits(2)
+	if err != nil {
+		return err
+	}
+	paramBits, escape := 4, uint64(15)
+	switch method {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return ErrInvalidFLAC
+	}
+	partitionOrder, err := d.br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(dst) >> partitionOrder
+	if partitionSize < order {
+		return ErrInvalidFLAC
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := partitionSize
+		if p == 0 {
+			n -= order
+		}
+		param, err := d.br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			// The partition is stored unencoded
+			rawBits, err := d.br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for end := i + n; i < end; i++ {
+				if dst[i], err = d.br.readSigned(int(rawBits)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for end := i + n; i < end; i++ {
+			q, err := d.br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := d.br.readBits(int(param))
+			if err != nil {
+				return err
+			}
+			v := q<<param | r
+			dst[i] = int32(v>>1) ^ -int32(v&1)
+		}
+	}
+	return nil
+}
+
+func fixedPredict(s []int32, order int) {
+	for i := order; i < len(s); i++ {
+		switch order {
+		case 1:
+			s[i] += s[i-1]
+		case 2:
+			s[i] += 2*s[i-1] - s[i-2]
+		case 3:
+			s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+	}
+}
+
+func lpcPredict(s []int32, coeffs []int32, shift uint) {
+	for i := len(coeffs); i < len(s); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += int64(c) * int64(s[i-j-1])
+		}
+		s[i] += int32(sum >> shift)
+	}
+}
+
+// decorrelate restores the left and right channels from the stereo decorrelation
+func (d *flacDecoder) decorrelate(h flacFrameHeader) {
+	switch h.assignment {
+	case 8: // left/side
+		left, side := d.samples[0], d.samples[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case 9: // side/right
+		side, right := d.samples[0], d.samples[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case 10: // mid/side
+		mid, side := d.samples[0], d.samples[1]
+		for i := range mid {
+			m := mid[i]<<1 | side[i]&1
+			mid[i] = (m + side[i]) >> 1
+			side[i] = (m - side[i]) >> 1
+		}
+	}
+}
+
+// convert interleaves the channels of the frame to 16-bit samples
+func (d *flacDecoder) convert(h flacFrameHeader) {
+	out := d.pcm[:0]
+	for i := 0; i < h.blockSize; i++ {
+		for ch := 0; ch < h.channels; ch++ {
+			v := d.samples[ch][i]
+			if h.bitsPerSample > 16 {
+				v >>= uint(h.bitsPerSample - 16)
+			} else {
+				v <<= uint(16 - h.bitsPerSample)
+			}
+			out = binary.LittleEndian.AppendUint16(out, uint16(int16(v)))
+		}
+	}
+	d.pcm = out
+	d.pcmData = out
+}
+
+// Seek sets a new position for reading audio data. The frame containing the position is found by the seek table.
+// For streams without a seek table, the frame is searched by bisection of the source
+func (d *flacDecoder) Seek(offset int64, whence int) (int64, error) {
+	sampleSize := int64(d.info.channels * 2)
+	pos, err := seekPosition(offset, whence, d.pcmPos, d.info.totalSamples*sampleSize, int(sampleSize))
+	if err != nil {
+		return 0, err
+	}
+	sample := pos / sampleSize
+
+	frameOffset := d.dataStart
+	if len(d.seekTable) > 0 {
+		i := sort.Search(len(d.seekTable), func(i int) bool { return d.seekTable[i].sample > sample }) - 1
+		if i >= 0 {
+			frameOffset = d.dataStart + d.seekTable[i].offset
+		}
+	} else if frameOffset, err = d.bisect(sample); err != nil {
+		return 0, err
+	}
+
+	// Internal buffers must always be cleared, regardless of the result of seeking
+	d.pcmData = nil
+	d.lastError = nil
+	if err := d.br.seek(frameOffset); err != nil {
+		d.lastError = err
+		return 0, err
+	}
+	d.seeking = true
+	d.seekTarget = pos
+	d.pcmPos = pos
+	return pos, nil
+}
+
+// bisect returns the offset of a frame that starts before the specified sample and is close to it
+func (d *flacDecoder) bisect(sample int64) (int64, error) {
+	lo, hi := d.dataStart, d.size
+	for hi-lo > flacBisectionLimit {
+		mid := lo + (hi-lo)/2
+		offset, h, err := d.findFrame(mid)
+		if err != nil || offset >= hi || h.firstSample > sample {
+			hi = mid
+			continue
+		}
+		lo = offset
+		if sample-h.firstSample < int64(h.blockSize) {
+			break
+		}
+	}
+	return lo, nil
+}
+
+// findFrame returns the offset and header of the first frame after the specified position of the source
+func (d *flacDecoder) findFrame(pos int64) (int64, flacFrameHeader, error) {
+	if err := d.br.seek(pos); err != nil {
+		return 0, flacFrameHeader{}, err
+	}
+	for i := 0; i < flacMaxSyncSearch; i++ {
+		b, err := d.br.r.Peek(2)
+		if err != nil {
+			return 0, flacFrameHeader{}, err
+		}
+		if b[0] == 0xff && b[1]&0xfe == 0xf8 {
+			offset := d.br.pos
+			// The sync code can also occur inside the audio data. The CRC of the header protects from false frames
+			if h, err := d.readFrameHeader(); err == nil && h.channels == d.info.channels && h.sampleRate == d.info.sampleRate {
+				return offset, h, nil
+			}
+			if err := d.br.seek(offset); err != nil {
+				return 0, flacFrameHeader{}, err
+			}
+		}
+		if _, err := d.br.ReadByte(); err != nil {
+			return 0, flacFrameHeader{}, err
+		}
+	}
+	return 0, flacFrameHeader{}, ErrInvalidFLAC
+}
+
+func (d *flacDecoder) SampleRate() int {
+	return d.info.sampleRate
+}
+
+func (d *flacDecoder) Channels() int {
+	return d.info.channels
+}
+
+func (d *flacDecoder) Duration() (time.Duration, error) {
+	if d.info.totalSamples == 0 {
+		return 0, errors.New("flac: total number of samples is unknown")
+	}
+	return samplesDuration(d.info.totalSamples, d.info.sampleRate), nil
+}
+
+// Bitrate returns the average bitrate of the stream
+func (d *flacDecoder) Bitrate() int {
+	duration, err := d.Duration()
+	if err != nil || d.size <= d.dataStart {
+		return 0
+	}
+	return int(float64(d.size-d.dataStart) * 8 / duration.Seconds() / 1000)
+}
+
+func crc8(b []byte) byte {
+	var crc byte
+	for _, v := range b {
+		crc ^= v
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// bitReader reads the source bit by bit starting with the most significant bits
+type bitReader struct {
+	src io.ReadSeeker
+	r   *bufio.Reader
+	// Bits that have been read from the source but not used yet. Only the n low bits are valid
+	buf uint64
+	n   int
+	// Number of bytes read from the source since its beginning
+	pos int64
+}
+
+func newBitReader(src io.ReadSeeker) *bitReader {
+	return &bitReader{src: src, r: bufio.NewReaderSize(src, 1024*64)}
+}
+
+// Read reads whole bytes. The reader must be aligned to the byte boundary
+func (br *bitReader) Read(p []byte) (int, error) {
+	n, err := br.r.Read(p)
+	br.pos += int64(n)
+	return n, err
+}
+
+// ReadByte reads a whole byte. The reader must be aligned to the byte boundary
+func (br *bitReader) ReadByte() (byte, error) {
+	b, err := br.r.ReadByte()
+	if err == nil {
+		br.pos++
+	}
+	return b, err
+}
+
+func (br *bitReader) fill(n int) error {
+	for br.n < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		br.pos++
+		br.buf = br.buf<<8 | uint64(b)
+		br.n += 8
+	}
+	return nil
+}
+
+// readBits reads an unsigned value of n bits. n must not be greater than 32
+func (br *bitReader) readBits(n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if err := br.fill(n); err != nil {
+		return 0, err
+	}
+	br.n -= n
+	return br.buf >> uint(br.n) & (1<<uint(n) - 1), nil
+}
+
+// readSigned reads a signed value of n bits in two's complement
+func (br *bitReader) readSigned(n int) (int32, error) {
+	v, err := br.readBits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int32(int64(v<<uint(64-n)) >> uint(64-n)), nil
+}
+
+// readUnary returns the number of zero bits before the next one bit
+func (br *bitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		if br.n == 0 {
+			if err := br.fill(8); err != nil {
+				return 0, err
+			}
+		}
+		bits64 := br.buf & (1<<uint(br.n) - 1)
+		if bits64 == 0 {
+			count += uint64(br.n)
+			br.n = 0
+			continue
+		}
+		zeros := bits.LeadingZeros64(bits64) - (64 - br.n)
+		count += uint64(zeros)
+		br.n -= zeros + 1
+		return count, nil
+	}
+}
+
+// align discards the remaining bits of the current byte
+func (br *bitReader) align() {
+	br.n = 0
+}
+
+func (br *bitReader) seek(offset int64) error {
+	if _, err := br.src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	br.r.Reset(br.src)
+	br.n = 0
+	br.pos = offset
+	return nil
+}
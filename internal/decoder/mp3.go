@@ -0,0 +1,67 @@
+package decoder
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/lkf"
+	"github.com/kvark128/OnlineLibrary/internal/minimp3"
+)
+
+var MP3 = &Format{
+	Name:       "MP3",
+	Extensions: []string{".mp3"},
+	MimeTypes:  []string{"audio/mpeg"},
+	Open:       openMP3,
+}
+
+// LKF is an mp3 stream encrypted by the LKF cipher
+var LKF = &Format{
+	Name:       "LKF",
+	Extensions: []string{".lkf"},
+	MimeTypes:  []string{"audio/x-lkf"},
+	Open: func(src Source) (Decoder, error) {
+		src.ReadSeeker = lkf.NewReader(src.ReadSeeker)
+		return openMP3(src)
+	},
+}
+
+// mp3Decoder decodes the mp3 stream by minimp3
+type mp3Decoder struct {
+	*minimp3.Decoder
+}
+
+func openMP3(src Source) (Decoder, error) {
+	dec := minimp3.NewDecoder(src.ReadSeeker)
+	// Full scan of the frames is too expensive for network sources
+	dec.SetSourceInfo(src.Size, src.Local)
+	// Reading into an empty buffer will fill the internal buffer of the decoder, so you can get the audio data parameters
+	if _, err := dec.Read(nil); err != nil {
+		return nil, err
+	}
+	if dec.SampleRate() == 0 || dec.Channels() == 0 || dec.Bitrate() == 0 {
+		return nil, errors.New("invalid mp3")
+	}
+	return mp3Decoder{dec}, nil
+}
+
+func (d mp3Decoder) Duration() (time.Duration, error) {
+	index, err := d.FrameIndex()
+	if err != nil {
+		return 0, err
+	}
+	return index.Duration(), nil
+}
+
+func (d mp3Decoder) Index() Index {
+	if index := d.CachedFrameIndex(); index != nil {
+		return index
+	}
+	return nil
+}
+
+func (d mp3Decoder) SetIndex(index Index) {
+	if index, ok := index.(*minimp3.FrameIndex); ok {
+		d.SetFrameIndex(index)
+	}
+}
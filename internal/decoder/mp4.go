@@ -0,0 +1,179 @@
+package decoder
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/aac"
+	"github.com/kvark128/OnlineLibrary/internal/mp4"
+)
+
+// MP4 is the AAC audio in the mp4 container. Audiobooks in this format (m4b) are usually a single file with chapters
+var MP4 = &Format{
+	Name:       "MP4",
+	Extensions: []string{".m4b", ".m4a", ".mp4"},
+	MimeTypes:  []string{"audio/mp4", "audio/x-m4b", "audio/x-m4a"},
+	Book:       true,
+	Open:       openMP4,
+}
+
+// Gaps between samples up to this size are read instead of seeking, because seeking in network sources is expensive
+const mp4MaxSkip = 64 * 1024
+
+// mp4Decoder decodes the AAC samples of the mp4 file one by one
+type mp4Decoder struct {
+	src   io.ReadSeeker
+	size  int64
+	movie *mp4.Movie
+	aac   *aac.Decoder
+	// Position in the source. It is negative if unknown
+	srcPos int64
+	// Index of the next sample to be decoded
+	sample int
+	frame  []byte
+	// Decoded data that has not been read yet and its position
+	pcm    []byte
+	pcmPos int64
+	// Number of bytes of decoded data that must be discarded after seeking
+	skip int64
+}
+
+func openMP4(src Source) (Decoder, error) {
+	movie, err := mp4.Parse(src, src.Size)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := aac.NewDecoder(movie.Config, movie.SampleRate, movie.Channels)
+	if err != nil {
+		return nil, err
+	}
+	if dec.SampleRate() == 0 || dec.Channels() == 0 {
+		return nil, errors.New("invalid aac stream")
+	}
+	return &mp4Decoder{
+		src:    src.ReadSeeker,
+		size:   src.Size,
+		movie:  movie,
+		aac:    dec,
+		srcPos: -1,
+	}, nil
+}
+
+func (d *mp4Decoder) readSample(index int) ([]byte, error) {
+	offset, size := d.movie.Sample(index)
+	if gap := offset - d.srcPos; d.srcPos < 0 || gap < 0 || gap > mp4MaxSkip {
+		if _, err := d.src.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(io.Discard, d.src, gap); err != nil {
+		d.srcPos = -1
+		return nil, err
+	}
+	d.srcPos = offset
+	if cap(d.frame) < size {
+		d.frame = make([]byte, size)
+	}
+	frame := d.frame[:size]
+	n, err := io.ReadFull(d.src, frame)
+	d.srcPos += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (d *mp4Decoder) Read(p []byte) (int, error) {
+	for len(d.pcm) == 0 {
+		if d.sample >= d.movie.Samples() {
+			return 0, io.EOF
+		}
+		frame, err := d.readSample(d.sample)
+		if err != nil {
+			return 0, err
+		}
+		d.sample++
+		pcm, err := d.aac.Decode(frame)
+		if err != nil {
+			return 0, err
+		}
+		if d.skip > 0 {
+			// Audio data before the seek position must be dropped
+			n := d.skip
+			if n > int64(len(pcm)) {
+				n = int64(len(pcm))
+			}
+			pcm = pcm[n:]
+			d.skip -= n
+		}
+		d.pcm = pcm
+	}
+	n := copy(p, d.pcm)
+	d.pcm = d.pcm[n:]
+	d.pcmPos += int64(n)
+	return n, nil
+}
+
+func (d *mp4Decoder) sampleSize() int64 {
+	return int64(d.aac.Channels() * 2)
+}
+
+// pcmOffset converts the time of the track to the position in the decoded data
+func (d *mp4Decoder) pcmOffset(t int64) int64 {
+	return t * int64(d.aac.SampleRate()) / d.movie.Timescale * d.sampleSize()
+}
+
+func (d *mp4Decoder) Seek(offset int64, whence int) (int64, error) {
+	end := d.pcmOffset(d.movie.SampleTime(d.movie.Samples()))
+	pos, err := seekPosition(offset, whence, d.pcmPos, end, int(d.sampleSize()))
+	if err != nil {
+		return 0, err
+	}
+	if pos > end {
+		pos = end
+	}
+
+	// Decoding starts from the previous sample, because each AAC frame overlaps the previous one
+	t := pos / d.sampleSize() * d.movie.Timescale / int64(d.aac.SampleRate())
+	sample := d.movie.SampleAt(t)
+	if sample > 0 {
+		sample--
+	}
+	d.aac.Flush()
+	d.sample = sample
+	d.skip = pos - d.pcmOffset(d.movie.SampleTime(sample))
+	d.pcm = nil
+	d.pcmPos = pos
+	return pos, nil
+}
+
+func (d *mp4Decoder) SampleRate() int {
+	return d.aac.SampleRate()
+}
+
+func (d *mp4Decoder) Channels() int {
+	return d.aac.Channels()
+}
+
+func (d *mp4Decoder) Duration() (time.Duration, error) {
+	return d.movie.Duration(), nil
+}
+
+func (d *mp4Decoder) Bitrate() int {
+	duration := d.movie.Duration()
+	if d.size <= 0 || duration <= 0 {
+		return 0
+	}
+	return int(float64(d.size*8) / duration.Seconds() / 1000)
+}
+
+func (d *mp4Decoder) Chapters() []Chapter {
+	chapters := make([]Chapter, len(d.movie.Chapters))
+	for i, c := range d.movie.Chapters {
+		chapters[i] = Chapter{Title: c.Title, Start: c.Start}
+	}
+	return chapters
+}
@@ -0,0 +1,294 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/ogg"
+	"github.com/kvark128/OnlineLibrary/internal/opus"
+	"github.com/kvark128/OnlineLibrary/internal/vorbis"
+)
+
+// OGG is the Opus or Vorbis audio in the Ogg container. The codec is detected by the first packet of the stream
+var OGG = &Format{
+	Name:       "Ogg",
+	Extensions: []string{".opus", ".ogg", ".oga"},
+	MimeTypes:  []string{"audio/ogg", "audio/opus", "audio/vorbis", "application/ogg"},
+	Open:       openOgg,
+}
+
+// Opus decoders need 80 ms of audio before the seek position to converge
+const opusPreRoll = opus.SampleRate * 80 / 1000
+
+// oggCodec decodes the audio packets of the logical stream
+type oggCodec interface {
+	Decode(packet []byte) ([]byte, error)
+	Reset()
+	Channels() int
+}
+
+// oggDecoder decodes the first logical stream of the Ogg file.
+// All positions are measured in granules, that is in samples per channel of the decoded audio
+type oggDecoder struct {
+	pages      *ogg.Reader
+	packets    *ogg.PacketReader
+	codec      oggCodec
+	sampleRate int
+	size       int64
+	// Samples at the beginning of the stream that must be discarded
+	preSkip int64
+	// Samples that must be decoded before the seek position
+	preRoll int64
+	// Offset of the first page with audio data
+	dataStart int64
+	// Granule position of the end of the stream, or -1 if it is unknown
+	end int64
+	// After seeking, the position of the decoded data is unknown until a page with a granule position is completed.
+	// Until then, the decoded data is accumulated in pending
+	synced  bool
+	pending []byte
+	// Granule position following the last decoded sample
+	next int64
+	// Decoded data before this granule position is discarded
+	skipTo int64
+	pcm    []byte
+	// Granule position of the first sample in pcm
+	pcmPos int64
+}
+
+func openOgg(src Source) (Decoder, error) {
+	pages := ogg.NewReader(src)
+	d := &oggDecoder{
+		pages:   pages,
+		packets: ogg.NewPacketReader(pages),
+		size:    src.Size,
+		end:     -1,
+	}
+
+	head, _, err := d.packets.ReadPacket()
+	if err != nil {
+		return nil, fmt.Errorf("reading ogg header: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("OpusHead")):
+		err = d.openOpus(head)
+	case bytes.HasPrefix(head, []byte("\x01vorbis")):
+		err = d.openVorbis(head)
+	default:
+		err = errors.New("unsupported ogg codec")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Headers always end on a page boundary, so audio data begins on the next page
+	d.dataStart = d.packets.Offset()
+	if src.Size > 0 {
+		if d.end, err = d.pages.LastGranule(d.packets.Serial(), d.dataStart, src.Size); err != nil {
+			return nil, err
+		}
+		if err := d.packets.SeekTo(d.dataStart); err != nil {
+			return nil, err
+		}
+	}
+	d.synced = true
+	d.skipTo = d.preSkip
+	d.pcmPos = d.preSkip
+	return d, nil
+}
+
+func (d *oggDecoder) openOpus(head []byte) error {
+	if len(head) < 19 {
+		return errors.New("invalid opus header")
+	}
+	channels := int(head[9])
+	d.preSkip = int64(binary.LittleEndian.Uint16(head[10:]))
+	gain := int(int16(binary.LittleEndian.Uint16(head[16:])))
+	streams, coupled := 1, 0
+	mapping := []byte{0, 1}
+	if channels == 2 {
+		coupled = 1
+	}
+	if family := head[18]; family != 0 {
+		if len(head) < 21+channels {
+			return errors.New("invalid opus channel mapping")
+		}
+		streams, coupled = int(head[19]), int(head[20])
+		mapping = head[21 : 21+channels]
+	}
+	dec, err := opus.NewDecoder(channels, streams, coupled, mapping, gain)
+	if err != nil {
+		return err
+	}
+
+	// The comment header is not needed
+	if _, _, err := d.packets.ReadPacket(); err != nil {
+		return fmt.Errorf("reading opus tags: %w", err)
+	}
+	d.codec = dec
+	d.sampleRate = opus.SampleRate
+	d.preRoll = opusPreRoll
+	return nil
+}
+
+func (d *oggDecoder) openVorbis(ident []byte) error {
+	headers := [][]byte{append([]byte(nil), ident...)}
+	for len(headers) < 3 {
+		packet, _, err := d.packets.ReadPacket()
+		if err != nil {
+			return fmt.Errorf("reading vorbis headers: %w", err)
+		}
+		headers = append(headers, append([]byte(nil), packet...))
+	}
+	dec, err := vorbis.NewDecoder(headers...)
+	if err != nil {
+		return err
+	}
+	d.codec = dec
+	d.sampleRate = dec.SampleRate()
+	// A long block before the seek position fully restores the overlap
+	d.preRoll = int64(dec.MaxBlockSize())
+	return nil
+}
+
+func (d *oggDecoder) sampleSize() int64 {
+	return int64(d.codec.Channels() * 2)
+}
+
+// decode decodes the next packet and returns the data with a known position
+func (d *oggDecoder) decode() ([]byte, error) {
+	for {
+		packet, granule, err := d.packets.ReadPacket()
+		if err == io.EOF && !d.synced && d.end >= 0 {
+			// The stream ended before the position became known. The pending data is the end of the stream
+			d.synced = true
+			d.next = d.end
+			return d.takePending(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pcm, err := d.codec.Decode(packet)
+		if err != nil {
+			return nil, err
+		}
+		if d.synced {
+			d.next += int64(len(pcm)) / d.sampleSize()
+			return pcm, nil
+		}
+		d.pending = append(d.pending, pcm...)
+		if granule >= 0 {
+			d.synced = true
+			d.next = granule
+			return d.takePending(), nil
+		}
+	}
+}
+
+func (d *oggDecoder) takePending() []byte {
+	pcm := d.pending
+	d.pending = nil
+	return pcm
+}
+
+func (d *oggDecoder) Read(p []byte) (int, error) {
+	ss := d.sampleSize()
+	for len(d.pcm) == 0 {
+		if d.end >= 0 && d.next >= d.end {
+			return 0, io.EOF
+		}
+		pcm, err := d.decode()
+		if err != nil {
+			return 0, err
+		}
+		start := d.next - int64(len(pcm))/ss
+		// The last page specifies the end of the stream, the rest of the decoded data is padding
+		if d.end >= 0 && d.next > d.end {
+			pcm = pcm[:max64(d.end-start, 0)*ss]
+		}
+		if start < d.skipTo {
+			n := d.skipTo - start
+			if n > int64(len(pcm))/ss {
+				n = int64(len(pcm)) / ss
+			}
+			pcm = pcm[n*ss:]
+			start += n
+		}
+		d.pcm = pcm
+		d.pcmPos = start
+	}
+	n := copy(p, d.pcm)
+	d.pcm = d.pcm[n:]
+	d.pcmPos += int64(n) / ss
+	return n, nil
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (d *oggDecoder) Seek(offset int64, whence int) (int64, error) {
+	if d.end < 0 {
+		return 0, errors.New("seeking in ogg stream of unknown size")
+	}
+	ss := d.sampleSize()
+	end := (d.end - d.preSkip) * ss
+	pos, err := seekPosition(offset, whence, (d.pcmPos-d.preSkip)*ss, end, int(ss))
+	if err != nil {
+		return 0, err
+	}
+	if pos > end {
+		pos = end
+	}
+
+	target := pos/ss + d.preSkip
+	start := d.dataStart
+	if target-d.preRoll > 0 {
+		start, err = d.pages.FindGranule(d.packets.Serial(), target-d.preRoll, d.dataStart, d.size)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := d.packets.SeekTo(start); err != nil {
+		return 0, err
+	}
+	d.codec.Reset()
+	// From the beginning of the audio data the position is known
+	d.synced = start == d.dataStart
+	d.next = 0
+	d.pending = nil
+	d.pcm = nil
+	d.pcmPos = target
+	d.skipTo = target
+	return pos, nil
+}
+
+func (d *oggDecoder) SampleRate() int {
+	return d.sampleRate
+}
+
+func (d *oggDecoder) Channels() int {
+	return d.codec.Channels()
+}
+
+func (d *oggDecoder) Duration() (time.Duration, error) {
+	if d.end < 0 {
+		return 0, errors.New("duration of ogg stream of unknown size")
+	}
+	return samplesDuration(d.end-d.preSkip, d.sampleRate), nil
+}
+
+func (d *oggDecoder) Bitrate() int {
+	duration, err := d.Duration()
+	if err != nil || duration <= 0 {
+		return 0
+	}
+	return int(float64(d.size*8) / duration.Seconds() / 1000)
+}
@@ -0,0 +1,214 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+var WAV = &Format{
+	Name:       "WAV",
+	Extensions: []string{".wav"},
+	MimeTypes:  []string{"audio/wav", "audio/x-wav"},
+	Open:       openWAV,
+}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavDecoder converts the PCM data of the wav file to 16-bit samples
+type wavDecoder struct {
+	src           io.ReadSeeker
+	format        int
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+	blockAlign    int
+	// Offset and size of the data chunk in the source
+	dataStart, dataSize int64
+	// Position in the data chunk
+	dataPos int64
+	buf     []byte
+	out     []byte
+	// Converted data that has not been read yet
+	pcm []byte
+}
+
+func openWAV(src Source) (Decoder, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, errors.New("invalid wav")
+	}
+
+	d := &wavDecoder{src: src.ReadSeeker}
+	pos := int64(len(header))
+	for d.dataStart == 0 {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(src, chunk); err != nil {
+			return nil, fmt.Errorf("wav data chunk not found: %w", err)
+		}
+		pos += int64(len(chunk))
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid wav fmt chunk")
+			}
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(src, body); err != nil {
+				return nil, err
+			}
+			pos += int64(len(body))
+			d.parseFmt(body)
+		case "data":
+			if d.blockAlign == 0 {
+				return nil, errors.New("wav fmt chunk is missing")
+			}
+			d.dataStart = pos
+			d.dataSize = size
+			// Some writers do not fill in the size of the data when streaming
+			if available := src.Size - pos; src.Size > 0 && (size == 0 || size == math.MaxUint32 || size > available) {
+				d.dataSize = available
+			}
+			d.dataSize -= d.dataSize % int64(d.blockAlign)
+		default:
+			// Chunks are aligned to an even size
+			n, err := io.CopyN(io.Discard, src, size+size%2)
+			pos += n
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch {
+	case d.format == wavFormatPCM && d.bitsPerSample >= 8 && d.bitsPerSample <= 32 && d.bitsPerSample%8 == 0:
+	case d.format == wavFormatFloat && (d.bitsPerSample == 32 || d.bitsPerSample == 64):
+	default:
+		return nil, fmt.Errorf("unsupported wav format %v with %v bits per sample", d.format, d.bitsPerSample)
+	}
+	if d.channels == 0 || d.sampleRate == 0 || d.blockAlign != d.channels*d.bitsPerSample/8 {
+		return nil, errors.New("invalid wav fmt chunk")
+	}
+	d.buf = make([]byte, d.blockAlign*4096)
+	return d, nil
+}
+
+func (d *wavDecoder) parseFmt(b []byte) {
+	d.format = int(binary.LittleEndian.Uint16(b[0:]))
+	d.channels = int(binary.LittleEndian.Uint16(b[2:]))
+	d.sampleRate = int(binary.LittleEndian.Uint32(b[4:]))
+	d.blockAlign = int(binary.LittleEndian.Uint16(b[12:]))
+	d.bitsPerSample = int(binary.LittleEndian.Uint16(b[14:]))
+	if d.format == wavFormatExtensible && len(b) >= 26 {
+		// The real format is stored at the beginning of the sub format GUID
+		d.format = int(binary.LittleEndian.Uint16(b[24:]))
+	}
+}
+
+func (d *wavDecoder) Read(p []byte) (int, error) {
+	if len(d.pcm) == 0 {
+		left := d.dataSize - d.dataPos
+		if left <= 0 {
+			return 0, io.EOF
+		}
+		buf := d.buf
+		if int64(len(buf)) > left {
+			buf = buf[:left]
+		}
+		n, err := io.ReadFull(d.src, buf)
+		n -= n % d.blockAlign
+		d.dataPos += int64(n)
+		d.pcm = d.convert(buf[:n])
+		if n == 0 {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, d.pcm)
+	d.pcm = d.pcm[n:]
+	return n, nil
+}
+
+// convert converts the samples of the wav file to 16-bit samples
+func (d *wavDecoder) convert(b []byte) []byte {
+	size := d.bitsPerSample / 8
+	if d.format == wavFormatPCM && size == 2 {
+		return b
+	}
+	out := d.out[:0]
+	for i := 0; i+size <= len(b); i += size {
+		var v int16
+		switch {
+		case d.format == wavFormatFloat && size == 4:
+			v = floatToInt16(float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i:]))))
+		case d.format == wavFormatFloat:
+			v = floatToInt16(math.Float64frombits(binary.LittleEndian.Uint64(b[i:])))
+		case size == 1:
+			// 8-bit samples are unsigned
+			v = int16(int(b[i])-128) << 8
+		default:
+			// The most significant bytes of the little-endian sample
+			v = int16(binary.LittleEndian.Uint16(b[i+size-2:]))
+		}
+		out = binary.LittleEndian.AppendUint16(out, uint16(v))
+	}
+	d.out = out
+	return out
+}
+
+func floatToInt16(v float64) int16 {
+	return int16(math.Max(math.Min(v*32768, math.MaxInt16), math.MinInt16))
+}
+
+func (d *wavDecoder) pcmPos() int64 {
+	return d.dataPos/int64(d.blockAlign)*int64(d.channels*2) - int64(len(d.pcm))
+}
+
+func (d *wavDecoder) Seek(offset int64, whence int) (int64, error) {
+	sampleSize := int64(d.channels * 2)
+	end := d.dataSize / int64(d.blockAlign) * sampleSize
+	pos, err := seekPosition(offset, whence, d.pcmPos(), end, int(sampleSize))
+	if err != nil {
+		return 0, err
+	}
+	if pos > end {
+		pos = end
+	}
+	dataPos := pos / sampleSize * int64(d.blockAlign)
+	d.pcm = nil
+	if _, err := d.src.Seek(d.dataStart+dataPos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	d.dataPos = dataPos
+	return pos, nil
+}
+
+func (d *wavDecoder) SampleRate() int {
+	return d.sampleRate
+}
+
+func (d *wavDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *wavDecoder) Duration() (time.Duration, error) {
+	return samplesDuration(d.dataSize/int64(d.blockAlign), d.sampleRate), nil
+}
+
+func (d *wavDecoder) Bitrate() int {
+	return d.sampleRate * d.channels * d.bitsPerSample / 1000
+}
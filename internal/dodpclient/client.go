@@ -0,0 +1,256 @@
+// Package dodpclient is the client of the DAISY Online Delivery Protocol. It uses the data types of the dodp package,
+// but sends the requests through the transport of the service instead of the default transport of the http package
+package dodpclient
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+
+	"github.com/kvark128/dodp"
+)
+
+const (
+	envelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+	dodpNS     = "http://www.daisy.org/ns/daisy-online/"
+)
+
+// Fault is the SOAP fault returned by the service
+type Fault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("soap fault: %v: %v", f.Code, f.String)
+}
+
+// Client sends the operations to the service. The session of the service is kept in the cookies of the client
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewClient creates the client of the service at the URL. The requests are sent through the transport and must be completed within the timeout
+func NewClient(url string, transport http.RoundTripper, timeout time.Duration) *Client {
+	// The jar is created without options, so it can't fail
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Transport: transport, Jar: jar, Timeout: timeout},
+	}
+}
+
+type requestEnvelope struct {
+	XMLName xml.Name `xml:"soap:Envelope"`
+	NS      string   `xml:"xmlns:soap,attr"`
+	Body    struct {
+		Content []byte `xml:",innerxml"`
+	} `xml:"soap:Body"`
+}
+
+// call sends the operation in the SOAP envelope and decodes the element of the response body into response.
+// A fault of the service is returned as *Fault whatever the status of the response
+func (c *Client) call(action string, request, response any) error {
+	content, err := xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+	env := requestEnvelope{NS: envelopeNS}
+	env.Body.Content = content
+	data, err := xml.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(append([]byte(xml.Header), data...)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", fmt.Sprintf("\"/%v\"", action))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := decodeBody(resp.Body, response); err != nil {
+		if _, ok := err.(*Fault); !ok && resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%v: %v", action, resp.Status)
+		}
+		return err
+	}
+	return nil
+}
+
+// decodeBody decodes the first element of the SOAP body into v, or returns the fault
+func decodeBody(r io.Reader, v any) error {
+	dec := xml.NewDecoder(r)
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !inBody {
+			inBody = start.Name.Space == envelopeNS && start.Name.Local == "Body"
+			continue
+		}
+		if start.Name.Local == "Fault" {
+			fault := new(Fault)
+			if err := dec.DecodeElement(fault, &start); err != nil {
+				return err
+			}
+			return fault
+		}
+		return dec.DecodeElement(v, &start)
+	}
+}
+
+func (c *Client) LogOn(username, password string) (bool, error) {
+	request := struct {
+		XMLName  xml.Name `xml:"http://www.daisy.org/ns/daisy-online/ logOn"`
+		Username string   `xml:"username"`
+		Password string   `xml:"password"`
+	}{Username: username, Password: password}
+	var response struct {
+		XMLName xml.Name `xml:"logOnResponse"`
+		Result  bool     `xml:"logOnResult"`
+	}
+	err := c.call("logOn", &request, &response)
+	return response.Result, err
+}
+
+func (c *Client) LogOff() (bool, error) {
+	request := struct {
+		XMLName xml.Name `xml:"http://www.daisy.org/ns/daisy-online/ logOff"`
+	}{}
+	var response struct {
+		XMLName xml.Name `xml:"logOffResponse"`
+		Result  bool     `xml:"logOffResult"`
+	}
+	err := c.call("logOff", &request, &response)
+	return response.Result, err
+}
+
+func (c *Client) GetServiceAttributes() (*dodp.ServiceAttributes, error) {
+	request := struct {
+		XMLName xml.Name `xml:"http://www.daisy.org/ns/daisy-online/ getServiceAttributes"`
+	}{}
+	var response struct {
+		XMLName           xml.Name               `xml:"getServiceAttributesResponse"`
+		ServiceAttributes dodp.ServiceAttributes `xml:"serviceAttributes"`
+	}
+	if err := c.call("getServiceAttributes", &request, &response); err != nil {
+		return nil, err
+	}
+	return &response.ServiceAttributes, nil
+}
+
+func (c *Client) SetReadingSystemAttributes(attrs *dodp.ReadingSystemAttributes) (bool, error) {
+	request := struct {
+		XMLName                 xml.Name                      `xml:"http://www.daisy.org/ns/daisy-online/ setReadingSystemAttributes"`
+		ReadingSystemAttributes *dodp.ReadingSystemAttributes `xml:"readingSystemAttributes"`
+	}{ReadingSystemAttributes: attrs}
+	var response struct {
+		XMLName xml.Name `xml:"setReadingSystemAttributesResponse"`
+		Result  bool     `xml:"setReadingSystemAttributesResult"`
+	}
+	err := c.call("setReadingSystemAttributes", &request, &response)
+	return response.Result, err
+}
+
+// GetContentList returns the items of the list from the first to the last one. The last item -1 means the end of the list
+func (c *Client) GetContentList(id string, firstItem, lastItem int32) (*dodp.ContentList, error) {
+	request := struct {
+		XMLName   xml.Name `xml:"http://www.daisy.org/ns/daisy-online/ getContentList"`
+		ID        string   `xml:"id"`
+		FirstItem int32    `xml:"firstItem"`
+		LastItem  int32    `xml:"lastItem"`
+	}{ID: id, FirstItem: firstItem, LastItem: lastItem}
+	var response struct {
+		XMLName     xml.Name         `xml:"getContentListResponse"`
+		ContentList dodp.ContentList `xml:"contentList"`
+	}
+	if err := c.call("getContentList", &request, &response); err != nil {
+		return nil, err
+	}
+	return &response.ContentList, nil
+}
+
+// contentRequest is the request of the operations that take only the ID of the content
+type contentRequest struct {
+	XMLName   xml.Name
+	ContentID string `xml:"contentID"`
+}
+
+func newContentRequest(action, id string) *contentRequest {
+	return &contentRequest{XMLName: xml.Name{Space: dodpNS, Local: action}, ContentID: id}
+}
+
+func (c *Client) GetContentMetadata(id string) (*dodp.ContentMetadata, error) {
+	var response struct {
+		XMLName         xml.Name             `xml:"getContentMetadataResponse"`
+		ContentMetadata dodp.ContentMetadata `xml:"contentMetadata"`
+	}
+	if err := c.call("getContentMetadata", newContentRequest("getContentMetadata", id), &response); err != nil {
+		return nil, err
+	}
+	return &response.ContentMetadata, nil
+}
+
+func (c *Client) GetContentResources(id string) (*dodp.Resources, error) {
+	var response struct {
+		XMLName   xml.Name       `xml:"getContentResourcesResponse"`
+		Resources dodp.Resources `xml:"resources"`
+	}
+	if err := c.call("getContentResources", newContentRequest("getContentResources", id), &response); err != nil {
+		return nil, err
+	}
+	return &response.Resources, nil
+}
+
+func (c *Client) IssueContent(id string) (bool, error) {
+	var response struct {
+		XMLName xml.Name `xml:"issueContentResponse"`
+		Result  bool     `xml:"issueContentResult"`
+	}
+	err := c.call("issueContent", newContentRequest("issueContent", id), &response)
+	return response.Result, err
+}
+
+func (c *Client) ReturnContent(id string) (bool, error) {
+	var response struct {
+		XMLName xml.Name `xml:"returnContentResponse"`
+		Result  bool     `xml:"returnContentResult"`
+	}
+	err := c.call("returnContent", newContentRequest("returnContent", id), &response)
+	return response.Result, err
+}
+
+func (c *Client) GetQuestions(userResponses *dodp.UserResponses) (*dodp.Questions, error) {
+	request := struct {
+		XMLName       xml.Name            `xml:"http://www.daisy.org/ns/daisy-online/ getQuestions"`
+		UserResponses *dodp.UserResponses `xml:"userResponses"`
+	}{UserResponses: userResponses}
+	var response struct {
+		XMLName   xml.Name       `xml:"getQuestionsResponse"`
+		Questions dodp.Questions `xml:"questions"`
+	}
+	if err := c.call("getQuestions", &request, &response); err != nil {
+		return nil, err
+	}
+	return &response.Questions, nil
+}
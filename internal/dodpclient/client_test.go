@@ -0,0 +1,84 @@
+package dodpclient
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func envelope(body string) string {
+	return xml.Header + `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     bool
+		wantErr  bool
+		wantFail bool
+	}{
+		{"success", http.StatusOK, `<logOnResponse xmlns="http://www.daisy.org/ns/daisy-online/"><logOnResult>true</logOnResult></logOnResponse>`, true, false, false},
+		{"refusal", http.StatusOK, `<ns:logOnResponse xmlns:ns="http://www.daisy.org/ns/daisy-online/"><ns:logOnResult>false</ns:logOnResult></ns:logOnResponse>`, false, false, false},
+		{"fault", http.StatusInternalServerError, `<s:Fault><faultcode>s:Client</faultcode><faultstring>invalidParameter</faultstring></s:Fault>`, false, true, true},
+		{"unexpected response", http.StatusOK, `<logOffResponse><logOffResult>true</logOffResult></logOffResponse>`, false, true, false},
+	}
+	for _, tt := range tests {
+		var action, username string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action = r.Header.Get("SOAPAction")
+			var env struct {
+				Body struct {
+					LogOn struct {
+						Username string `xml:"username"`
+					} `xml:"http://www.daisy.org/ns/daisy-online/ logOn"`
+				} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+			}
+			if err := xml.NewDecoder(r.Body).Decode(&env); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			username = env.Body.LogOn.Username
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, envelope(tt.body))
+		}))
+
+		transport := &countingTransport{}
+		c := NewClient(server.URL, transport, time.Second*5)
+		got, err := c.LogOn("user", "secret")
+		server.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		var fault *Fault
+		if errors.As(err, &fault) != tt.wantFail {
+			t.Errorf("%v: error %v, want fault %v", tt.name, err, tt.wantFail)
+		}
+		if got != tt.want {
+			t.Errorf("%v: result %v, want %v", tt.name, got, tt.want)
+		}
+		if action != `"/logOn"` || username != "user" {
+			t.Errorf("%v: server got action %v for user %q", tt.name, action, username)
+		}
+		if transport.requests != 1 {
+			t.Errorf("%v: %d requests through the transport, want 1", tt.name, transport.requests)
+		}
+	}
+}
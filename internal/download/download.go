@@ -0,0 +1,146 @@
+// Package download fetches the resources of books to the local disk.
+// Resources are downloaded by several workers at once. An interrupted resource is kept as a partial file and resumed from where it stopped
+package download
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/connection"
+	"github.com/kvark128/OnlineLibrary/internal/log"
+	"github.com/kvark128/dodp"
+)
+
+var (
+	SizeMismatch = errors.New("resource size mismatch")
+)
+
+const (
+	// Number of workers, if it is not set
+	DefaultWorkers = 3
+	// Number of attempts to download a resource without receiving any data
+	maxAttempts = 5
+	// Delay before the second attempt. It doubles with every next attempt up to the maximum
+	firstRetryDelay = time.Second
+	maxRetryDelay   = time.Second * 30
+	// Interval at which the progress is reported
+	progressInterval = time.Second
+)
+
+// Progress is the state of downloading all resources
+type Progress struct {
+	// Size of all resources and the number of bytes already on the disk, including the partial files
+	Total      int64
+	Downloaded int64
+	// Average speed in bytes per second
+	Speed int64
+}
+
+// Percent returns the part of the downloaded bytes in percent
+func (p Progress) Percent() int {
+	if p.Total <= 0 {
+		return 0
+	}
+	return int(p.Downloaded * 100 / p.Total)
+}
+
+// Downloader downloads resources with a pool of workers
+type Downloader struct {
+	workers int
+	logger  *log.Logger
+}
+
+// New creates a downloader with the specified number of workers. With zero workers the default number is used
+func New(workers int, logger *log.Logger) *Downloader {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Downloader{workers: workers, logger: logger}
+}
+
+// Download fetches the resources to the directory through the transport. The rate of all workers together is restricted by the limiters.
+// The progress is reported periodically until the function returns.
+// On the first error that remains after retries the other workers are stopped, but the partial files are kept
+func (d *Downloader) Download(parent context.Context, rsrc []dodp.Resource, dir string, transport *connection.Transport, limiters []*connection.Limiter, progress func(Progress)) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var total int64
+	for _, r := range rsrc {
+		total += r.Size
+	}
+	downloaded := new(atomic.Int64)
+
+	jobs := make(chan dodp.Resource)
+	var err error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers && i < len(rsrc); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				if e := d.fetch(ctx, r, dir, transport, limiters, downloaded); e != nil {
+					errOnce.Do(func() {
+						err = e
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	reporterDone := make(chan struct{})
+	go func() {
+		defer close(reporterDone)
+		d.report(ctx, total, downloaded, progress)
+	}()
+
+feed:
+	for _, r := range rsrc {
+		select {
+		case jobs <- r:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	cancel()
+	<-reporterDone
+	progress(Progress{Total: total, Downloaded: downloaded.Load()})
+
+	if err == nil {
+		// The downloading could be canceled by the caller before all resources were given to the workers
+		err = parent.Err()
+	}
+	return err
+}
+
+// report calls the progress function at regular intervals until the context is done
+func (d *Downloader) report(ctx context.Context, total int64, downloaded *atomic.Int64, progress func(Progress)) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	last, lastTime := downloaded.Load(), time.Now()
+	var speed float64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n := downloaded.Load()
+			current := float64(n-last) / now.Sub(lastTime).Seconds()
+			// The speed is smoothed, so a single slow interval does not make it jump
+			if speed == 0 {
+				speed = current
+			} else {
+				speed = speed*0.7 + current*0.3
+			}
+			last, lastTime = n, now
+			progress(Progress{Total: total, Downloaded: n, Speed: int64(speed)})
+		}
+	}
+}
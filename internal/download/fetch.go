@@ -0,0 +1,133 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/connection"
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"github.com/kvark128/dodp"
+)
+
+// Suffix of the file in which the resource is downloaded. The file is renamed after the whole resource has been received
+const partSuffix = ".part"
+
+// partPath returns the path to the partial file of the resource
+func partPath(path string) string {
+	return path + partSuffix
+}
+
+// fetch downloads the resource to the directory, resuming the partial file. The received bytes are added to the counter.
+// Attempts that fail without receiving any data or with a body of the wrong size are repeated with increasing delays up to the limit
+func (d *Downloader) fetch(ctx context.Context, r dodp.Resource, dir string, transport *connection.Transport, limiters []*connection.Limiter, counter *atomic.Int64) error {
+	path := filepath.Join(dir, r.LocalURI)
+	if util.FileIsExist(path, r.Size) {
+		// This resource already exists on disk
+		counter.Add(r.Size)
+		return nil
+	}
+
+	if info, err := os.Stat(partPath(path)); err == nil && info.Size() <= r.Size {
+		counter.Add(info.Size())
+		if info.Size() > 0 {
+			d.logger.Debug("Resuming %v from %v bytes", r.LocalURI, info.Size())
+		}
+	}
+
+	delay := firstRetryDelay
+	// A body of the wrong size is not progress, since the partial file is discarded. Such attempts are never counted anew
+	mismatches := 0
+	for attempt := 1; ; attempt++ {
+		n, err := d.fetchPart(ctx, r, path, transport, limiters, counter)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(err, SizeMismatch) {
+			mismatches++
+		} else if n > 0 {
+			// The connection worked for a while, so the attempts are counted anew
+			attempt, delay = 0, firstRetryDelay
+		}
+		if attempt >= maxAttempts || mismatches >= maxAttempts {
+			return fmt.Errorf("%v: %w", r.LocalURI, err)
+		}
+		d.logger.Warning("Downloading %v: %v. Retrying in %v", r.LocalURI, err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// fetchPart appends the rest of the resource to the partial file and renames it when the resource is complete.
+// Returns the number of bytes received
+func (d *Downloader) fetchPart(ctx context.Context, r dodp.Resource, path string, transport *connection.Transport, limiters []*connection.Limiter, counter *atomic.Int64) (int64, error) {
+	part := partPath(path)
+	if err := os.MkdirAll(filepath.Dir(part), os.ModeDir); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if offset > r.Size {
+		// The partial file does not belong to this resource, so it has not been counted
+		if err := f.Truncate(0); err != nil {
+			return 0, err
+		}
+		offset, _ = f.Seek(0, io.SeekStart)
+	}
+
+	var n int64
+	if offset < r.Size {
+		conn, err := connection.NewConnectionFrom(ctx, r.URI, offset, transport, d.logger)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		conn.SetLimiters(limiters...)
+		n, err = io.Copy(&countingWriter{w: f, counter: counter}, conn)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if offset+n != r.Size {
+		// Nothing can be resumed from the file of the wrong size
+		f.Truncate(0)
+		counter.Add(-(offset + n))
+		return n, SizeMismatch
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(part, path)
+}
+
+// countingWriter adds the number of written bytes to the counter
+type countingWriter struct {
+	w       io.Writer
+	counter *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.counter.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,559 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/connection"
+	"github.com/kvark128/OnlineLibrary/internal/log"
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"github.com/kvark128/dodp"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	JobNotFound = errors.New("download job not found")
+)
+
+// JobState is the state of a book in the download queue
+type JobState string
+
+const (
+	JobQueued  JobState = "queued"
+	JobRunning JobState = "running"
+	JobPaused  JobState = "paused"
+	JobFailed  JobState = "failed"
+)
+
+// Resource is a file of the book to be downloaded
+type Resource struct {
+	URI      string `yaml:"uri"`
+	LocalURI string `yaml:"local_uri"`
+	Size     int64  `yaml:"size"`
+}
+
+// Job is the download of a book
+type Job struct {
+	// ID of the book and of the service from which it is downloaded
+	ID        string     `yaml:"id"`
+	Service   string     `yaml:"service,omitempty"`
+	Title     string     `yaml:"title"`
+	Dir       string     `yaml:"dir"`
+	Resources []Resource `yaml:"resources"`
+	State     JobState   `yaml:"state"`
+	// Error of the last attempt of the failed job
+	Err string `yaml:"error,omitempty"`
+	// Progress of the running job. For the other jobs only the total size is known
+	Progress Progress `yaml:"-"`
+	cancel   context.CancelFunc
+	// The running job is being paused or removed, or stopped outside the download window
+	pausing, removing, waiting bool
+	// The URIs of the resources may have expired, so they must be requested again before the next start
+	stale bool
+}
+
+// NewJob creates the download job of the book with the specified resources
+func NewJob(id, service, title, dir string, rsrc []dodp.Resource) *Job {
+	job := &Job{ID: id, Service: service, Title: title, Dir: dir}
+	for _, r := range rsrc {
+		job.Resources = append(job.Resources, Resource{URI: r.URI, LocalURI: r.LocalURI, Size: r.Size})
+	}
+	return job
+}
+
+func (job *Job) resources() []dodp.Resource {
+	rsrc := make([]dodp.Resource, len(job.Resources))
+	for i, r := range job.Resources {
+		rsrc[i] = dodp.Resource{URI: r.URI, LocalURI: r.LocalURI, Size: r.Size}
+	}
+	return rsrc
+}
+
+func (job *Job) total() int64 {
+	var total int64
+	for _, r := range job.Resources {
+		total += r.Size
+	}
+	return total
+}
+
+// Queue downloads the books one after another, or several at once with the limited concurrency.
+// The queued, paused and failed jobs are kept in the file, so they survive a restart of the program
+type Queue struct {
+	mu          sync.Mutex
+	path        string
+	downloader  *Downloader
+	concurrency int
+	logger      *log.Logger
+	Jobs        []*Job `yaml:"jobs,omitempty"`
+	// Called after any change of the jobs, and after the job has been finished successfully or with an error
+	changeCallback func()
+	doneCallback   func(job Job, err error)
+	started        bool
+	// Restrictions of downloading from all services and from each service by its ID
+	global   Limits
+	services map[string]Limits
+	// Transports of the services by their IDs. The default transport is used for the services that are not in the map
+	transports map[string]*connection.Transport
+	// Returns the resources of the book with the URIs currently given by the service. Nil means that the saved URIs are used
+	resolve Resolver
+	// Closed to stop checking the schedule
+	stopTicker chan struct{}
+	// Running workers of the jobs
+	wg sync.WaitGroup
+}
+
+// Resolver returns the resources with the URIs currently given by the service for the book with the ID. The resources must be in the same order
+type Resolver func(id, service string, rsrc []dodp.Resource) ([]dodp.Resource, error)
+
+// Interval at which the queue checks whether the jobs may run according to the schedule
+const scheduleInterval = time.Minute
+
+// NewQueue creates the queue that is stored in the file at the path. With zero concurrency one book is downloaded at a time
+func NewQueue(path string, downloader *Downloader, concurrency int, logger *log.Logger) *Queue {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Queue{path: path, downloader: downloader, concurrency: concurrency, logger: logger}
+}
+
+// Load reads the jobs from the file. The jobs that were running are queued again
+func (q *Queue) Load() error {
+	f, err := os.Open(q.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := yaml.NewDecoder(f).Decode(q); err != nil && err != io.EOF {
+		return err
+	}
+	for _, job := range q.Jobs {
+		if job.State == JobRunning {
+			job.State = JobQueued
+		}
+		job.Progress = Progress{Total: job.total()}
+		job.stale = true
+	}
+	return nil
+}
+
+// Save writes the jobs to the file
+func (q *Queue) Save() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.save()
+}
+
+// store saves the queue and logs the error. Must be called with the queue locked
+func (q *Queue) store() {
+	if err := q.save(); err != nil {
+		q.logger.Error("Saving download queue: %v", err)
+	}
+}
+
+func (q *Queue) save() error {
+	f, err := util.CreateSecureFile(q.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yaml.NewEncoder(f).Encode(q); err != nil {
+		f.Corrupted()
+		return err
+	}
+	return nil
+}
+
+// SetCallbacks sets the functions that are called after a change of the jobs and after a job is finished.
+// They are called without the queue locked, so they can call the queue
+func (q *Queue) SetCallbacks(change func(), done func(job Job, err error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changeCallback = change
+	q.doneCallback = done
+}
+
+// SetChangeCallback replaces the function that is called after a change of the jobs
+func (q *Queue) SetChangeCallback(change func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changeCallback = change
+}
+
+// SetLimits sets the restrictions of downloading from all services and from each service by its ID.
+// The running jobs get the new limiters on the next start
+func (q *Queue) SetLimits(global Limits, services map[string]Limits) {
+	q.mu.Lock()
+	q.global = global
+	q.services = services
+	if q.schedule() {
+		q.store()
+	}
+	q.mu.Unlock()
+	q.changed()
+}
+
+// SetResolver sets the function that requests the current URIs of the resources before a job is resumed
+func (q *Queue) SetResolver(resolve Resolver) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.resolve = resolve
+}
+
+// SetTransports sets the transports of the services by their IDs. The running jobs get the new transports on the next start
+func (q *Queue) SetTransports(transports map[string]*connection.Transport) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.transports = transports
+}
+
+// Start begins downloading the queued jobs
+func (q *Queue) Start() {
+	q.mu.Lock()
+	q.started = true
+	q.stopTicker = make(chan struct{})
+	go q.watchSchedule(q.stopTicker)
+	if q.schedule() {
+		q.store()
+	}
+	q.mu.Unlock()
+	q.changed()
+}
+
+// watchSchedule starts and stops the jobs when the download windows open and close
+func (q *Queue) watchSchedule(stop chan struct{}) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		q.mu.Lock()
+		changed := q.schedule()
+		if changed {
+			q.store()
+		}
+		q.mu.Unlock()
+		if changed {
+			q.changed()
+		}
+	}
+}
+
+// Stop interrupts the running jobs and waits for their workers. The jobs are queued again and resumed on the next start
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.started {
+		q.mu.Unlock()
+		return
+	}
+	q.started = false
+	close(q.stopTicker)
+	for _, job := range q.Jobs {
+		if job.State == JobRunning {
+			job.cancel()
+		}
+	}
+	q.mu.Unlock()
+
+	// The workers save the queue when they stop, so the file must not be written by them after the final saving
+	q.wg.Wait()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.store()
+}
+
+// Add puts the job at the end of the queue. If the book is already in the queue, its job is updated and queued again
+func (q *Queue) Add(job *Job) {
+	q.mu.Lock()
+	job.State = JobQueued
+	job.Progress = Progress{Total: job.total()}
+	if i := q.index(job.ID); i >= 0 {
+		old := q.Jobs[i]
+		if old.State == JobRunning {
+			// The running job already downloads this book
+			q.mu.Unlock()
+			return
+		}
+		q.Jobs[i] = job
+	} else {
+		q.Jobs = append(q.Jobs, job)
+	}
+	q.logger.Debug("Book %v added to the download queue", job.ID)
+	q.schedule()
+	q.store()
+	q.mu.Unlock()
+	q.changed()
+}
+
+// List returns copies of the jobs in the order of the queue
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.Jobs))
+	for i, job := range q.Jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// Pause stops the job. Its partial files are kept, so it continues from the same place when resumed
+func (q *Queue) Pause(id string) error {
+	return q.update(id, func(job *Job) {
+		switch job.State {
+		case JobRunning:
+			job.pausing = true
+			job.cancel()
+		case JobQueued, JobFailed:
+			job.State = JobPaused
+		}
+	})
+}
+
+// Resume queues the paused or failed job again
+func (q *Queue) Resume(id string) error {
+	return q.update(id, func(job *Job) {
+		if job.State == JobPaused || job.State == JobFailed {
+			job.State = JobQueued
+			job.Err = ""
+		}
+	})
+}
+
+// Cancel removes the job from the queue and deletes its partial files. The resources that were downloaded completely remain
+func (q *Queue) Cancel(id string) error {
+	return q.update(id, func(job *Job) {
+		if job.State == JobRunning {
+			// The job is removed when its worker stops
+			job.removing = true
+			job.cancel()
+			return
+		}
+		q.remove(job)
+	})
+}
+
+// Move shifts the job by the specified number of positions towards the end of the queue, or towards the beginning if it is negative
+func (q *Queue) Move(id string, delta int) error {
+	return q.update(id, func(job *Job) {
+		i := q.index(id)
+		j := i + delta
+		if j < 0 {
+			j = 0
+		}
+		if j >= len(q.Jobs) {
+			j = len(q.Jobs) - 1
+		}
+		copy(q.Jobs[i:], q.Jobs[i+1:])
+		q.Jobs = q.Jobs[:len(q.Jobs)-1]
+		q.Jobs = append(q.Jobs[:j], append([]*Job{job}, q.Jobs[j:]...)...)
+	})
+}
+
+// update applies the function to the job and starts the jobs that can run.
+// The queue is saved if the state of a job or the order of the jobs has changed
+func (q *Queue) update(id string, f func(job *Job)) error {
+	q.mu.Lock()
+	i := q.index(id)
+	if i < 0 {
+		q.mu.Unlock()
+		return JobNotFound
+	}
+	job := q.Jobs[i]
+	state := job.State
+	f(job)
+	changed := job.State != state || q.index(id) != i
+	if q.schedule() || changed {
+		q.store()
+	}
+	q.mu.Unlock()
+	q.changed()
+	return nil
+}
+
+func (q *Queue) index(id string) int {
+	for i, job := range q.Jobs {
+		if job.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// remove deletes the job and its partial files. Must be called with the queue locked
+func (q *Queue) remove(job *Job) {
+	if i := q.index(job.ID); i >= 0 && q.Jobs[i] == job {
+		q.Jobs = append(q.Jobs[:i], q.Jobs[i+1:]...)
+	}
+	for _, r := range job.Resources {
+		os.Remove(partPath(filepath.Join(job.Dir, r.LocalURI)))
+	}
+}
+
+// Allowed reports whether the job may run now according to the schedules
+func (q *Queue) Allowed(job Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.allowed(&job, time.Now())
+}
+
+func (q *Queue) allowed(job *Job, now time.Time) bool {
+	return q.global.Schedule.Allows(now) && q.services[job.Service].Schedule.Allows(now)
+}
+
+// limiters returns the limiters of the rate that apply to the job. Must be called with the queue locked
+func (q *Queue) limiters(job *Job) []*connection.Limiter {
+	var limiters []*connection.Limiter
+	if l := q.global.Limiter; l != nil {
+		limiters = append(limiters, l)
+	}
+	if l := q.services[job.Service].Limiter; l != nil {
+		limiters = append(limiters, l)
+	}
+	return limiters
+}
+
+// schedule stops the running jobs outside their download windows and starts the queued jobs in order
+// while the number of running jobs is less than the concurrency. Reports whether any job has been started or stopped.
+// Must be called with the queue locked
+func (q *Queue) schedule() bool {
+	if !q.started {
+		return false
+	}
+	changed := false
+	now := time.Now()
+	running := 0
+	for _, job := range q.Jobs {
+		if job.State != JobRunning || job.pausing || job.removing || job.waiting {
+			continue
+		}
+		if !q.allowed(job, now) {
+			q.logger.Debug("Download window of book %v is closed", job.ID)
+			job.waiting = true
+			job.cancel()
+			changed = true
+			continue
+		}
+		running++
+	}
+	for _, job := range q.Jobs {
+		if running >= q.concurrency {
+			break
+		}
+		if job.State == JobQueued && q.allowed(job, now) {
+			q.run(job)
+			running++
+			changed = true
+		}
+	}
+	return changed
+}
+
+// run starts downloading the job in the background. Must be called with the queue locked
+func (q *Queue) run(job *Job) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	job.cancel = cancel
+	job.State = JobRunning
+	job.Err = ""
+	job.pausing, job.removing, job.waiting = false, false, false
+	rsrc := job.resources()
+	limiters := q.limiters(job)
+	transport := q.transports[job.Service]
+	var resolve Resolver
+	if job.stale && job.Service != "" {
+		resolve = q.resolve
+	}
+	q.logger.Debug("Downloading book %v started", job.ID)
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		var err error
+		if resolve != nil {
+			rsrc, err = q.refresh(job, resolve, rsrc)
+		}
+		if err == nil {
+			err = q.downloader.Download(ctx, rsrc, job.Dir, transport, limiters, func(p Progress) {
+				q.mu.Lock()
+				job.Progress = p
+				q.mu.Unlock()
+				q.changed()
+			})
+		}
+		cancel()
+
+		q.mu.Lock()
+		var done func(job Job, err error)
+		switch {
+		case job.removing:
+			q.remove(job)
+		case job.pausing:
+			job.State = JobPaused
+			job.stale = true
+		case !q.started || job.waiting:
+			// The queue has been stopped or the download window has closed. The job continues later
+			job.State = JobQueued
+			job.stale = true
+		case err != nil:
+			job.State = JobFailed
+			job.Err = err.Error()
+			job.stale = true
+			done = q.doneCallback
+		default:
+			q.remove(job)
+			done = q.doneCallback
+		}
+		finished := *job
+		q.schedule()
+		q.store()
+		q.mu.Unlock()
+
+		if done != nil {
+			done(finished, err)
+		}
+		q.changed()
+	}()
+}
+
+// refresh replaces the URIs of the resources of the job by the current ones. It is called by the worker of the job
+func (q *Queue) refresh(job *Job, resolve Resolver, rsrc []dodp.Resource) ([]dodp.Resource, error) {
+	q.mu.Lock()
+	id, service := job.ID, job.Service
+	q.mu.Unlock()
+	current, err := resolve(id, service, rsrc)
+	if err != nil {
+		return nil, fmt.Errorf("requesting resources: %w", err)
+	}
+	if len(current) != len(rsrc) {
+		return nil, fmt.Errorf("requesting resources: %d resources received instead of %d", len(current), len(rsrc))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range job.Resources {
+		job.Resources[i].URI = current[i].URI
+	}
+	job.stale = false
+	q.logger.Debug("Resources of book %v requested again", id)
+	return current, nil
+}
+
+// changed calls the change callback
+func (q *Queue) changed() {
+	q.mu.Lock()
+	change := q.changeCallback
+	q.mu.Unlock()
+	if change != nil {
+		change()
+	}
+}
@@ -0,0 +1,72 @@
+package download
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/connection"
+)
+
+// Window is the time of day during which downloading is allowed. The window ends on the next day if its end is before its start
+type Window struct {
+	// Time since midnight
+	Start, End time.Duration
+}
+
+// Schedule is the set of windows during which downloading is allowed. Downloading is always allowed by the empty schedule
+type Schedule []Window
+
+// ParseSchedule parses the windows in the form "HH:MM-HH:MM"
+func ParseSchedule(windows []string) (Schedule, error) {
+	var s Schedule
+	for _, w := range windows {
+		start, end, ok := strings.Cut(w, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid download window %q", w)
+		}
+		var win Window
+		var err error
+		if win.Start, err = parseTimeOfDay(start); err != nil {
+			return nil, fmt.Errorf("invalid download window %q: %w", w, err)
+		}
+		if win.End, err = parseTimeOfDay(end); err != nil {
+			return nil, fmt.Errorf("invalid download window %q: %w", w, err)
+		}
+		s = append(s, win)
+	}
+	return s, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Allows reports whether downloading is allowed at the moment
+func (s Schedule) Allows(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, w := range s {
+		if w.Start <= w.End {
+			if now >= w.Start && now < w.End {
+				return true
+			}
+		} else if now >= w.Start || now < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits are the restrictions of downloading from a service or from all services
+type Limits struct {
+	// Limiter of the rate. Nil means no limit
+	Limiter  *connection.Limiter
+	Schedule Schedule
+}
@@ -0,0 +1,75 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		windows []string
+		want    Schedule
+		wantErr bool
+	}{
+		{windows: nil, want: nil},
+		{windows: []string{"01:00-07:30"}, want: Schedule{{Start: time.Hour, End: 7*time.Hour + 30*time.Minute}}},
+		{windows: []string{" 23:00 - 06:00 "}, want: Schedule{{Start: 23 * time.Hour, End: 6 * time.Hour}}},
+		{windows: []string{"00:00-08:00", "12:00-13:00"}, want: Schedule{{Start: 0, End: 8 * time.Hour}, {Start: 12 * time.Hour, End: 13 * time.Hour}}},
+		{windows: []string{"01:00"}, wantErr: true},
+		{windows: []string{"25:00-07:00"}, wantErr: true},
+		{windows: []string{"01:00-07:60"}, wantErr: true},
+		{windows: []string{"01:00-07:00", "night"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSchedule(tt.windows)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSchedule(%q) error = %v, want error %v", tt.windows, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseSchedule(%q) = %v, want %v", tt.windows, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseSchedule(%q) = %v, want %v", tt.windows, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestScheduleAllows(t *testing.T) {
+	at := func(hour, min, sec int) time.Time {
+		return time.Date(2024, time.March, 1, hour, min, sec, 0, time.Local)
+	}
+	day := Schedule{{Start: 9 * time.Hour, End: 17 * time.Hour}}
+	night := Schedule{{Start: 23 * time.Hour, End: 6 * time.Hour}}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		t        time.Time
+		want     bool
+	}{
+		{"empty schedule", nil, at(3, 0, 0), true},
+		{"before the window", day, at(8, 59, 59), false},
+		{"start of the window", day, at(9, 0, 0), true},
+		{"inside the window", day, at(12, 30, 0), true},
+		{"end of the window", day, at(17, 0, 0), false},
+		{"before the night window", night, at(22, 59, 59), false},
+		{"start of the night window", night, at(23, 0, 0), true},
+		{"before midnight", night, at(23, 59, 59), true},
+		{"midnight", night, at(0, 0, 0), true},
+		{"after midnight", night, at(5, 59, 59), true},
+		{"end of the night window", night, at(6, 0, 0), false},
+		{"day in the night schedule", night, at(12, 0, 0), false},
+		{"second window", Schedule{day[0], night[0]}, at(1, 0, 0), true},
+		{"between the windows", Schedule{day[0], night[0]}, at(20, 0, 0), false},
+		{"empty window", Schedule{{Start: 9 * time.Hour, End: 9 * time.Hour}}, at(9, 0, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.schedule.Allows(tt.t); got != tt.want {
+			t.Errorf("%v: Allows(%v) = %v, want %v", tt.name, tt.t.Format("15:04:05"), got, tt.want)
+		}
+	}
+}
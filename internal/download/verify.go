@@ -0,0 +1,100 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
+	"github.com/kvark128/OnlineLibrary/internal/util/buffer"
+	"github.com/kvark128/dodp"
+)
+
+var (
+	ResourceMissing = errors.New("resource is missing")
+	NoAudioData     = errors.New("no audio data")
+)
+
+// Number of undecodable bytes that are allowed in a resource. Tags at the end of the stream are not audio frames, but they are not damage
+const maxSkippedBytes = 4 * 1024
+
+// Damage is a resource of the book that did not pass the verification
+type Damage struct {
+	Resource dodp.Resource
+	Err      error
+}
+
+// Verify checks the resources of the book in the directory. Each resource must exist and have the size from the resource list.
+// Audio resources must also be decoded completely, so that truncated and garbled fragments are found.
+// The progress is called after each resource with the number of checked resources. An error is returned only if the context is canceled
+func Verify(ctx context.Context, rsrc []dodp.Resource, dir string, progress func(checked, total int)) ([]Damage, error) {
+	var damages []Damage
+	for i, r := range rsrc {
+		if err := verifyResource(ctx, r, filepath.Join(dir, r.LocalURI)); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			damages = append(damages, Damage{Resource: r, Err: err})
+		}
+		if progress != nil {
+			progress(i+1, len(rsrc))
+		}
+	}
+	return damages, nil
+}
+
+func verifyResource(ctx context.Context, r dodp.Resource, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ResourceMissing
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != r.Size {
+		return SizeMismatch
+	}
+	if !decoder.Supported(r.LocalURI, r.MimeType) {
+		// Only the size of the other resources can be checked
+		return nil
+	}
+
+	dec, err := decoder.Open(r.LocalURI, r.MimeType, decoder.Source{ReadSeeker: buffer.NewReader(f), Size: r.Size, Local: true})
+	if err != nil {
+		return err
+	}
+
+	var decoded int64
+	buf := make([]byte, 64*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := dec.Read(buf)
+		decoded += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if decoded == 0 {
+		return NoAudioData
+	}
+	if skipper, ok := dec.(decoder.Skipper); ok && skipper.Skipped() > maxSkippedBytes {
+		return fmt.Errorf("%d bytes of damaged audio data", skipper.Skipped())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package equalizer
+
+import "math"
+
+// biquad is a second order IIR filter. Coefficients are calculated by the formulas from the Audio EQ Cookbook by Robert Bristow-Johnson
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	// Filter state for each channel
+	x1, x2, y1, y2 []float64
+}
+
+func newBiquad(band Band, sampleRate, channels int) *biquad {
+	q := band.Q
+	if q <= 0 {
+		q = DefaultQ
+	}
+	a := math.Pow(10, band.Gain/40)
+	w0 := 2 * math.Pi * band.Frequency / float64(sampleRate)
+	cos := math.Cos(w0)
+	alpha := math.Sin(w0) / (2 * q)
+	sqrtA2alpha := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch band.Type {
+	case LowShelf:
+		b0 = a * ((a + 1) - (a-1)*cos + sqrtA2alpha)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - sqrtA2alpha)
+		a0 = (a + 1) + (a-1)*cos + sqrtA2alpha
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - sqrtA2alpha
+	case HighShelf:
+		b0 = a * ((a + 1) + (a-1)*cos + sqrtA2alpha)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - sqrtA2alpha)
+		a0 = (a + 1) - (a-1)*cos + sqrtA2alpha
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - sqrtA2alpha
+	case HighPass:
+		b0 = (1 + cos) / 2
+		b1 = -(1 + cos)
+		b2 = (1 + cos) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cos
+		a2 = 1 - alpha
+	case LowPass:
+		b0 = (1 - cos) / 2
+		b1 = 1 - cos
+		b2 = (1 - cos) / 2
+		a0 = 1 + alpha
+		a1 = -2 * cos
+		a2 = 1 - alpha
+	default: // Peaking
+		b0 = 1 + alpha*a
+		b1 = -2 * cos
+		b2 = 1 - alpha*a
+		a0 = 1 + alpha/a
+		a1 = -2 * cos
+		a2 = 1 - alpha/a
+	}
+
+	return &biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b2 / a0,
+		a1: a1 / a0,
+		a2: a2 / a0,
+		x1: make([]float64, channels),
+		x2: make([]float64, channels),
+		y1: make([]float64, channels),
+		y2: make([]float64, channels),
+	}
+}
+
+func (f *biquad) process(x float64, ch int) float64 {
+	y := f.b0*x + f.b1*f.x1[ch] + f.b2*f.x2[ch] - f.a1*f.y1[ch] - f.a2*f.y2[ch]
+	f.x2[ch], f.x1[ch] = f.x1[ch], x
+	f.y2[ch], f.y1[ch] = f.y1[ch], y
+	return y
+}
+
+func (f *biquad) reset() {
+	for ch := range f.x1 {
+		f.x1[ch], f.x2[ch], f.y1[ch], f.y2[ch] = 0, 0, 0, 0
+	}
+}
@@ -0,0 +1,55 @@
+package equalizer
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// response returns the gain of the filter at the frequency in dB
+func response(f *biquad, freq float64, sampleRate int) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(sampleRate)))
+	h := (complex(f.b0, 0) + complex(f.b1, 0)*z + complex(f.b2, 0)*z*z) / (1 + complex(f.a1, 0)*z + complex(f.a2, 0)*z*z)
+	return 20 * math.Log10(cmplx.Abs(h))
+}
+
+func TestBiquadResponse(t *testing.T) {
+	const sampleRate = 44100
+	const nyquist = sampleRate / 2
+	cutoff := 20 * math.Log10(DefaultQ)
+	tests := []struct {
+		band Band
+		freq float64
+		// Gain in dB. Minus infinity means that the frequency is suppressed completely
+		want float64
+	}{
+		{Band{Type: Peaking, Frequency: 1000, Gain: 6}, 1000, 6},
+		{Band{Type: Peaking, Frequency: 1000, Gain: 6}, 0, 0},
+		{Band{Type: Peaking, Frequency: 1000, Gain: 6}, nyquist, 0},
+		{Band{Type: Peaking, Frequency: 3000, Gain: -9, Q: 2}, 3000, -9},
+		{Band{Type: LowShelf, Frequency: 200, Gain: 6}, 0, 6},
+		{Band{Type: LowShelf, Frequency: 200, Gain: 6}, 200, 3},
+		{Band{Type: LowShelf, Frequency: 200, Gain: 6}, nyquist, 0},
+		{Band{Type: HighShelf, Frequency: 4000, Gain: -6}, nyquist, -6},
+		{Band{Type: HighShelf, Frequency: 4000, Gain: -6}, 4000, -3},
+		{Band{Type: HighShelf, Frequency: 4000, Gain: -6}, 0, 0},
+		{Band{Type: HighPass, Frequency: 100}, 0, math.Inf(-1)},
+		{Band{Type: HighPass, Frequency: 100}, 100, cutoff},
+		{Band{Type: HighPass, Frequency: 100}, nyquist, 0},
+		{Band{Type: LowPass, Frequency: 4000}, 0, 0},
+		{Band{Type: LowPass, Frequency: 4000}, 4000, cutoff},
+		{Band{Type: LowPass, Frequency: 4000}, nyquist, math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		got := response(newBiquad(tt.band, sampleRate, 1), tt.freq, sampleRate)
+		if math.IsInf(tt.want, -1) {
+			if got > -120 {
+				t.Errorf("%v %v Hz: gain at %v Hz is %.2f dB, want suppression", tt.band.Type, tt.band.Frequency, tt.freq, got)
+			}
+			continue
+		}
+		if math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%v %v Hz: gain at %v Hz is %.2f dB, want %.2f dB", tt.band.Type, tt.band.Frequency, tt.freq, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package equalizer
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+type BandType string
+
+const (
+	Peaking   BandType = "peaking"
+	LowShelf  BandType = "low_shelf"
+	HighShelf BandType = "high_shelf"
+	HighPass  BandType = "high_pass"
+	LowPass   BandType = "low_pass"
+)
+
+// Quality factor used for bands without it
+const DefaultQ = 0.707
+
+// Band describes a single filter of the equalizer
+type Band struct {
+	Type BandType `yaml:"type"`
+	// Center or cutoff frequency in Hz
+	Frequency float64 `yaml:"frequency"`
+	// Gain in dB. Not used by the high pass and low pass filters
+	Gain float64 `yaml:"gain,omitempty"`
+	Q    float64 `yaml:"q,omitempty"`
+}
+
+// Equalizer filters the 16-bit PCM data read from the source by a chain of biquad filters
+type Equalizer struct {
+	src        io.Reader
+	sampleRate int
+	channels   int
+	filters    []*biquad
+	// Linear gain applied before filtering to leave headroom for boosted bands
+	preamp float64
+	// Channel of the next sample in the stream
+	ch int
+}
+
+func NewReader(src io.Reader, sampleRate, channels int) *Equalizer {
+	return &Equalizer{
+		src:        src,
+		sampleRate: sampleRate,
+		channels:   channels,
+		preamp:     1,
+	}
+}
+
+// SetBands replaces the filters of the equalizer. With no bands the data passes unchanged
+func (eq *Equalizer) SetBands(bands []Band) {
+	eq.filters = nil
+	var maxGain float64
+	for _, band := range bands {
+		if band.Frequency <= 0 || band.Frequency >= float64(eq.sampleRate)/2 {
+			// The filter can't work above the Nyquist frequency
+			continue
+		}
+		eq.filters = append(eq.filters, newBiquad(band, eq.sampleRate, eq.channels))
+		if band.Type != HighPass && band.Type != LowPass && band.Gain > maxGain {
+			maxGain = band.Gain
+		}
+	}
+	// The maximum boost is compensated completely, so the boosted bands don't clip.
+	// Only the sum of overlapping boosts can still reach the limit of the sample range
+	eq.preamp = math.Pow(10, -maxGain/20)
+}
+
+// Reset clears the state of the filters. Must be called after changing the position of the source
+func (eq *Equalizer) Reset() {
+	for _, f := range eq.filters {
+		f.reset()
+	}
+	eq.ch = 0
+}
+
+func (eq *Equalizer) Read(p []byte) (int, error) {
+	n, err := eq.src.Read(p)
+	if len(eq.filters) == 0 {
+		return n, err
+	}
+
+	for i := 0; i+1 < n; i += 2 {
+		x := float64(int16(binary.LittleEndian.Uint16(p[i:]))) * eq.preamp
+		for _, f := range eq.filters {
+			x = f.process(x, eq.ch)
+		}
+		x = math.Max(math.Min(x, math.MaxInt16), math.MinInt16)
+		binary.LittleEndian.PutUint16(p[i:], uint16(int16(x)))
+		eq.ch = (eq.ch + 1) % eq.channels
+	}
+	return n, err
+}
@@ -0,0 +1,40 @@
+package equalizer
+
+// Names of the equalizer presets
+const (
+	Off           = "off"
+	SpeechClarity = "speech_clarity"
+	BassCut       = "bass_cut"
+	HearingAid    = "hearing_aid"
+	// Bands of the user preset are stored in the config
+	User = "user"
+)
+
+var presets = map[string][]Band{
+	SpeechClarity: {
+		{Type: HighPass, Frequency: 80},
+		{Type: Peaking, Frequency: 250, Gain: -3, Q: 1},
+		{Type: Peaking, Frequency: 3000, Gain: 4, Q: 1},
+		{Type: HighShelf, Frequency: 6000, Gain: 2},
+	},
+	BassCut: {
+		{Type: HighPass, Frequency: 150},
+		{Type: LowShelf, Frequency: 300, Gain: -6},
+	},
+	HearingAid: {
+		{Type: HighPass, Frequency: 100},
+		{Type: Peaking, Frequency: 1000, Gain: 3, Q: 1},
+		{Type: Peaking, Frequency: 2500, Gain: 6, Q: 1},
+		{Type: HighShelf, Frequency: 4000, Gain: 8},
+	},
+}
+
+// Presets returns the names of all presets in the order they are shown to the user
+func Presets() []string {
+	return []string{Off, SpeechClarity, BassCut, HearingAid, User}
+}
+
+// Preset returns the bands of the built-in preset. For Off, User and unknown names nil is returned
+func Preset(name string) []Band {
+	return presets[name]
+}
@@ -86,6 +86,78 @@ func BookInfoDialog(owner Form, title, description string) int {
 	return <-res
 }
 
+// StatisticsDialog shows the report. Returns DlgCmdOK if the user has chosen to export the statistics
+func StatisticsDialog(owner Form, title, report string) int {
+	parent := owner.form()
+	var (
+		dlg               *walk.Dialog
+		ExportPB, ClosePB *walk.PushButton
+		parentSize        = parent.Size()
+	)
+
+	layout := Dialog{
+		Title:        title,
+		AssignTo:     &dlg,
+		Layout:       VBox{},
+		CancelButton: &ClosePB,
+		MinSize:      Size{Width: parentSize.Width / 2, Height: parentSize.Height / 2},
+		Children: []Widget{
+
+			TextEdit{
+				Accessibility: Accessibility{Name: title},
+				Text:          report,
+				ReadOnly:      true,
+				VScroll:       true,
+			},
+
+			Composite{
+				Layout: HBox{},
+				Children: []Widget{
+					HSpacer{},
+					PushButton{
+						AssignTo: &ExportPB,
+						Text:     gotext.Get("Export to CSV..."),
+						OnClicked: func() {
+							dlg.Close(walk.DlgCmdOK)
+						},
+					},
+					PushButton{
+						AssignTo: &ClosePB,
+						Text:     gotext.Get("Close"),
+						OnClicked: func() {
+							dlg.Close(walk.DlgCmdClose)
+						},
+					},
+				},
+			},
+		},
+	}
+
+	res := make(chan int)
+	parent.Synchronize(func() {
+		layout.Create(parent)
+		dlg.Run()
+		res <- dlg.Result()
+	})
+	return <-res
+}
+
+// SaveFileDialog asks for the path of the file to be saved. The filter has the form "Description (*.ext)|*.ext"
+func SaveFileDialog(owner Form, title, filter string, path *string) int {
+	parent := owner.form()
+	res := make(chan int)
+	parent.Synchronize(func() {
+		dlg := walk.FileDialog{Title: title, Filter: filter, FilePath: *path}
+		if ok, err := dlg.ShowSave(parent); err != nil || !ok {
+			res <- DlgCmdCancel
+			return
+		}
+		*path = dlg.FilePath
+		res <- DlgCmdOK
+	})
+	return <-res
+}
+
 func TextEntryDialog(owner Form, title, msg, value string, text *string) int {
 	parent := owner.form()
 	var (
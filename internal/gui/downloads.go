@@ -0,0 +1,135 @@
+package gui
+
+import (
+	"github.com/kvark128/walk"
+	. "github.com/kvark128/walk/declarative"
+	"github.com/leonelquinteros/gotext"
+)
+
+// DownloadAction is a command that the user applies to the selected download
+type DownloadAction int
+
+const (
+	DownloadPauseResume DownloadAction = iota
+	DownloadMoveUp
+	DownloadMoveDown
+	DownloadCancel
+)
+
+// DownloadItem is a line of the downloads list
+type DownloadItem struct {
+	ID    string
+	Label string
+}
+
+// DownloadsDialog shows the download queue. The list can be updated from any goroutine while the dialog is open
+type DownloadsDialog struct {
+	parent walk.Form
+	dlg    *walk.Dialog
+	list   *walk.ListBox
+	items  []DownloadItem
+	closed bool
+}
+
+// NewDownloadsDialog creates the dialog. The action is called in the GUI thread with the ID of the selected download
+func NewDownloadsDialog(owner Form, title string, action func(a DownloadAction, id string)) *DownloadsDialog {
+	dd := &DownloadsDialog{parent: owner.form()}
+	var ClosePB *walk.PushButton
+
+	apply := func(a DownloadAction) {
+		if i := dd.list.CurrentIndex(); i >= 0 && i < len(dd.items) {
+			action(a, dd.items[i].ID)
+		}
+	}
+
+	layout := Dialog{
+		Title:        title,
+		AssignTo:     &dd.dlg,
+		Layout:       VBox{},
+		CancelButton: &ClosePB,
+		MinSize:      Size{Width: 480, Height: 320},
+		Children: []Widget{
+
+			ListBox{
+				Accessibility: Accessibility{Name: title},
+				AssignTo:      &dd.list,
+			},
+
+			Composite{
+				Layout: HBox{},
+				Children: []Widget{
+					PushButton{
+						Text:      gotext.Get("Pause / Resume"),
+						OnClicked: func() { apply(DownloadPauseResume) },
+					},
+					PushButton{
+						Text:      gotext.Get("Move up"),
+						OnClicked: func() { apply(DownloadMoveUp) },
+					},
+					PushButton{
+						Text:      gotext.Get("Move down"),
+						OnClicked: func() { apply(DownloadMoveDown) },
+					},
+					PushButton{
+						Text:      gotext.Get("Cancel download"),
+						OnClicked: func() { apply(DownloadCancel) },
+					},
+					HSpacer{},
+					PushButton{
+						AssignTo: &ClosePB,
+						Text:     gotext.Get("Close"),
+						OnClicked: func() {
+							dd.dlg.Close(walk.DlgCmdClose)
+						},
+					},
+				},
+			},
+		},
+	}
+
+	done := make(chan bool)
+	dd.parent.Synchronize(func() {
+		layout.Create(dd.parent)
+		done <- true
+	})
+	<-done
+	return dd
+}
+
+// SetItems replaces the list. The selection stays on the same download. It does not wait for the list to be updated,
+// so it can be called from the action
+func (dd *DownloadsDialog) SetItems(items []DownloadItem) {
+	dd.parent.Synchronize(func() {
+		if dd.closed {
+			return
+		}
+		var selected string
+		if i := dd.list.CurrentIndex(); i >= 0 && i < len(dd.items) {
+			selected = dd.items[i].ID
+		}
+		dd.items = items
+		labels := make([]string, len(items))
+		current := 0
+		for i, item := range items {
+			labels[i] = item.Label
+			if item.ID == selected {
+				current = i
+			}
+		}
+		dd.list.SetModel(labels)
+		if len(labels) > 0 {
+			dd.list.SetCurrentIndex(current)
+		}
+	})
+}
+
+// Run shows the dialog and waits until it is closed
+func (dd *DownloadsDialog) Run() {
+	done := make(chan bool)
+	dd.parent.Synchronize(func() {
+		dd.dlg.Run()
+		dd.closed = true
+		done <- true
+	})
+	<-done
+}
@@ -14,6 +14,12 @@ var (
 	previous_fragment = msg.Message{Code: msg.PLAYER_OFFSET_FRAGMENT, Data: -1}
 )
 
+// Messages for switching chapters
+var (
+	next_chapter     = msg.Message{Code: msg.PLAYER_OFFSET_CHAPTER, Data: +1}
+	previous_chapter = msg.Message{Code: msg.PLAYER_OFFSET_CHAPTER, Data: -1}
+)
+
 // Messages for rewinding a fragment
 var (
 	rewind_5sec_forward  = msg.Message{Code: msg.PLAYER_OFFSET_POSITION, Data: time.Second * 5}
@@ -96,6 +96,15 @@ func NewMainWindow() (*MainWnd, error) {
 						Enabled:     Bind("libraryLogon"),
 						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LIBRARY_INFO} },
 					},
+					Action{
+						Text:        gotext.Get("Downloads"),
+						Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyJ},
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.DOWNLOADS_SHOW} },
+					},
+					Action{
+						Text:        gotext.Get("Listening statistics"),
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.STATISTICS_SHOW} },
+					},
 					Action{
 						Text:        gotext.Get("Delete account"),
 						Enabled:     Bind("libraryLogon"),
@@ -126,6 +135,10 @@ func NewMainWindow() (*MainWnd, error) {
 						Enabled:     Bind("libraryLogon"),
 						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.DOWNLOAD_BOOK} },
 					},
+					Action{
+						Text:        gotext.Get("Verify book"),
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.VERIFY_BOOK} },
+					},
 					Action{
 						Text:        gotext.Get("Remove book from bookshelf"),
 						Shortcut:    Shortcut{Modifiers: walk.ModShift, Key: walk.KeyDelete},
@@ -154,6 +167,39 @@ func NewMainWindow() (*MainWnd, error) {
 							},
 						},
 					},
+					Menu{
+						Text:     gotext.Get("A-B loop"),
+						AssignTo: &wnd.menuBar.loopMenu,
+						Items: []MenuItem{
+							Action{
+								Text:        gotext.Get("Mark loop start"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyA},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_MARK_START} },
+							},
+							Action{
+								Text:        gotext.Get("Mark loop end"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyB},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_MARK_END} },
+							},
+							Action{
+								Text:        gotext.Get("Cancel loop"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyL},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_CANCEL} },
+							},
+							Action{
+								Text:        gotext.Get("Number of repeats..."),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_SET_COUNT} },
+							},
+							Action{
+								Text:        gotext.Get("Pause between repeats..."),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_SET_PAUSE} },
+							},
+							Action{
+								Text:        gotext.Get("Save loop..."),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.LOOP_SAVE} },
+							},
+						},
+					},
 					Action{
 						Text:        gotext.Get("Play / Pause"),
 						Shortcut:    Shortcut{Key: walk.KeySpace},
@@ -164,6 +210,18 @@ func NewMainWindow() (*MainWnd, error) {
 						Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeySpace},
 						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_STOP} },
 					},
+					Action{
+						Text:        gotext.Get("Time information"),
+						Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyT},
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_TIME_INFO} },
+					},
+					Action{
+						Text:        gotext.Get("Skip silence"),
+						AssignTo:    &wnd.menuBar.skipSilenceItem,
+						Checkable:   true,
+						Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyS},
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SKIP_SILENCE} },
+					},
 
 					Menu{
 						Text: gotext.Get("Book navigation"),
@@ -178,6 +236,11 @@ func NewMainWindow() (*MainWnd, error) {
 								Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyG},
 								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_GOTO_FRAGMENT} },
 							},
+							Action{
+								Text:        gotext.Get("Go to percent..."),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyG},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_GOTO_PERCENT} },
+							},
 							Action{
 								Text:        gotext.Get("Next fragment"),
 								Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyNext},
@@ -188,6 +251,21 @@ func NewMainWindow() (*MainWnd, error) {
 								Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyPrior},
 								OnTriggered: func() { wnd.msgChan <- previous_fragment },
 							},
+							Action{
+								Text:        gotext.Get("Go to chapter..."),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyH},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_GOTO_CHAPTER} },
+							},
+							Action{
+								Text:        gotext.Get("Next chapter"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyNext},
+								OnTriggered: func() { wnd.msgChan <- next_chapter },
+							},
+							Action{
+								Text:        gotext.Get("Previous chapter"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyPrior},
+								OnTriggered: func() { wnd.msgChan <- previous_chapter },
+							},
 						},
 					},
 
@@ -288,6 +366,32 @@ func NewMainWindow() (*MainWnd, error) {
 							},
 						},
 					},
+
+					Menu{
+						Text: gotext.Get("Pitch"),
+						Items: []MenuItem{
+							Action{
+								Text:        gotext.Get("Increase pitch"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyUp},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_PITCH_UP} },
+							},
+							Action{
+								Text:        gotext.Get("Decrease pitch"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyDown},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_PITCH_DOWN} },
+							},
+							Action{
+								Text:        gotext.Get("Reset pitch"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyR},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_PITCH_RESET} },
+							},
+						},
+					},
+
+					Menu{
+						Text:     gotext.Get("Equalizer for this book"),
+						AssignTo: &wnd.menuBar.bookEqualizerMenu,
+					},
 				},
 			},
 			Menu{
@@ -301,11 +405,63 @@ func NewMainWindow() (*MainWnd, error) {
 						Text:     gotext.Get("Language"),
 						AssignTo: &wnd.menuBar.languageMenu,
 					},
+					Menu{
+						Text:     gotext.Get("Equalizer"),
+						AssignTo: &wnd.menuBar.equalizerMenu,
+					},
+					Action{
+						Text:        gotext.Get("Loudness normalization"),
+						AssignTo:    &wnd.menuBar.normalizationItem,
+						Checkable:   true,
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_NORMALIZATION} },
+					},
+					Action{
+						Text:        gotext.Get("Smart rewind on resume"),
+						AssignTo:    &wnd.menuBar.smartRewindItem,
+						Checkable:   true,
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SMART_REWIND} },
+					},
+					Menu{
+						Text:           gotext.Get("Pause timer"),
+						AssignActionTo: &wnd.menuBar.pauseTimerItem,
+						Items: []MenuItem{
+							Action{
+								Text:        gotext.Get("Pause after a time..."),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyP},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SET_TIMER} },
+							},
+							Action{
+								Text:        gotext.Get("Pause at the end of the chapter"),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SET_TIMER_CHAPTER_END} },
+							},
+							Action{
+								Text:        gotext.Get("Pause after several chapters..."),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SET_TIMER_CHAPTERS} },
+							},
+							Action{
+								Text:        gotext.Get("Extend the timer"),
+								Shortcut:    Shortcut{Modifiers: walk.ModControl | walk.ModShift, Key: walk.KeyP},
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_EXTEND_TIMER} },
+							},
+							Action{
+								Text:        gotext.Get("Fade out before the pause"),
+								AssignTo:    &wnd.menuBar.timerFadeItem,
+								Checkable:   true,
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_TIMER_FADE} },
+							},
+							Action{
+								Text:        gotext.Get("Disable the timer"),
+								OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_DISABLE_TIMER} },
+							},
+						},
+					},
+					Action{
+						Text:        gotext.Get("Download speed limit..."),
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.DOWNLOAD_SET_RATE} },
+					},
 					Action{
-						Text:        gotext.Get("Pause timer"),
-						AssignTo:    &wnd.menuBar.pauseTimerItem,
-						Shortcut:    Shortcut{Modifiers: walk.ModControl, Key: walk.KeyP},
-						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.PLAYER_SET_TIMER} },
+						Text:        gotext.Get("Fragments cache size..."),
+						OnTriggered: func() { wnd.msgChan <- msg.Message{Code: msg.CACHE_SET_LIMIT} },
 					},
 					Menu{
 						Text:     gotext.Get("Logging level"),
@@ -357,6 +513,12 @@ func NewMainWindow() (*MainWnd, error) {
 			StatusBarItem{
 				AssignTo: &wnd.statusBar.bookPercent,
 			},
+			StatusBarItem{
+				AssignTo: &wnd.statusBar.timeLeft,
+			},
+			StatusBarItem{
+				AssignTo: &wnd.statusBar.buffer,
+			},
 		},
 	}
 
@@ -2,6 +2,7 @@ package gui
 
 import (
 	"github.com/kvark128/OnlineLibrary/internal/config"
+	"github.com/kvark128/OnlineLibrary/internal/equalizer"
 	"github.com/kvark128/OnlineLibrary/internal/gui/msg"
 	"github.com/kvark128/OnlineLibrary/internal/lang"
 	"github.com/kvark128/OnlineLibrary/internal/log"
@@ -14,9 +15,14 @@ type MenuBar struct {
 	libraryMenu, outputDeviceMenu        *walk.Menu
 	libraryLogon                         *walk.MutableCondition
 	bookMenu, bookmarkMenu, logLevelMenu *walk.Menu
+	loopMenu                             *walk.Menu
 	bookMenuEnabled                      *walk.MutableCondition
 	languageMenu                         *walk.Menu
-	pauseTimerItem                       *walk.Action
+	equalizerMenu, bookEqualizerMenu     *walk.Menu
+	pauseTimerItem, timerFadeItem        *walk.Action
+	skipSilenceItem                      *walk.Action
+	normalizationItem                    *walk.Action
+	smartRewindItem                      *walk.Action
 	msgCH                                chan msg.Message
 }
 
@@ -82,6 +88,45 @@ func (mb *MenuBar) SetBookmarksMenu(bookmarks map[string]string) {
 	})
 }
 
+// Number of the loop menu items that are not saved loops
+const loopMenuCommands = 6
+
+// SetLoopsMenu fills in the loop menu with the saved loops before the loop commands
+func (mb *MenuBar) SetLoopsMenu(loops map[string]string) {
+	mb.wnd.Synchronize(func() {
+		actions := mb.loopMenu.Actions()
+		for i := actions.Len(); i > loopMenuCommands; i-- {
+			actions.RemoveAt(0)
+		}
+
+		for id, name := range loops {
+			id := id
+			subMenu, err := walk.NewMenu()
+			if err != nil {
+				panic(err)
+			}
+			a, err := actions.InsertMenu(0, subMenu)
+			if err != nil {
+				panic(err)
+			}
+			a.SetText(name)
+			loopActions := subMenu.Actions()
+			playAction := walk.NewAction()
+			playAction.SetText(gotext.Get("Play"))
+			playAction.Triggered().Attach(func() {
+				mb.msgCH <- msg.Message{Code: msg.LOOP_FETCH, Data: id}
+			})
+			loopActions.Add(playAction)
+			removeAction := walk.NewAction()
+			removeAction.SetText(gotext.Get("Remove..."))
+			removeAction.Triggered().Attach(func() {
+				mb.msgCH <- msg.Message{Code: msg.LOOP_REMOVE, Data: id}
+			})
+			loopActions.Add(removeAction)
+		}
+	})
+}
+
 func (mb *MenuBar) SetBookMenuEnabled(enabled bool) {
 	mb.wnd.Synchronize(func() {
 		mb.bookMenuEnabled.SetSatisfied(enabled)
@@ -141,16 +186,96 @@ func (mb *MenuBar) SetLanguageMenu(langs []lang.Language, current string) {
 	})
 }
 
-func (mb *MenuBar) SetPauseTimerLabel(minutes int) {
-	label := gotext.Get("Pause timer (no)")
-	if minutes > 0 {
-		label = gotext.Get("Pause timer (%d min.)", minutes)
+func equalizerPresetLabel(name string) string {
+	switch name {
+	case equalizer.Off:
+		return gotext.Get("Off")
+	case equalizer.SpeechClarity:
+		return gotext.Get("Speech clarity")
+	case equalizer.BassCut:
+		return gotext.Get("Bass cut")
+	case equalizer.HearingAid:
+		return gotext.Get("Hearing aid")
+	case equalizer.User:
+		return gotext.Get("User preset")
+	}
+	return name
+}
+
+// SetEqualizerMenu fills in the menu of the global equalizer preset
+func (mb *MenuBar) SetEqualizerMenu(current string) {
+	if current == "" {
+		current = equalizer.Off
 	}
+	mb.setEqualizerMenu(mb.equalizerMenu, equalizer.Presets(), current, msg.EQUALIZER_SET)
+}
+
+// SetBookEqualizerMenu fills in the menu of the equalizer preset for the current book. Empty name means the global preset
+func (mb *MenuBar) SetBookEqualizerMenu(current string) {
+	names := append([]string{""}, equalizer.Presets()...)
+	mb.setEqualizerMenu(mb.bookEqualizerMenu, names, current, msg.EQUALIZER_SET_BOOK)
+}
+
+func (mb *MenuBar) setEqualizerMenu(menu *walk.Menu, names []string, current string, code msg.MessageCode) {
+	mb.wnd.Synchronize(func() {
+		actions := menu.Actions()
+		actions.Clear()
+
+		for _, name := range names {
+			name := name // Avoid capturing the iteration variable
+			a := walk.NewAction()
+			if name == "" {
+				a.SetText(gotext.Get("Global setting"))
+			} else {
+				a.SetText(equalizerPresetLabel(name))
+			}
+			if name == current {
+				a.SetChecked(true)
+			}
+			a.Triggered().Attach(func() {
+				actions := menu.Actions()
+				for k := 0; k < actions.Len(); k++ {
+					actions.At(k).SetChecked(false)
+				}
+				a.SetChecked(true)
+				mb.msgCH <- msg.Message{Code: code, Data: name}
+			})
+			actions.Add(a)
+		}
+	})
+}
+
+// SetPauseTimerLabel sets the label of the pause timer menu, which describes the current timer
+func (mb *MenuBar) SetPauseTimerLabel(label string) {
 	mb.wnd.Synchronize(func() {
 		mb.pauseTimerItem.SetText(label)
 	})
 }
 
+func (mb *MenuBar) SetTimerFadeChecked(checked bool) {
+	mb.wnd.Synchronize(func() {
+		mb.timerFadeItem.SetChecked(checked)
+	})
+}
+
+func (mb *MenuBar) SetSkipSilenceChecked(checked bool) {
+	mb.wnd.Synchronize(func() {
+		mb.skipSilenceItem.SetChecked(checked)
+	})
+}
+
+func (mb *MenuBar) SetNormalizationChecked(checked bool) {
+	mb.wnd.Synchronize(func() {
+		mb.normalizationItem.SetChecked(checked)
+	})
+}
+
+func (mb *MenuBar) SetSmartRewindChecked(checked bool) {
+	mb.wnd.Synchronize(func() {
+		mb.smartRewindItem.SetChecked(checked)
+	})
+}
+
 func (mb *MenuBar) SetLogLevelMenu(levels []log.Level, current log.Level) {
 	mb.wnd.Synchronize(func() {
 		actions := mb.logLevelMenu.Actions()
@@ -13,6 +13,8 @@ const (
 	OPEN_NEWBOOKS
 	MAIN_MENU
 	DOWNLOAD_BOOK
+	VERIFY_BOOK
+	DOWNLOADS_SHOW
 	BOOK_DESCRIPTION
 	ISSUE_BOOK
 	REMOVE_BOOK
@@ -22,9 +24,13 @@ const (
 	LIBRARY_ADD
 	LIBRARY_REMOVE
 	LIBRARY_INFO
+	STATISTICS_SHOW
 	PLAYER_SPEED_RESET
 	PLAYER_SPEED_UP
 	PLAYER_SPEED_DOWN
+	PLAYER_PITCH_RESET
+	PLAYER_PITCH_UP
+	PLAYER_PITCH_DOWN
 	PLAYER_VOLUME_RESET
 	PLAYER_VOLUME_UP
 	PLAYER_VOLUME_DOWN
@@ -33,12 +39,37 @@ const (
 	PLAYER_OFFSET_FRAGMENT
 	PLAYER_OFFSET_POSITION
 	PLAYER_GOTO_FRAGMENT
+	PLAYER_OFFSET_CHAPTER
+	PLAYER_GOTO_CHAPTER
 	PLAYER_GOTO_POSITION
+	PLAYER_GOTO_PERCENT
 	PLAYER_OUTPUT_DEVICE
 	PLAYER_SET_TIMER
+	PLAYER_SET_TIMER_CHAPTER_END
+	PLAYER_SET_TIMER_CHAPTERS
+	PLAYER_DISABLE_TIMER
+	PLAYER_EXTEND_TIMER
+	PLAYER_TIMER_FADE
+	PLAYER_TIMER_EXPIRED
+	PLAYER_TIME_INFO
+	PLAYER_SKIP_SILENCE
+	EQUALIZER_SET
+	EQUALIZER_SET_BOOK
+	PLAYER_NORMALIZATION
+	PLAYER_SMART_REWIND
 	BOOKMARK_SET
 	BOOKMARK_FETCH
 	BOOKMARK_REMOVE
+	LOOP_MARK_START
+	LOOP_MARK_END
+	LOOP_CANCEL
+	LOOP_SET_COUNT
+	LOOP_SET_PAUSE
+	LOOP_SAVE
+	LOOP_FETCH
+	LOOP_REMOVE
 	SET_LANGUAGE
+	CACHE_SET_LIMIT
+	DOWNLOAD_SET_RATE
 	LOG_SET_LEVEL
 )
@@ -11,7 +11,7 @@ import (
 
 type StatusBar struct {
 	*walk.StatusBar
-	elapseTime, totalTime, fragments, bookPercent *walk.StatusBarItem
+	elapseTime, totalTime, fragments, bookPercent, timeLeft, buffer *walk.StatusBarItem
 }
 
 func (sb *StatusBar) SetElapsedTime(elapsed time.Duration) {
@@ -41,3 +41,21 @@ func (sb *StatusBar) SetBookPercent(p int) {
 		sb.bookPercent.SetText(text)
 	})
 }
+
+func (sb *StatusBar) SetTimeLeft(left time.Duration) {
+	sb.Synchronize(func() {
+		text := gotext.Get("%v left", util.FmtDuration(left))
+		sb.timeLeft.SetText(text)
+	})
+}
+
+// SetBuffer shows the fill level of the read-ahead buffer. Nothing is shown for the fragment that is not streamed
+func (sb *StatusBar) SetBuffer(streaming bool, level int) {
+	sb.Synchronize(func() {
+		var text string
+		if streaming {
+			text = gotext.Get("Buffer %d%%", level)
+		}
+		sb.buffer.SetText(text)
+	})
+}
@@ -0,0 +1,185 @@
+package loudness
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// Maximum level of the output signal
+	limiterCeiling = -1.0 // dBFS
+	// The gain is reduced in advance over this time before a peak
+	limiterLookahead = time.Millisecond * 5
+	// Time constant of gain recovery after a peak
+	limiterRelease = time.Millisecond * 100
+)
+
+// Limiter applies the gain to the 16-bit PCM data read from the source and reduces it where the peaks would exceed the ceiling.
+// The output is delayed by the look-ahead time, so the remaining data must be drained at the end of the stream.
+type Limiter struct {
+	src      io.Reader
+	channels int
+	gain     float64
+	ceiling  float64
+	release  float64
+	// Delay line of the gained frames
+	delay []float64
+	input []float64
+	// Gain values required by the frames in the delay line, for the sliding minimum
+	required []float64
+	// Smoothed gain values, for the moving average
+	envelopes []float64
+	envSum    float64
+	env       float64
+	pos       int
+	// Number of frames in the delay line that have not been output yet
+	pending  int
+	draining bool
+	flushing bool
+}
+
+func NewLimiter(src io.Reader, sampleRate, channels int) *Limiter {
+	size := int(time.Duration(sampleRate) * limiterLookahead / time.Second)
+	if size < 1 {
+		size = 1
+	}
+	l := &Limiter{
+		src:       src,
+		channels:  channels,
+		gain:      1,
+		ceiling:   math.Pow(10, limiterCeiling/20) * 32768,
+		release:   1 - math.Exp(-1/(limiterRelease.Seconds()*float64(sampleRate))),
+		delay:     make([]float64, size*channels),
+		input:     make([]float64, channels),
+		required:  make([]float64, size),
+		envelopes: make([]float64, size),
+	}
+	l.Reset()
+	return l
+}
+
+// SetGain sets the linear gain applied to the signal before limiting
+func (l *Limiter) SetGain(gain float64) {
+	l.gain = gain
+}
+
+// Reset discards the delayed data. Must be called after changing the position of the source
+func (l *Limiter) Reset() {
+	for i := range l.delay {
+		l.delay[i] = 0
+	}
+	for i := range l.required {
+		l.required[i] = 1
+		l.envelopes[i] = 1
+	}
+	l.envSum = float64(len(l.envelopes))
+	l.env = 1
+	l.pos = 0
+	l.pending = 0
+	l.draining = false
+	l.flushing = false
+}
+
+// Drain makes the limiter output the delayed data when the source reaches its end
+func (l *Limiter) Drain() {
+	l.draining = true
+}
+
+// push adds the frame to the delay line, or a silent frame if in is nil.
+// The frame leaving the delay line is written to out, if it is not nil.
+func (l *Limiter) push(in, out []byte) {
+	// The input is read first, since out may point to the same data
+	peak := 0.0
+	for ch := range l.input {
+		l.input[ch] = 0
+		if in != nil {
+			l.input[ch] = float64(int16(binary.LittleEndian.Uint16(in[ch*2:]))) * l.gain
+			peak = math.Max(peak, math.Abs(l.input[ch]))
+		}
+	}
+
+	frame := l.delay[l.pos*l.channels : (l.pos+1)*l.channels]
+	if out != nil {
+		g := l.envSum / float64(len(l.envelopes))
+		for ch, x := range frame {
+			x = math.Max(math.Min(x*g, math.MaxInt16), math.MinInt16)
+			binary.LittleEndian.PutUint16(out[ch*2:], uint16(int16(x)))
+		}
+	}
+
+	copy(frame, l.input)
+	required := 1.0
+	if peak > l.ceiling {
+		required = l.ceiling / peak
+	}
+	l.required[l.pos] = required
+
+	// Each frame leaving the delay line must be reduced by the minimum gain required in the whole delay line.
+	// The gain falls immediately and recovers slowly, and the moving average smooths its steps
+	target := 1.0
+	for _, r := range l.required {
+		target = math.Min(target, r)
+	}
+	if target < l.env {
+		l.env = target
+	} else {
+		l.env += (target - l.env) * l.release
+	}
+	l.envSum += l.env - l.envelopes[l.pos]
+	l.envelopes[l.pos] = l.env
+	l.pos = (l.pos + 1) % len(l.envelopes)
+}
+
+func (l *Limiter) Read(p []byte) (int, error) {
+	frameSize := l.channels * 2
+	size := len(l.envelopes)
+	p = p[:len(p)/frameSize*frameSize]
+	if len(p) == 0 {
+		return 0, io.ErrShortBuffer
+	}
+
+	for {
+		n, err := l.src.Read(p)
+		n = n / frameSize * frameSize
+		var w int
+		// Output is never ahead of input, so the data is processed in place
+		for r := 0; r < n; r += frameSize {
+			if l.pending < size {
+				l.push(p[r:r+frameSize], nil)
+				l.pending++
+				continue
+			}
+			l.push(p[r:r+frameSize], p[w:w+frameSize])
+			w += frameSize
+		}
+		if w > 0 {
+			return w, nil
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF || !l.draining || l.pending == 0 {
+			return 0, err
+		}
+
+		// The source has ended. Silence is pushed to get the delayed frames out
+		if !l.flushing {
+			// The oldest delayed frame must be at the output of the delay line
+			for i := l.pending; i < size; i++ {
+				l.push(nil, nil)
+			}
+			l.flushing = true
+		}
+		for w+frameSize <= len(p) && l.pending > 0 {
+			l.push(nil, p[w:w+frameSize])
+			l.pending--
+			w += frameSize
+		}
+		if l.pending == 0 {
+			l.Reset()
+		}
+		return w, nil
+	}
+}
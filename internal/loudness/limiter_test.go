@@ -0,0 +1,94 @@
+package loudness
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// sine returns the 16-bit PCM frames of a sine wave with the same signal in all channels
+func sine(frames, channels, sampleRate int, freq, amplitude float64) []byte {
+	data := make([]byte, frames*channels*2)
+	for i := 0; i < frames; i++ {
+		x := int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))
+		for ch := 0; ch < channels; ch++ {
+			binary.LittleEndian.PutUint16(data[(i*channels+ch)*2:], uint16(x))
+		}
+	}
+	return data
+}
+
+// readAll reads the limiter with the buffer of the specified size until the end of the stream
+func readAll(t *testing.T, l *Limiter, bufSize int) []byte {
+	t.Helper()
+	var out []byte
+	buf := make([]byte, bufSize)
+	for {
+		n, err := l.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	const sampleRate = 8000
+	ceiling := math.Pow(10, limiterCeiling/20) * 32768
+	lookahead := int(sampleRate * limiterLookahead.Seconds())
+	tests := []struct {
+		name      string
+		channels  int
+		frames    int
+		amplitude float64
+		gain      float64
+		drain     bool
+		bufSize   int
+	}{
+		{"quiet signal", 1, 4000, 10000, 1, true, 4096},
+		{"loud signal", 1, 4000, 30000, 1, true, 4096},
+		{"boosted signal", 2, 4000, 20000, 4, true, 4096},
+		{"boosted signal with a small buffer", 2, 4000, 20000, 4, true, 12},
+		{"stream shorter than the look-ahead", 2, lookahead / 2, 30000, 2, true, 4096},
+		{"without draining", 1, 4000, 30000, 2, false, 4096},
+	}
+	for _, tt := range tests {
+		in := sine(tt.frames, tt.channels, sampleRate, 440, tt.amplitude)
+		l := NewLimiter(bytes.NewReader(in), sampleRate, tt.channels)
+		l.SetGain(tt.gain)
+		if tt.drain {
+			l.Drain()
+		}
+		out := readAll(t, l, tt.bufSize)
+
+		wantFrames := tt.frames
+		if !tt.drain {
+			wantFrames -= lookahead
+		}
+		if got := len(out) / (tt.channels * 2); got != wantFrames {
+			t.Errorf("%v: got %d frames, want %d", tt.name, got, wantFrames)
+		}
+		for i := 0; i+1 < len(out); i += 2 {
+			if x := math.Abs(float64(int16(binary.LittleEndian.Uint16(out[i:])))); x > math.Ceil(ceiling) {
+				t.Errorf("%v: sample %d is %v, exceeds the ceiling %v", tt.name, i/2, x, ceiling)
+				break
+			}
+		}
+	}
+}
+
+func TestLimiterPassesQuietSignal(t *testing.T) {
+	const sampleRate = 8000
+	in := sine(1000, 1, sampleRate, 440, 10000)
+	l := NewLimiter(bytes.NewReader(in), sampleRate, 1)
+	l.Drain()
+	out := readAll(t, l, 4096)
+	if !bytes.Equal(out, in) {
+		t.Error("signal below the ceiling has been changed")
+	}
+}
@@ -0,0 +1,161 @@
+package loudness
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Parameters of the measurement according to ITU-R BS.1770 and EBU R128
+const (
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU
+	// Gating block is 400 ms, blocks overlap by 75%. Energy is accumulated by 100 ms steps
+	stepsPerBlock = 4
+	stepsPerSec   = 10
+)
+
+type filter struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *filter) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the two stages of the K-weighting filter for the specified sample rate
+func kWeighting(sampleRate int) (filter, filter) {
+	fs := float64(sampleRate)
+
+	// Stage 1 is a high shelf filter simulating the acoustic effect of the head
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := filter{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// Stage 2 is a high pass filter
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass := filter{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// Meter measures the integrated loudness of the 16-bit PCM data written to it
+type Meter struct {
+	channels    int
+	weight      float64
+	stepSize    int
+	shelf, hp   []filter
+	ch          int
+	stepSamples int
+	stepEnergy  float64
+	// Energies of the last steps, for assembling the overlapping blocks
+	steps []float64
+	// Mean square values of the blocks above the absolute gate
+	blocks []float64
+}
+
+func NewMeter(sampleRate, channels int) *Meter {
+	m := &Meter{
+		channels: channels,
+		weight:   1,
+		stepSize: sampleRate / stepsPerSec,
+		shelf:    make([]filter, channels),
+		hp:       make([]filter, channels),
+	}
+	if channels == 1 {
+		// Mono recordings are played through both speakers
+		m.weight = 2
+	}
+	for ch := 0; ch < channels; ch++ {
+		m.shelf[ch], m.hp[ch] = kWeighting(sampleRate)
+	}
+	return m
+}
+
+func (m *Meter) Write(p []byte) (int, error) {
+	for i := 0; i+1 < len(p); i += 2 {
+		x := float64(int16(binary.LittleEndian.Uint16(p[i:]))) / 32768
+		x = m.hp[m.ch].process(m.shelf[m.ch].process(x))
+		m.stepEnergy += x * x * m.weight
+		m.ch++
+		if m.ch < m.channels {
+			continue
+		}
+		m.ch = 0
+		m.stepSamples++
+		if m.stepSamples == m.stepSize {
+			m.addStep()
+		}
+	}
+	return len(p), nil
+}
+
+func (m *Meter) addStep() {
+	m.steps = append(m.steps, m.stepEnergy)
+	m.stepEnergy = 0
+	m.stepSamples = 0
+	if len(m.steps) < stepsPerBlock {
+		return
+	}
+	if len(m.steps) > stepsPerBlock {
+		m.steps = m.steps[1:]
+	}
+
+	var energy float64
+	for _, e := range m.steps {
+		energy += e
+	}
+	z := energy / float64(m.stepSize*stepsPerBlock)
+	if loudness(z) > absoluteGate {
+		m.blocks = append(m.blocks, z)
+	}
+}
+
+// Integrated returns the integrated loudness in LUFS. If there is not enough data or the data is silent, ok is false
+func (m *Meter) Integrated() (lufs float64, ok bool) {
+	if len(m.blocks) == 0 {
+		return 0, false
+	}
+
+	var sum float64
+	for _, z := range m.blocks {
+		sum += z
+	}
+	gate := loudness(sum/float64(len(m.blocks))) + relativeGate
+
+	var n int
+	sum = 0
+	for _, z := range m.blocks {
+		if loudness(z) > gate {
+			sum += z
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return loudness(sum / float64(n)), true
+}
+
+func loudness(z float64) float64 {
+	return -0.691 + 10*math.Log10(z)
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"net"
 	"os"
 	"path/filepath"
@@ -14,15 +14,20 @@ import (
 	"time"
 
 	"github.com/kvark128/OnlineLibrary/internal/books"
+	"github.com/kvark128/OnlineLibrary/internal/cache"
 	"github.com/kvark128/OnlineLibrary/internal/config"
 	"github.com/kvark128/OnlineLibrary/internal/connection"
 	"github.com/kvark128/OnlineLibrary/internal/content"
+	"github.com/kvark128/OnlineLibrary/internal/download"
+	"github.com/kvark128/OnlineLibrary/internal/equalizer"
 	"github.com/kvark128/OnlineLibrary/internal/gui"
 	"github.com/kvark128/OnlineLibrary/internal/gui/msg"
 	"github.com/kvark128/OnlineLibrary/internal/log"
 	"github.com/kvark128/OnlineLibrary/internal/player"
+	"github.com/kvark128/OnlineLibrary/internal/sink"
+	"github.com/kvark128/OnlineLibrary/internal/stats"
 	"github.com/kvark128/OnlineLibrary/internal/util"
-	"github.com/kvark128/OnlineLibrary/internal/util/buffer"
+	"github.com/kvark128/OnlineLibrary/internal/waveout"
 	"github.com/kvark128/dodp"
 	"github.com/leonelquinteros/gotext"
 
@@ -33,6 +38,10 @@ import (
 
 const (
 	CRLF = "\r\n"
+	// Time that is added to the pause timer by the extend command
+	timerExtension = time.Minute * 10
+	// Number of damaged fragments that are listed in the verification report
+	maxReportedDamages = 20
 )
 
 var (
@@ -56,14 +65,47 @@ type Manager struct {
 	questions     *dodp.Questions
 	userResponses []dodp.UserResponse
 	lastInputText string
+	stats         *stats.Statistics
+	downloads     *download.Queue
+	// Limiters of the download rate from all services and from each service by its ID
+	downloadLimiter *connection.Limiter
+	serviceLimiters map[string]*connection.Limiter
+	// Cache of streamed fragments. Nil if it could not be opened
+	cache *cache.Cache
 }
 
-func NewManager(mainWnd *gui.MainWnd, logger *log.Logger) *Manager {
-	return &Manager{mainWnd: mainWnd, logger: logger}
+// waveOutSink opens the audio device through the waveOut API
+func waveOutSink(channels, samplesPerSec, bitsPerSample, bufSize int, devName string) (player.AudioSink, error) {
+	wp, err := waveout.NewWavePlayer(channels, samplesPerSec, bitsPerSample, bufSize, devName)
+	if err != nil {
+		return nil, err
+	}
+	return wp, nil
+}
+
+// sinkFactory returns the factory of the audio sinks selected in the config. The null and wavefile sinks allow playback without an audio device
+func (m *Manager) sinkFactory(conf *config.Config) player.SinkFactory {
+	switch conf.General.AudioSink {
+	case "", "waveout":
+		return waveOutSink
+	case "null":
+		return sink.NullFactory
+	case "wavefile":
+		return sink.WaveFileFactory(filepath.Join(config.UserData(), config.WaveOutputDirName))
+	default:
+		m.logger.Warning("Unknown audio sink %q. The audio device is used", conf.General.AudioSink)
+		return waveOutSink
+	}
+}
+
+func NewManager(mainWnd *gui.MainWnd, logger *log.Logger, statistics *stats.Statistics, fragmentCache *cache.Cache) *Manager {
+	return &Manager{mainWnd: mainWnd, logger: logger, stats: statistics, cache: fragmentCache}
 }
 
 func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 	m.logger.Debug("Entering to Manager Loop")
+	m.setTimer(conf)
+	m.startDownloads(conf)
 	defer func() {
 		if p := recover(); p != nil {
 			buf := make([]byte, 4096)
@@ -72,6 +114,7 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 			os.Exit(1)
 		}
 		m.cleaning(conf)
+		m.downloads.Stop()
 		m.logger.Debug("Exiting from Manager Loop")
 		done <- true
 	}()
@@ -177,6 +220,7 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				break
 			}
 			conf.SetService(service)
+			m.setDownloadLimits(conf)
 			m.setProvider(provider, conf, service.ID)
 
 		case msg.LIBRARY_REMOVE:
@@ -231,6 +275,15 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				m.messageBoxError(fmt.Errorf("Downloading a book: %w", err))
 			}
 
+		case msg.VERIFY_BOOK:
+			if m.contentList == nil {
+				break
+			}
+			book := m.mainWnd.MainListBox().CurrentItem().(content.Item)
+			if err := m.verifyBook(conf, book); err != nil {
+				m.messageBoxError(fmt.Errorf("Verifying a book: %w", err))
+			}
+
 		case msg.BOOK_DESCRIPTION:
 			if m.contentList == nil {
 				break
@@ -285,6 +338,23 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				m.book.SetSpeed(value - player.STEP_SPEED)
 			}
 
+		case msg.PLAYER_PITCH_RESET:
+			if m.book != nil {
+				m.book.SetPitch(player.DEFAULT_PITCH)
+			}
+
+		case msg.PLAYER_PITCH_UP:
+			if m.book != nil {
+				value := m.book.Pitch()
+				m.book.SetPitch(value + player.STEP_PITCH)
+			}
+
+		case msg.PLAYER_PITCH_DOWN:
+			if m.book != nil {
+				value := m.book.Pitch()
+				m.book.SetPitch(value - player.STEP_PITCH)
+			}
+
 		case msg.PLAYER_VOLUME_RESET:
 			if m.book != nil {
 				m.book.SetVolume(player.DEFAULT_VOLUME)
@@ -309,8 +379,8 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				break
 			}
 			if m.book != nil {
-				pos := m.book.Position()
-				m.book.SetPosition(pos + offset)
+				pos := m.book.BookPosition()
+				m.book.SetBookPosition(pos + offset)
 			}
 
 		case msg.PLAYER_GOTO_FRAGMENT:
@@ -335,6 +405,39 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 			}
 			m.book.SetFragment(fragment)
 
+		case msg.PLAYER_OFFSET_CHAPTER:
+			offset, ok := message.Data.(int)
+			if !ok {
+				m.logger.Error("Invalid chapter offset")
+				break
+			}
+			if m.book != nil {
+				chapter := m.book.Chapter()
+				m.book.SetChapter(chapter + offset)
+			}
+
+		case msg.PLAYER_GOTO_CHAPTER:
+			if m.book == nil {
+				break
+			}
+			chapter, ok := message.Data.(int)
+			if !ok {
+				var text string
+				var err error
+				chapter = m.book.Chapter()
+				chapter++ // User needs a chapter number instead of an index
+				if gui.TextEntryDialog(m.mainWnd, gotext.Get("Go to chapter"), gotext.Get("Enter chapter number (1 to %v):", len(m.book.Chapters())), strconv.Itoa(chapter), &text) != gui.DlgCmdOK {
+					break
+				}
+				chapter, err = strconv.Atoi(text)
+				if err != nil {
+					m.logger.Error("Goto chapter: %v", err)
+					break
+				}
+				chapter-- // Player needs the chapter index instead of its number
+			}
+			m.book.SetChapter(chapter)
+
 		case msg.PLAYER_GOTO_POSITION:
 			if m.book == nil {
 				break
@@ -353,7 +456,34 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 					break
 				}
 			}
-			m.book.SetPosition(pos)
+			// A position beyond the fragment boundaries moves to the neighboring fragments
+			fragmentStart := m.book.BookPosition() - m.book.Position()
+			m.book.SetBookPosition(fragmentStart + pos)
+
+		case msg.PLAYER_GOTO_PERCENT:
+			if m.book == nil {
+				break
+			}
+			duration := m.book.BookDuration()
+			if duration == 0 {
+				m.logger.Warning("Goto percent: book duration is unknown")
+				break
+			}
+			percent, ok := message.Data.(int)
+			if !ok {
+				var text string
+				var err error
+				percent = int(m.book.BookPosition() * 100 / duration)
+				if gui.TextEntryDialog(m.mainWnd, gotext.Get("Go to percent"), gotext.Get("Enter percent of the book:"), strconv.Itoa(percent), &text) != gui.DlgCmdOK {
+					break
+				}
+				percent, err = strconv.Atoi(text)
+				if err != nil {
+					m.logger.Error("Goto percent: %v", err)
+					break
+				}
+			}
+			m.book.SetBookPosition(duration * time.Duration(percent) / 100)
 
 		case msg.PLAYER_OUTPUT_DEVICE:
 			device, ok := message.Data.(string)
@@ -368,11 +498,7 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 
 		case msg.PLAYER_SET_TIMER:
 			var text string
-			var d int
-			if m.book != nil {
-				d = int(m.book.TimerDuration().Minutes())
-			}
-
+			d := int(conf.General.PauseTimer.Minutes())
 			if gui.TextEntryDialog(m.mainWnd, gotext.Get("Setting the pause timer"), gotext.Get("Enter the timer value in minutes:"), strconv.Itoa(d), &text) != gui.DlgCmdOK {
 				break
 			}
@@ -382,12 +508,115 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				break
 			}
 
+			conf.General.PauseTimerMode = string(player.TimerModeDuration)
 			conf.General.PauseTimer = time.Minute * time.Duration(n)
-			m.mainWnd.MenuBar().SetPauseTimerLabel(n)
+			m.setTimer(conf)
+
+		case msg.PLAYER_SET_TIMER_CHAPTER_END:
+			conf.General.PauseTimerMode = string(player.TimerModeChapterEnd)
+			m.setTimer(conf)
+
+		case msg.PLAYER_SET_TIMER_CHAPTERS:
+			var text string
+			n := conf.General.PauseTimerChapters
+			if n <= 0 {
+				n = 1
+			}
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("Setting the pause timer"), gotext.Get("Enter the number of chapters to play:"), strconv.Itoa(n), &text) != gui.DlgCmdOK {
+				break
+			}
+
+			n, err := strconv.Atoi(text)
+			if err != nil || n <= 0 {
+				break
+			}
+
+			conf.General.PauseTimerMode = string(player.TimerModeChapters)
+			conf.General.PauseTimerChapters = n
+			m.setTimer(conf)
+
+		case msg.PLAYER_DISABLE_TIMER:
+			conf.General.PauseTimerMode = string(player.TimerModeDuration)
+			conf.General.PauseTimer = 0
+			m.setTimer(conf)
+
+		case msg.PLAYER_EXTEND_TIMER:
+			if m.book != nil {
+				m.book.ExtendTimer(timerExtension)
+			}
+
+		case msg.PLAYER_TIMER_FADE:
+			conf.General.PauseTimerFade = !conf.General.PauseTimerFade
+			m.setTimer(conf)
+
+		case msg.PLAYER_TIMER_EXPIRED:
+			if m.book == nil {
+				break
+			}
+			// The position where the listener fell asleep is kept in a bookmark
+			m.book.SetTimerBookmark(gotext.Get("Pause timer at %v", time.Now().Format("15:04")))
+			m.mainWnd.MenuBar().SetBookmarksMenu(m.book.Bookmarks())
+
+		case msg.PLAYER_SKIP_SILENCE:
+			var enabled bool
+			if m.book != nil {
+				enabled = !m.book.SkipSilence()
+				m.book.SetSkipSilence(enabled)
+			}
+			// The menu item is toggled by itself when triggered, so its state is always restored from the book
+			m.mainWnd.MenuBar().SetSkipSilenceChecked(enabled)
+
+		case msg.EQUALIZER_SET:
+			name, ok := message.Data.(string)
+			if !ok {
+				m.logger.Error("Invalid equalizer preset")
+				break
+			}
+			conf.General.Equalizer = name
+			if m.book != nil {
+				m.setEqualizer(conf, m.book)
+			}
+
+		case msg.EQUALIZER_SET_BOOK:
+			name, ok := message.Data.(string)
+			if !ok {
+				m.logger.Error("Invalid equalizer preset")
+				break
+			}
+			if m.book != nil {
+				m.book.SetEqualizerPreset(name)
+				m.setEqualizer(conf, m.book)
+			}
+
+		case msg.PLAYER_NORMALIZATION:
+			conf.General.Normalization = !conf.General.Normalization
+			m.mainWnd.MenuBar().SetNormalizationChecked(conf.General.Normalization)
 			if m.book != nil {
-				m.book.SetTimerDuration(conf.General.PauseTimer)
+				m.book.SetNormalization(conf.General.Normalization, conf.General.LoudnessTarget)
 			}
 
+		case msg.PLAYER_SMART_REWIND:
+			conf.General.SmartRewind = !conf.General.SmartRewind
+			m.mainWnd.MenuBar().SetSmartRewindChecked(conf.General.SmartRewind)
+			if m.book != nil {
+				m.book.SetRewindRules(rewindRules(conf))
+			}
+
+		case msg.PLAYER_TIME_INFO:
+			if m.book == nil {
+				break
+			}
+			var lines []string
+			lines = append(lines, gotext.Get("Fragment: %v of %v", util.FmtDuration(m.book.Position()), util.FmtDuration(m.book.FragmentDuration())))
+			lines = append(lines, gotext.Get("Book: %v of %v", util.FmtDuration(m.book.BookPosition()), util.FmtDuration(m.book.BookDuration())))
+			if chapters, chapter := m.book.Chapters(), m.book.Chapter(); chapter < len(chapters) && chapters[chapter].Title != "" {
+				lines = append(lines, gotext.Get("Chapter %v of %v: %v", chapter+1, len(chapters), chapters[chapter].Title))
+			}
+			lines = append(lines, gotext.Get("Time left at the current speed: %v", util.FmtDuration(m.book.TimeLeft())))
+			title := gotext.Get("Time information")
+			msg := strings.Join(lines, CRLF)
+			gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconInformation)
+
 		case msg.BOOKMARK_SET:
 			if m.book == nil {
 				// To set a bookmark, need a book
@@ -434,6 +663,105 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 				m.mainWnd.MenuBar().SetBookmarksMenu(m.book.Bookmarks())
 			}
 
+		case msg.LOOP_MARK_START:
+			if m.book != nil {
+				m.book.MarkLoopStart()
+			}
+
+		case msg.LOOP_MARK_END:
+			if m.book == nil {
+				break
+			}
+			if err := m.book.MarkLoopEnd(); err != nil {
+				var text string
+				switch err {
+				case player.LoopStartNotMarked:
+					text = gotext.Get("First mark the start of the loop.")
+				default:
+					text = gotext.Get("The end of the loop must be after its start.")
+				}
+				gui.MessageBox(m.mainWnd, gotext.Get("A-B loop"), text, gui.MsgBoxOK|gui.MsgBoxIconWarning)
+			}
+
+		case msg.LOOP_CANCEL:
+			if m.book != nil {
+				m.book.CancelLoop()
+			}
+
+		case msg.LOOP_SET_COUNT:
+			var text string
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("A-B loop"), gotext.Get("How many times to play the loop (0 means until it is cancelled):"), strconv.Itoa(conf.General.LoopCount), &text) != gui.DlgCmdOK {
+				break
+			}
+			n, err := strconv.Atoi(text)
+			if err != nil || n < 0 {
+				break
+			}
+			conf.General.LoopCount = n
+			if m.book != nil {
+				m.book.SetLoopRepeat(conf.General.LoopCount, conf.General.LoopPause)
+			}
+
+		case msg.LOOP_SET_PAUSE:
+			var text string
+			seconds := strconv.FormatFloat(conf.General.LoopPause.Seconds(), 'f', -1, 64)
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("A-B loop"), gotext.Get("Pause between repeats in seconds:"), seconds, &text) != gui.DlgCmdOK {
+				break
+			}
+			n, err := strconv.ParseFloat(text, 64)
+			if err != nil || n < 0 {
+				break
+			}
+			conf.General.LoopPause = time.Duration(n * float64(time.Second))
+			if m.book != nil {
+				m.book.SetLoopRepeat(conf.General.LoopCount, conf.General.LoopPause)
+			}
+
+		case msg.LOOP_SAVE:
+			if m.book == nil {
+				break
+			}
+			if _, ok := m.book.Loop(); !ok {
+				gui.MessageBox(m.mainWnd, gotext.Get("A-B loop"), gotext.Get("No loop is being played."), gui.MsgBoxOK|gui.MsgBoxIconWarning)
+				break
+			}
+			var name string
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("Saving the loop"), gotext.Get("Loop name:"), "", &name) != gui.DlgCmdOK {
+				break
+			}
+			if err := m.book.SaveLoop(name); err != nil {
+				m.logger.Warning("Saving loop: %v", err)
+			}
+			m.mainWnd.MenuBar().SetLoopsMenu(m.book.Loops())
+
+		case msg.LOOP_FETCH:
+			if m.book == nil {
+				break
+			}
+			if loopID, ok := message.Data.(string); ok {
+				if err := m.book.PlayLoop(loopID); err != nil {
+					m.logger.Warning("Loop fetching: %v", err)
+				}
+			}
+
+		case msg.LOOP_REMOVE:
+			if m.book == nil {
+				break
+			}
+			if loopID, ok := message.Data.(string); ok {
+				loop, err := m.book.SavedLoop(loopID)
+				if err != nil {
+					m.logger.Warning("Loop removing: %v", err)
+					break
+				}
+				msg := gotext.Get("Are you sure you want to delete the loop \"%v\"?", loop.Name)
+				if gui.MessageBox(m.mainWnd, gotext.Get("Deleting a loop"), msg, gui.MsgBoxYesNo|gui.MsgBoxIconQuestion) != gui.DlgCmdYes {
+					break
+				}
+				m.book.RemoveLoop(loopID)
+				m.mainWnd.MenuBar().SetLoopsMenu(m.book.Loops())
+			}
+
 		case msg.LOG_SET_LEVEL:
 			level, ok := message.Data.(log.Level)
 			if !ok {
@@ -463,6 +791,53 @@ func (m *Manager) Start(conf *config.Config, done chan<- bool) {
 			msg := strings.Join(lines, CRLF)
 			gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconInformation)
 
+		case msg.DOWNLOADS_SHOW:
+			m.showDownloads()
+
+		case msg.STATISTICS_SHOW:
+			title := gotext.Get("Listening statistics")
+			if gui.StatisticsDialog(m.mainWnd, title, m.statisticsReport()) != gui.DlgCmdOK {
+				break
+			}
+			path := filepath.Join(config.UserData(), "statistics.csv")
+			if gui.SaveFileDialog(m.mainWnd, gotext.Get("Export statistics"), gotext.Get("CSV files (*.csv)|*.csv"), &path) != gui.DlgCmdOK {
+				break
+			}
+			if err := m.exportStatistics(path); err != nil {
+				m.messageBoxError(fmt.Errorf("Exporting statistics: %w", err))
+			}
+
+		case msg.DOWNLOAD_SET_RATE:
+			var text string
+			rate := strconv.FormatInt(conf.General.DownloadRate, 10)
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("Download speed limit"), gotext.Get("Maximum download speed in KB/s (0 means no limit):"), rate, &text) != gui.DlgCmdOK {
+				break
+			}
+			n, err := strconv.ParseInt(text, 10, 64)
+			if err != nil || n < 0 {
+				break
+			}
+			conf.General.DownloadRate = n
+			m.setDownloadLimits(conf)
+
+		case msg.CACHE_SET_LIMIT:
+			var text string
+			limit := strconv.FormatInt(conf.CacheLimit()/1024/1024, 10)
+			if gui.TextEntryDialog(m.mainWnd, gotext.Get("Fragments cache"), gotext.Get("Maximum size of the cache in megabytes (0 turns the cache off):"), limit, &text) != gui.DlgCmdOK {
+				break
+			}
+			n, err := strconv.ParseInt(text, 10, 64)
+			if err != nil || n < 0 {
+				break
+			}
+			conf.General.CacheLimit = n
+			if n == 0 {
+				conf.General.CacheLimit = -1
+			}
+			if m.cache != nil {
+				m.cache.SetLimit(conf.CacheLimit())
+			}
+
 		case msg.SET_LANGUAGE:
 			lang, ok := message.Data.(string)
 			if !ok {
@@ -636,21 +1011,72 @@ func (m *Manager) updateContentList(contentList *content.List) {
 	m.mainWnd.MenuBar().SetBookMenuEnabled(true)
 }
 
+// statusBarObserver shows the playback state in the status bar
+func statusBarObserver(sb *gui.StatusBar) player.ObserverFunc {
+	return func(e player.Event) {
+		switch e.Type {
+		case player.EventFragmentChanged, player.EventPosition:
+			sb.SetElapsedTime(e.State.Position)
+			sb.SetTotalTime(e.State.FragmentDuration)
+			sb.SetFragments(e.State.Fragment+1, e.State.Fragments)
+			sb.SetBookPercent(e.State.BookPercent)
+			sb.SetTimeLeft(e.State.TimeLeft)
+			sb.SetBuffer(e.State.Streaming, e.State.Buffered)
+		}
+	}
+}
+
+// playbackObserver records the listening statistics of the book and passes the timer expiry to the main loop
+func (m *Manager) playbackObserver(id, title string) player.ObserverFunc {
+	return func(e player.Event) {
+		var percent float64
+		if e.State.BookDuration > 0 {
+			percent = float64(e.State.BookPosition) * 100 / float64(e.State.BookDuration)
+		}
+		switch e.Type {
+		case player.EventStarted:
+			m.stats.Start(id, title, e.State.Speed, percent)
+		case player.EventPaused, player.EventStopped, player.EventFinished, player.EventError:
+			m.stats.Stop(e.State.Speed, percent)
+			// The history must not be lost if the program does not exit cleanly
+			path := filepath.Join(config.UserData(), config.StatisticsFile)
+			if err := m.stats.Save(path); err != nil {
+				m.logger.Error("Saving statistics file: %v", err)
+			}
+		case player.EventTimerExpired:
+			m.mainWnd.MsgChan() <- msg.Message{Code: msg.PLAYER_TIMER_EXPIRED}
+		}
+	}
+}
+
 func (m *Manager) setBook(conf *config.Config, contentItem content.Item) error {
 	if m.book != nil {
 		m.book.Pause(true)
 	}
 
 	if contentItem != nil {
-		book, err := books.NewBook(conf.General.OutputDevice, contentItem, m.logger, m.mainWnd.StatusBar())
+		book, err := books.NewBook(conf.General.OutputDevice, m.sinkFactory(conf), contentItem, rewindRules(conf), m.logger)
 		if err != nil {
 			return err
 		}
 		defer func() {
-			book.SetTimerDuration(conf.General.PauseTimer)
+			book.SetTimer(pauseTimer(conf))
+			book.SetCache(m.cache)
+			book.SetReadAhead(conf.ReadAhead())
+			book.SetLimiters(m.streamingLimiters(conf)...)
+			book.SetTransport(m.bookTransport())
+			book.AddObserver(statusBarObserver(m.mainWnd.StatusBar()))
+			book.AddObserver(m.playbackObserver(book.ID(), book.Title))
 			book.SetVolume(conf.General.Volume)
+			book.SetSilenceParams(conf.General.SilenceThreshold, conf.General.SilenceMinPause)
+			book.SetNormalization(conf.General.Normalization, conf.General.LoudnessTarget)
+			m.mainWnd.MenuBar().SetSkipSilenceChecked(book.SkipSilence())
+			m.mainWnd.MenuBar().SetBookEqualizerMenu(book.EqualizerPreset())
+			m.setEqualizer(conf, book)
 			m.mainWnd.SetTitle(book.Title)
 			m.mainWnd.MenuBar().SetBookmarksMenu(book.Bookmarks())
+			book.SetLoopRepeat(conf.General.LoopCount, conf.General.LoopPause)
+			m.mainWnd.MenuBar().SetLoopsMenu(book.Loops())
 			m.book = book
 			m.logger.Debug("Set book: %v", book.ID())
 		}()
@@ -662,13 +1088,127 @@ func (m *Manager) setBook(conf *config.Config, contentItem content.Item) error {
 		m.book.Stop()
 		m.mainWnd.SetTitle("")
 		m.mainWnd.MenuBar().SetBookmarksMenu(nil)
+		m.mainWnd.MenuBar().SetLoopsMenu(nil)
+		m.mainWnd.MenuBar().SetSkipSilenceChecked(false)
+		m.mainWnd.MenuBar().SetBookEqualizerMenu("")
 		m.book = nil
 	}
 	return nil
 }
 
+// statisticsReport returns the summary of the listening history
+func (m *Manager) statisticsReport() string {
+	days := m.stats.Days()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var total, lastDay, lastWeek, lastMonth time.Duration
+	for _, d := range days {
+		total += d.Listened
+		if !d.Date.Before(today) {
+			lastDay += d.Listened
+		}
+		if !d.Date.Before(today.AddDate(0, 0, -6)) {
+			lastWeek += d.Listened
+		}
+		if !d.Date.Before(today.AddDate(0, 0, -29)) {
+			lastMonth += d.Listened
+		}
+	}
+
+	var lines []string
+	lines = append(lines, gotext.Get("Total listening time: %v", util.FmtDuration(total)))
+	lines = append(lines, gotext.Get("Today: %v", util.FmtDuration(lastDay)))
+	lines = append(lines, gotext.Get("Last 7 days: %v", util.FmtDuration(lastWeek)))
+	lines = append(lines, gotext.Get("Last 30 days: %v", util.FmtDuration(lastMonth)))
+
+	lines = append(lines, "", gotext.Get("Books:"))
+	for _, b := range m.stats.Books() {
+		lines = append(lines, gotext.Get("%v: %v in %v sessions, average speed %.1f, read %.0f%%", b.Title, util.FmtDuration(b.Listened), b.Sessions, b.Speed, b.Percent))
+	}
+
+	lines = append(lines, "", gotext.Get("Days:"))
+	for _, d := range days {
+		lines = append(lines, gotext.Get("%v: %v in %v sessions", d.Date.Format("2006-01-02"), util.FmtDuration(d.Listened), d.Sessions))
+	}
+	return strings.Join(lines, CRLF)
+}
+
+func (m *Manager) exportStatistics(path string) error {
+	f, err := util.CreateSecureFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.stats.WriteCSV(f); err != nil {
+		f.Corrupted()
+		return err
+	}
+	return nil
+}
+
+// pauseTimer returns the settings of the pause timer from the configuration
+func pauseTimer(conf *config.Config) player.Timer {
+	return player.Timer{
+		Mode:     player.TimerMode(conf.General.PauseTimerMode),
+		Duration: conf.General.PauseTimer,
+		Chapters: conf.General.PauseTimerChapters,
+		Fade:     conf.General.PauseTimerFade,
+	}
+}
+
+// rewindRules returns the rules of the smart rewind from the configuration, or nil if it is disabled
+func rewindRules(conf *config.Config) []player.RewindRule {
+	if !conf.General.SmartRewind {
+		return nil
+	}
+	if len(conf.General.RewindRules) == 0 {
+		return player.DefaultRewindRules
+	}
+	rules := make([]player.RewindRule, len(conf.General.RewindRules))
+	for i, r := range conf.General.RewindRules {
+		rules[i] = player.RewindRule(r)
+	}
+	return rules
+}
+
+// setTimer applies the settings of the pause timer from the configuration to the menu and the current book
+func (m *Manager) setTimer(conf *config.Config) {
+	timer := pauseTimer(conf)
+	label := gotext.Get("Pause timer (no)")
+	if timer.Enabled() {
+		switch timer.Mode {
+		case player.TimerModeChapterEnd:
+			label = gotext.Get("Pause timer (end of chapter)")
+		case player.TimerModeChapters:
+			label = gotext.Get("Pause timer (%d chapters)", timer.Chapters)
+		default:
+			label = gotext.Get("Pause timer (%d min.)", int(timer.Duration.Minutes()))
+		}
+	}
+	m.mainWnd.MenuBar().SetPauseTimerLabel(label)
+	m.mainWnd.MenuBar().SetTimerFadeChecked(timer.Fade)
+	if m.book != nil {
+		m.book.SetTimer(timer)
+	}
+}
+
+// setEqualizer applies the equalizer preset of the book, or the global preset if the book has no own one
+func (m *Manager) setEqualizer(conf *config.Config, book *books.Book) {
+	name := book.EqualizerPreset()
+	if name == "" {
+		name = conf.General.Equalizer
+	}
+	bands := equalizer.Preset(name)
+	if name == equalizer.User {
+		bands = conf.General.UserEqualizer
+	}
+	book.SetEqualizer(bands)
+	m.logger.Debug("Set equalizer preset: %v", name)
+}
+
 func (m *Manager) downloadBook(book content.Item) error {
-	if _, ok := m.provider.(*library.Library); !ok {
+	lib, ok := m.provider.(*library.Library)
+	if !ok {
 		return OperationNotSupported
 	}
 
@@ -694,95 +1234,328 @@ func (m *Manager) downloadBook(book content.Item) error {
 		}
 	}
 
-	dlFunc := func(rsrc []dodp.Resource, dir string, id string) {
-		var err error
-		var totalSize, downloadedSize int64
-		ctx, cancelFunc := context.WithCancel(context.TODO())
-		dlg := gui.NewProgressDialog(m.mainWnd, gotext.Get("Book downloading"), gotext.Get("Downloading \"%v\"\nSpeed: %d KB/s", name, 0), 100, cancelFunc)
-		dlg.Run()
-
-		for _, r := range rsrc {
-			totalSize += r.Size
-		}
-
-		m.logger.Debug("Downloading book %v started", id)
-		for _, r := range rsrc {
-			err = func() error {
-				path := filepath.Join(dir, r.LocalURI)
-				if util.FileIsExist(path, r.Size) {
-					// This fragment already exists on disk
-					downloadedSize += r.Size
-					dlg.SetValue(int(downloadedSize / (totalSize / 100)))
-					return nil
-				}
+	mf := &content.Manifest{ServiceID: lib.Service().ID, ContentID: book.ID(), Resources: rsrc}
+	if err := mf.Save(dir); err != nil {
+		m.logger.Error("Saving manifest file: %v", err)
+	}
 
-				conn, err := connection.NewConnectionWithContext(ctx, r.URI, m.logger)
-				if err != nil {
-					return err
-				}
-				defer conn.Close()
+	m.downloads.Add(download.NewJob(book.ID(), lib.Service().ID, name, dir, rsrc))
+	title := gotext.Get("Information")
+	msg := gotext.Get("Book added to the download queue")
+	gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconInformation)
+	return nil
+}
 
-				dst, err := util.CreateSecureFile(path)
-				if err != nil {
-					return err
-				}
-				defer dst.Close()
-
-				var fragmentSize int64
-				var src io.Reader = buffer.NewReader(conn)
-				for err == nil {
-					var n int64
-					t := time.Now()
-					n, err = io.CopyN(dst, src, 512*1024)
-					sec := time.Since(t).Seconds()
-					speed := int(float64(n) / 1024 / sec)
-					dlg.SetLabel(gotext.Get("Downloading \"%v\"\nSpeed: %d KB/s", name, speed))
-					downloadedSize += n
-					fragmentSize += n
-					dlg.SetValue(int(downloadedSize / (totalSize / 100)))
-				}
+// verifyBook checks the downloaded resources of the book. Damaged resources of a book from the library or of a local book with the manifest are downloaded again
+func (m *Manager) verifyBook(conf *config.Config, book content.Item) error {
+	name, err := book.Name()
+	if err != nil {
+		return err
+	}
 
-				if err == io.EOF {
-					err = nil
-				}
+	var dir string
+	if locator, ok := book.(content.Locator); ok {
+		dir = locator.Dir()
+	} else if dir, err = config.BookDir(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return errors.New(gotext.Get("The book has not been downloaded"))
+	}
 
-				if err == nil && r.Size != fragmentSize {
-					err = errors.New("resource size mismatch")
-				}
+	// The files are checked against the saved manifest, so the book can be verified even if it is no longer issued.
+	// Without the manifest, the resources of the library book can only be received while the book is issued
+	var rsrc []dodp.Resource
+	// Damaged resources are downloaded from the service and under the ID of the library book
+	var serviceID, contentID string
+	mf, err := content.ReadManifest(dir)
+	if err == nil {
+		rsrc, serviceID, contentID = mf.Resources, mf.ServiceID, mf.ContentID
+	} else if rsrc, err = book.Resources(); err != nil {
+		return err
+	}
 
+	// The URIs of the manifest may have expired, so the current ones are requested from the service before the repair
+	var serviceName string
+	var current func(rsrc []dodp.Resource) ([]dodp.Resource, error)
+	if lib, ok := m.provider.(*library.Library); ok {
+		serviceID, contentID, serviceName = lib.Service().ID, book.ID(), lib.Service().Name
+		if mf != nil {
+			current = func(rsrc []dodp.Resource) ([]dodp.Resource, error) {
+				r, err := lib.GetContentResources(contentID)
 				if err != nil {
-					dst.Corrupted()
+					return nil, err
 				}
-				return err
-			}()
-
-			if err != nil {
-				break
+				return matchResources(r.Resources, rsrc)
 			}
 		}
+	} else if serviceID != "" {
+		service, err := conf.ServiceByID(serviceID)
+		if err != nil {
+			m.logger.Warning("Verifying %v: service %v: %v", book.ID(), serviceID, err)
+			serviceID = ""
+		} else {
+			serviceName = service.Name
+			current = func(rsrc []dodp.Resource) ([]dodp.Resource, error) {
+				return m.currentResources(conf, service, contentID, rsrc)
+			}
+		}
+	}
 
+	verifyFunc := func() {
+		ctx, cancelFunc := context.WithCancel(context.TODO())
+		dlg := gui.NewProgressDialog(m.mainWnd, gotext.Get("Book verification"), gotext.Get("Verifying \"%v\"", name), len(rsrc), cancelFunc)
+		dlg.Run()
+		damages, err := download.Verify(ctx, rsrc, dir, func(checked, total int) { dlg.SetValue(checked) })
 		dlg.Cancel()
 
 		switch {
 		case errors.Is(err, context.Canceled):
 			title := gotext.Get("Warning")
-			msg := gotext.Get("Download canceled by user")
-			gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
-		case err != nil:
-			gui.MessageBox(m.mainWnd, gotext.Get("Error"), err.Error(), gui.MsgBoxOK|gui.MsgBoxIconError)
-		default:
-			title := gotext.Get("Warning")
-			msg := gotext.Get("Book successfully downloaded")
+			msg := gotext.Get("Verification canceled by user")
 			gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
-			m.logger.Debug("Book %v has been successfully downloaded. Total size: %v", id, totalSize)
+			return
+		case len(damages) == 0:
+			title := gotext.Get("Information")
+			msg := gotext.Get("No damaged fragments found")
+			gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconInformation)
+			return
+		}
+
+		bad := make([]dodp.Resource, len(damages))
+		lines := make([]string, 0, len(damages))
+		for i, d := range damages {
+			m.logger.Warning("Verifying %v: %v: %v", book.ID(), d.Resource.LocalURI, d.Err)
+			bad[i] = d.Resource
+			if i < maxReportedDamages {
+				lines = append(lines, fmt.Sprintf("%v: %v", d.Resource.LocalURI, d.Err))
+			}
+		}
+		if len(damages) > maxReportedDamages {
+			lines = append(lines, gotext.Get("and %d more", len(damages)-maxReportedDamages))
+		}
+		msg := gotext.Get("Damaged fragments found: %d", len(damages)) + CRLF + strings.Join(lines, CRLF) + CRLF + CRLF
+
+		if serviceID == "" {
+			msg += gotext.Get("Download the book from the library again to repair it.")
+			gui.MessageBox(m.mainWnd, gotext.Get("Warning"), msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
+			return
+		}
+
+		if current != nil {
+			if bad, err = current(bad); err != nil {
+				m.logger.Error("Verifying %v: %v", book.ID(), err)
+				msg += gotext.Get("The book is no longer issued in the library \"%v\". Issue it again and repeat the verification to repair it.", serviceName)
+				gui.MessageBox(m.mainWnd, gotext.Get("Warning"), msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
+				return
+			}
+		}
+
+		for _, r := range bad {
+			// A file of the right size would be taken for a downloaded resource
+			if err := os.Remove(filepath.Join(dir, r.LocalURI)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				m.logger.Error("Removing damaged fragment: %v", err)
+			}
+		}
+		m.downloads.Add(download.NewJob(contentID, serviceID, name, dir, bad))
+		msg += gotext.Get("Damaged fragments added to the download queue.")
+		gui.MessageBox(m.mainWnd, gotext.Get("Warning"), msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
+	}
+
+	// Book verification should not block handling of other messages
+	go verifyFunc()
+	return nil
+}
+
+// currentResources returns the resources with the URIs currently given by the service for the book.
+// An error is returned if the service does not give the resources, for example, when the book is no longer issued
+func (m *Manager) currentResources(conf *config.Config, service *config.Service, contentID string, rsrc []dodp.Resource) ([]dodp.Resource, error) {
+	lib, err := library.NewLibrary(conf, service)
+	if err != nil {
+		return nil, err
+	}
+	defer lib.Terminate()
+	r, err := lib.GetContentResources(contentID)
+	if err != nil {
+		return nil, err
+	}
+	return matchResources(r.Resources, rsrc)
+}
+
+// matchResources returns the resources from the current list of the service that have the same local URIs as rsrc, in the same order
+func matchResources(list, rsrc []dodp.Resource) ([]dodp.Resource, error) {
+	current := make(map[string]dodp.Resource, len(list))
+	for _, cr := range list {
+		current[cr.LocalURI] = cr
+	}
+	result := make([]dodp.Resource, len(rsrc))
+	for i, res := range rsrc {
+		cr, ok := current[res.LocalURI]
+		if !ok {
+			return nil, fmt.Errorf("%v: %w", res.LocalURI, download.ResourceMissing)
+		}
+		result[i] = cr
+	}
+	return result, nil
+}
+
+// startDownloads restores the download queue from the previous session and resumes it
+func (m *Manager) startDownloads(conf *config.Config) {
+	path := filepath.Join(config.UserData(), config.DownloadsFile)
+	downloader := download.New(conf.General.DownloadWorkers, m.logger)
+	m.downloads = download.NewQueue(path, downloader, conf.General.DownloadBooks, m.logger)
+	if err := m.downloads.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		m.logger.Error("Loading download queue: %v", err)
+	}
+	m.downloads.SetCallbacks(nil, m.downloadFinished)
+	m.setDownloadLimits(conf)
+	m.downloads.Start()
+}
+
+// setDownloadLimits applies the rate limits, the download windows and the transports of the services from the config to the download queue
+func (m *Manager) setDownloadLimits(conf *config.Config) {
+	if m.downloadLimiter == nil {
+		m.downloadLimiter = connection.NewLimiter(0)
+	}
+	m.downloadLimiter.SetRate(conf.General.DownloadRate * 1024)
+	schedule, err := download.ParseSchedule(conf.General.DownloadWindows)
+	if err != nil {
+		m.logger.Error("Download schedule: %v", err)
+	}
+	global := download.Limits{Limiter: m.downloadLimiter, Schedule: schedule}
+
+	m.serviceLimiters = make(map[string]*connection.Limiter)
+	services := make(map[string]download.Limits)
+	transports := make(map[string]*connection.Transport)
+	// The resources are requested by the workers of the queue, so they get the copies of the accounts
+	accounts := make(map[string]config.Service)
+	for _, srv := range conf.Services {
+		accounts[srv.ID] = *srv
+		transport, err := connection.ServiceTransport(srv)
+		if err != nil {
+			m.logger.Error("Transport of service %v: %v", srv.Name, err)
+		}
+		transports[srv.ID] = transport
+
+		schedule, err := download.ParseSchedule(srv.DownloadWindows)
+		if err != nil {
+			m.logger.Error("Download schedule of service %v: %v", srv.Name, err)
+		}
+		limits := download.Limits{Schedule: schedule}
+		if srv.DownloadRate > 0 {
+			limits.Limiter = connection.NewLimiter(srv.DownloadRate * 1024)
+			m.serviceLimiters[srv.ID] = limits.Limiter
 		}
+		services[srv.ID] = limits
 	}
+	m.downloads.SetLimits(global, services)
+	m.downloads.SetTransports(transports)
+	m.downloads.SetResolver(func(id, serviceID string, rsrc []dodp.Resource) ([]dodp.Resource, error) {
+		service, ok := accounts[serviceID]
+		if !ok {
+			return nil, config.ServiceNotFound
+		}
+		return m.currentResources(conf, &service, id, rsrc)
+	})
+}
 
-	// Book downloading should not block handling of other messages
-	go dlFunc(rsrc, dir, book.ID())
+// bookTransport returns the transport through which the fragments of the book are streamed. Nil means the default transport
+func (m *Manager) bookTransport() *connection.Transport {
+	if lib, ok := m.provider.(*library.Library); ok {
+		return lib.Transport()
+	}
 	return nil
 }
 
+// streamingLimiters returns the limiters of the download rate that apply to streaming from the current provider
+func (m *Manager) streamingLimiters(conf *config.Config) []*connection.Limiter {
+	if !conf.General.LimitStreaming {
+		return nil
+	}
+	limiters := []*connection.Limiter{m.downloadLimiter}
+	if lib, ok := m.provider.(*library.Library); ok {
+		if l := m.serviceLimiters[lib.Service().ID]; l != nil {
+			limiters = append(limiters, l)
+		}
+	}
+	return limiters
+}
+
+// downloadFinished reports the end of downloading the book. It is called by the download queue
+func (m *Manager) downloadFinished(job download.Job, err error) {
+	if err != nil {
+		gui.MessageBox(m.mainWnd, gotext.Get("Error"), gotext.Get("Downloading \"%v\": %v", job.Title, err), gui.MsgBoxOK|gui.MsgBoxIconError)
+		return
+	}
+	m.logger.Debug("Book %v has been successfully downloaded. Total size: %v", job.ID, job.Progress.Total)
+	if m.cache != nil {
+		// The downloaded book belongs to the user, so the cache must not remove its fragments
+		m.cache.Forget(job.Dir)
+	}
+	title := gotext.Get("Warning")
+	msg := gotext.Get("Book \"%v\" successfully downloaded", job.Title)
+	gui.MessageBox(m.mainWnd, title, msg, gui.MsgBoxOK|gui.MsgBoxIconWarning)
+}
+
+// showDownloads opens the dialog with the download queue, which is updated while the downloads are running
+func (m *Manager) showDownloads() {
+	dlg := gui.NewDownloadsDialog(m.mainWnd, gotext.Get("Downloads"), func(a gui.DownloadAction, id string) {
+		var err error
+		switch a {
+		case gui.DownloadPauseResume:
+			for _, job := range m.downloads.List() {
+				if job.ID != id {
+					continue
+				}
+				if job.State == download.JobPaused || job.State == download.JobFailed {
+					err = m.downloads.Resume(id)
+				} else {
+					err = m.downloads.Pause(id)
+				}
+			}
+		case gui.DownloadMoveUp:
+			err = m.downloads.Move(id, -1)
+		case gui.DownloadMoveDown:
+			err = m.downloads.Move(id, 1)
+		case gui.DownloadCancel:
+			err = m.downloads.Cancel(id)
+		}
+		if err != nil {
+			m.logger.Warning("Download %v: %v", id, err)
+		}
+	})
+	update := func() {
+		dlg.SetItems(m.downloadItems(m.downloads.List()))
+	}
+	m.downloads.SetChangeCallback(update)
+	update()
+	dlg.Run()
+	m.downloads.SetChangeCallback(nil)
+}
+
+// downloadItems returns the lines of the downloads list
+func (m *Manager) downloadItems(jobs []download.Job) []gui.DownloadItem {
+	items := make([]gui.DownloadItem, len(jobs))
+	for i, job := range jobs {
+		var state string
+		switch job.State {
+		case download.JobQueued:
+			state = gotext.Get("queued")
+			if !m.downloads.Allowed(job) {
+				state = gotext.Get("waiting for the download window")
+			}
+		case download.JobRunning:
+			state = gotext.Get("%d%%, %d KB/s", job.Progress.Percent(), job.Progress.Speed/1024)
+		case download.JobPaused:
+			state = gotext.Get("paused")
+		case download.JobFailed:
+			state = gotext.Get("failed: %v", job.Err)
+		}
+		items[i] = gui.DownloadItem{ID: job.ID, Label: fmt.Sprintf("%v (%v)", job.Title, state)}
+	}
+	return items
+}
+
 func (m *Manager) removeBook(book content.Item) error {
 	returner, ok := book.(content.Returner)
 	if !ok {
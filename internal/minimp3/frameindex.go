@@ -0,0 +1,451 @@
+package minimp3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// With a full scan, a seek point is stored for every scanStep frames. The remaining frames are decoded and discarded when seeking
+const scanStep = 16
+
+// The maximum number of bytes to search for the first frame after the ID3v2 tag
+const maxSyncSearch = 1024 * 64
+
+var (
+	ErrNoFrames = errors.New("no mp3 frames found")
+)
+
+var bitrates = [2][3][16]int{
+	// MPEG 1: layer I, II, III
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// MPEG 2 and 2.5: layer I, II, III
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var sampleRates = [3]int{44100, 48000, 32000}
+
+// frameHeader describes a single mpeg audio frame
+type frameHeader struct {
+	mpeg1      bool
+	layer      int
+	sampleRate int
+	channels   int
+	size       int
+	samples    int
+	bitrate    int
+}
+
+// parseFrameHeader parses 4 bytes of the mpeg audio frame header
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	var h frameHeader
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, false
+	}
+
+	version := (b[1] >> 3) & 3 // 0: MPEG 2.5, 2: MPEG 2, 3: MPEG 1
+	layerBits := (b[1] >> 1) & 3
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 3
+	padding := int((b[2] >> 1) & 1)
+	if version == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return h, false
+	}
+
+	h.mpeg1 = version == 3
+	h.layer = 4 - int(layerBits)
+	h.sampleRate = sampleRates[sampleRateIndex]
+	switch version {
+	case 2:
+		h.sampleRate /= 2
+	case 0:
+		h.sampleRate /= 4
+	}
+	h.channels = 2
+	if b[3]>>6 == 3 {
+		h.channels = 1
+	}
+
+	table := 1
+	if h.mpeg1 {
+		table = 0
+	}
+	bitrate := bitrates[table][h.layer-1][bitrateIndex] * 1000
+	h.bitrate = bitrate
+
+	switch {
+	case h.layer == 1:
+		h.samples = 384
+		h.size = (12*bitrate/h.sampleRate + padding) * 4
+	case h.layer == 3 && !h.mpeg1:
+		h.samples = 576
+		h.size = 72*bitrate/h.sampleRate + padding
+	default:
+		h.samples = 1152
+		h.size = 144*bitrate/h.sampleRate + padding
+	}
+	return h, true
+}
+
+// averageFrameSize returns the average size of the frames with the parameters of the header.
+// Padded frames are one slot longer, and the encoder pads them so that the average size equals the exact value without rounding
+func averageFrameSize(h frameHeader) float64 {
+	return float64(h.samples) / 8 * float64(h.bitrate) / float64(h.sampleRate)
+}
+
+// syncFrame skips the data before the next frame that is followed by another frame with the same parameters.
+// Returns the header of the frame and the number of skipped bytes
+func syncFrame(r *bufio.Reader) (frameHeader, int64, error) {
+	for i := int64(0); i < maxSyncSearch; i++ {
+		b, err := r.Peek(4)
+		if err != nil {
+			return frameHeader{}, i, ErrNoFrames
+		}
+		if h, ok := parseFrameHeader(b); ok {
+			if next, err := r.Peek(h.size + 4); err == nil {
+				if h2, ok := parseFrameHeader(next[h.size:]); ok && h2.sampleRate == h.sampleRate && h2.layer == h.layer {
+					return h, i, nil
+				}
+			}
+		}
+		r.Discard(1)
+	}
+	return frameHeader{}, maxSyncSearch, ErrNoFrames
+}
+
+// id3v2Size returns the full size of the ID3v2 tag with the specified header, or 0 if there is no tag
+func id3v2Size(b []byte) int64 {
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(b[6]&0x7f)<<21 | int64(b[7]&0x7f)<<14 | int64(b[8]&0x7f)<<7 | int64(b[9]&0x7f)
+	size += 10
+	if b[5]&0x10 != 0 {
+		// The tag has a footer
+		size += 10
+	}
+	return size
+}
+
+type seekPoint struct {
+	sample int64
+	offset int64
+}
+
+// FrameIndex maps the position in the decoded audio to the offset of the mp3 frame in the source.
+// An index is built once for the resource and can be reused by all decoders of the same resource
+type FrameIndex struct {
+	sampleRate      int
+	channels        int
+	samplesPerFrame int
+	totalSamples    int64
+	// Offset of the first frame in the source
+	dataStart int64
+	// Average size of the frame. Used for files without a table of contents
+	frameSize float64
+	// Known positions of frames, sorted by the sample number
+	points []seekPoint
+	// The points are found by the full scan, so they point exactly to the frames with the specified samples
+	exact bool
+}
+
+// NewFrameIndex builds an index of the mp3 source of the specified size.
+// If fullScan is true, all frame headers of the source are read and the index is exact.
+// Otherwise the index is built from the Xing or VBRI table of contents, and for files without it the constant bitrate is assumed.
+func NewFrameIndex(src io.ReadSeeker, size int64, fullScan bool) (*FrameIndex, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReaderSize(src, 1024*64)
+
+	var pos int64
+	if b, err := r.Peek(10); err == nil {
+		if tagSize := id3v2Size(b); tagSize > 0 {
+			n, err := r.Discard(int(tagSize))
+			pos += int64(n)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	first, skipped, err := syncFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	pos += skipped
+
+	idx := &FrameIndex{
+		sampleRate:      first.sampleRate,
+		channels:        first.channels,
+		samplesPerFrame: first.samples,
+		dataStart:       pos,
+	}
+
+	frame, err := r.Peek(first.size)
+	if err != nil {
+		return nil, err
+	}
+
+	if fullScan {
+		if err := idx.scan(r, pos); err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+
+	if idx.parseVBRI(frame) || idx.parseXing(frame, first) {
+		return idx, nil
+	}
+
+	// There is no table of contents. We consider the file as a file with a constant bitrate
+	idx.frameSize = averageFrameSize(first)
+	frames := int64(float64(size-idx.dataStart) / idx.frameSize)
+	idx.totalSamples = frames * int64(idx.samplesPerFrame)
+	return idx, nil
+}
+
+// scan reads all frame headers of the stream starting with the frame at offset pos
+func (idx *FrameIndex) scan(r *bufio.Reader, pos int64) error {
+	var frames int64
+	for {
+		b, err := r.Peek(4)
+		if err != nil {
+			break
+		}
+		h, ok := parseFrameHeader(b)
+		if !ok || h.sampleRate != idx.sampleRate {
+			// The end of audio data or a damaged frame. Trying to find the next frame
+			if string(b[:3]) == "TAG" {
+				break
+			}
+			if _, err := r.Discard(1); err != nil {
+				break
+			}
+			pos++
+			continue
+		}
+		if frames%scanStep == 0 {
+			idx.points = append(idx.points, seekPoint{sample: idx.totalSamples, offset: pos})
+		}
+		n, err := r.Discard(h.size)
+		pos += int64(n)
+		if err != nil {
+			break
+		}
+		frames++
+		idx.totalSamples += int64(h.samples)
+	}
+
+	if frames == 0 {
+		return ErrNoFrames
+	}
+	idx.exact = true
+	return nil
+}
+
+// parseXing reads the table of contents from the Xing or Info header in the first frame
+func (idx *FrameIndex) parseXing(frame []byte, h frameHeader) bool {
+	// The Xing header is located after the side information
+	offset := 4 + 17
+	switch {
+	case h.mpeg1 && h.channels == 2:
+		offset = 4 + 32
+	case !h.mpeg1 && h.channels == 1:
+		offset = 4 + 9
+	}
+	if len(frame) < offset+8 {
+		return false
+	}
+	tag := string(frame[offset : offset+4])
+	if tag != "Xing" && tag != "Info" {
+		return false
+	}
+
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	data := frame[offset+8:]
+	var frames, nBytes int64
+	if flags&1 != 0 && len(data) >= 4 {
+		frames = int64(binary.BigEndian.Uint32(data))
+		data = data[4:]
+	}
+	if flags&2 != 0 && len(data) >= 4 {
+		nBytes = int64(binary.BigEndian.Uint32(data))
+		data = data[4:]
+	}
+	if frames == 0 {
+		return false
+	}
+
+	// The header frame itself is decoded as a silent frame, so it is also counted
+	idx.totalSamples = (frames + 1) * int64(idx.samplesPerFrame)
+	idx.points = []seekPoint{{sample: 0, offset: idx.dataStart}}
+	if flags&4 != 0 && len(data) >= 100 && nBytes > 0 {
+		for i := 1; i < 100; i++ {
+			idx.points = append(idx.points, seekPoint{
+				sample: idx.totalSamples * int64(i) / 100,
+				offset: idx.dataStart + int64(data[i])*nBytes/256,
+			})
+		}
+	} else if nBytes > 0 {
+		idx.frameSize = float64(nBytes) / float64(frames+1)
+		idx.points = nil
+	} else {
+		idx.frameSize = averageFrameSize(h)
+		idx.points = nil
+	}
+	return true
+}
+
+// parseVBRI reads the table of contents from the VBRI header in the first frame
+func (idx *FrameIndex) parseVBRI(frame []byte) bool {
+	const offset = 4 + 32
+	if len(frame) < offset+26 || !bytes.Equal(frame[offset:offset+4], []byte("VBRI")) {
+		return false
+	}
+	h := frame[offset:]
+	frames := int64(binary.BigEndian.Uint32(h[14:]))
+	entries := int(binary.BigEndian.Uint16(h[18:]))
+	scale := int64(binary.BigEndian.Uint16(h[20:]))
+	entrySize := int(binary.BigEndian.Uint16(h[22:]))
+	framesPerEntry := int64(binary.BigEndian.Uint16(h[24:]))
+	if frames == 0 || entrySize < 1 || entrySize > 4 || len(h) < 26+entries*entrySize {
+		return false
+	}
+
+	idx.totalSamples = (frames + 1) * int64(idx.samplesPerFrame)
+	idx.points = []seekPoint{{sample: 0, offset: idx.dataStart}}
+	offset64 := idx.dataStart
+	table := h[26:]
+	for i := 0; i < entries; i++ {
+		var v int64
+		for _, b := range table[i*entrySize : (i+1)*entrySize] {
+			v = v<<8 | int64(b)
+		}
+		offset64 += v * scale
+		idx.points = append(idx.points, seekPoint{
+			sample: int64(i+1) * framesPerEntry * int64(idx.samplesPerFrame),
+			offset: offset64,
+		})
+	}
+	return true
+}
+
+// locate returns the offset of the frame from which decoding must be started to get the specified sample, and the number of the first sample of this frame.
+// One extra frame before the required one is taken into account, since its data may be needed by the bit reservoir.
+// The offset always points to a frame header found in the source. The frame is exact if the index was built by the full scan or the bitrate is constant.
+// The table of contents of the Xing or VBRI header only gives the positions of its entries, so with it the frame is found at the nearest entry
+// and the number of its first sample is approximate
+func (idx *FrameIndex) locate(src io.ReadSeeker, sample int64) (int64, int64, error) {
+	if sample < 0 {
+		sample = 0
+	}
+	spf := int64(idx.samplesPerFrame)
+	target := sample - spf
+	if target < 0 {
+		target = 0
+	}
+
+	if idx.points != nil {
+		i := sort.Search(len(idx.points), func(i int) bool { return idx.points[i].sample > target }) - 1
+		if i < 0 {
+			i = 0
+		}
+		p := idx.points[i]
+		if idx.exact {
+			return p.offset, p.sample, nil
+		}
+		offset, _, err := idx.syncAt(src, p.offset)
+		if err == ErrNoFrames {
+			return p.offset, p.sample, nil
+		}
+		return offset, p.sample, err
+	}
+
+	// The frame is computed by the average size. The search of the header starts two frames earlier, so it does not skip the required frame
+	frame := target / spf
+	start := idx.dataStart + int64(float64(frame-2)*idx.frameSize)
+	if start < idx.dataStart {
+		start = idx.dataStart
+	}
+	pos, r, err := idx.syncAt(src, start)
+	if err == ErrNoFrames {
+		return idx.dataStart + int64(float64(frame)*idx.frameSize), frame * spf, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Stepping forward by the real sizes of the frames to the required one
+	n := int64(math.Round(float64(pos-idx.dataStart) / idx.frameSize))
+	for n < frame {
+		b, err := r.Peek(4)
+		if err != nil {
+			break
+		}
+		h, ok := parseFrameHeader(b)
+		if !ok {
+			break
+		}
+		next, err := r.Peek(h.size + 4)
+		if err != nil {
+			break
+		}
+		if _, ok := parseFrameHeader(next[h.size:]); !ok {
+			break
+		}
+		r.Discard(h.size)
+		pos += int64(h.size)
+		n++
+	}
+	return pos, n * spf, nil
+}
+
+// syncAt finds the first frame at or after the offset. Returns the offset of the frame and the reader positioned at it
+func (idx *FrameIndex) syncAt(src io.ReadSeeker, offset int64) (int64, *bufio.Reader, error) {
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	r := bufio.NewReaderSize(src, 1024*64)
+	_, skipped, err := syncFrame(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return offset + skipped, r, nil
+}
+
+// SampleRate returns the sample rate of the indexed stream
+func (idx *FrameIndex) SampleRate() int {
+	return idx.sampleRate
+}
+
+// Channels returns the number of channels of the indexed stream
+func (idx *FrameIndex) Channels() int {
+	return idx.channels
+}
+
+// Samples returns the total number of samples per channel in the indexed stream
+func (idx *FrameIndex) Samples() int64 {
+	return idx.totalSamples
+}
+
+// Duration returns the total duration of the indexed stream
+func (idx *FrameIndex) Duration() time.Duration {
+	if idx.sampleRate == 0 {
+		return 0
+	}
+	return time.Duration(idx.totalSamples) * time.Second / time.Duration(idx.sampleRate)
+}
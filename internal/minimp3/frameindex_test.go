@@ -0,0 +1,48 @@
+package minimp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// cbrStream builds a stream of MPEG-1 layer III frames of 128 kbps at 44100 Hz, padded the way encoders do.
+// The payload of each frame holds its number. Returns the stream and the offsets of the frames
+func cbrStream(frames int) ([]byte, []int64) {
+	var buf bytes.Buffer
+	var offsets []int64
+	const exact = 144.0 * 128000 / 44100
+	var total float64
+	for i := 0; i < frames; i++ {
+		size := int(total+exact) - int(total)
+		total += exact
+		padding := size - 417
+		offsets = append(offsets, int64(buf.Len()))
+		frame := make([]byte, size)
+		frame[0], frame[1], frame[2], frame[3] = 0xff, 0xfb, 0x90|byte(padding<<1), 0x64
+		binary.BigEndian.PutUint32(frame[4:], uint32(i))
+		buf.Write(frame)
+	}
+	return buf.Bytes(), offsets
+}
+
+func TestLocateCBR(t *testing.T) {
+	data, offsets := cbrStream(20000)
+	idx, err := NewFrameIndex(bytes.NewReader(data), int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.points != nil {
+		t.Fatal("the stream without a table of contents must be indexed by the average frame size")
+	}
+	for _, frame := range []int64{0, 1, 2, 3, 100, 5000, 12345, 19998} {
+		// The frame before the required one is decoded as well
+		offset, sample, err := idx.locate(bytes.NewReader(data), (frame+1)*1152+10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != offsets[frame] || sample != frame*1152 {
+			t.Errorf("frame %d: got offset %d and sample %d, want %d and %d", frame, offset, sample, offsets[frame], frame*1152)
+		}
+	}
+}
@@ -20,6 +20,19 @@ type Decoder struct {
 	lastError            error
 	decode               C.mp3dec_t
 	info                 C.mp3dec_frame_info_t
+	// Number of bytes read from the source since its beginning
+	sourcePos int64
+	// Position of the decoded audio data returned by Read
+	pcmPos int64
+	// After seeking, the samples of the stream before skipTo are discarded. frameSample is the number of the first sample of the next decoded frame
+	skipTo      int64
+	frameSample int64
+	tagChecked  bool
+	// Number of bytes of the source that are not part of any frame
+	skipped    int64
+	sourceSize int64
+	fullScan   bool
+	index      *FrameIndex
 }
 
 // NewDecoder creates and returns a new mp3 decoder with the default internal buffer size.
@@ -38,75 +51,201 @@ func NewDecoder(source io.Reader) *Decoder {
 // If the internal buffer is empty, then Read first tries to read mp3 data from the source and decode it.
 // If len(p) == 0, then Read will return zero bytes, but if the internal buffer is empty, then before that it will still try to decode one frame and fill the internal buffer.
 func (d *Decoder) Read(p []byte) (int, error) {
+	if !d.tagChecked {
+		d.tagChecked = true
+		if err := d.skipID3v2(); err != nil {
+			return 0, err
+		}
+	}
+
 	for d.pcmLength == 0 {
 		// If possible, fill the mp3 buffer completely
 		for d.mp3Length < len(d.mp3) && d.lastError == nil {
 			n, err := d.source.Read(d.mp3[d.mp3Length:])
 			d.mp3Length += n
+			d.sourcePos += int64(n)
 			d.lastError = err
 		}
 
+		// minimp3 does not update the offset of the frame if no frame has been found
+		d.info.frame_offset = -1
 		samples := C.mp3dec_decode_frame(&d.decode,
 			(*C.uint8_t)(unsafe.Pointer(&d.mp3[0])), C.int(d.mp3Length),
 			(*C.mp3d_sample_t)(unsafe.Pointer(&d.pcm[0])), &d.info,
 		)
 
 		if d.info.frame_bytes == 0 {
+			if d.lastError == io.EOF {
+				// The rest of the source is an incomplete frame
+				d.skipped += int64(d.mp3Length)
+				d.mp3Length = 0
+			}
 			return 0, d.lastError
 		}
 
+		if d.info.frame_offset < 0 {
+			d.skipped += int64(d.info.frame_bytes)
+		} else {
+			d.skipped += int64(d.info.frame_offset)
+		}
+
 		d.mp3Length = copy(d.mp3, d.mp3[d.info.frame_bytes:d.mp3Length])
 		d.pcmLength = int(samples * d.info.channels * C.sizeof_short)
+
+		if d.skipTo > d.frameSample {
+			// Audio data before the seek position must be dropped
+			frameSamples := int64(samples)
+			if frameSamples == 0 && d.index != nil {
+				// The first frame after seeking only fills the bit reservoir and gives no samples, but it still takes its place in the stream
+				frameSamples = int64(d.index.samplesPerFrame)
+			}
+			drop := d.skipTo - d.frameSample
+			if drop > int64(samples) {
+				drop = int64(samples)
+			}
+			n := int(drop) * int(d.info.channels) * C.sizeof_short
+			copy(d.pcm, d.pcm[n:d.pcmLength])
+			d.pcmLength -= n
+			d.frameSample += frameSamples
+		}
 	}
 
 	n := copy(p, d.pcm[:d.pcmLength])
 	// If there is any data left in the pcm buffer, then move it to the beginning of the buffer
 	copy(d.pcm, d.pcm[n:d.pcmLength])
 	d.pcmLength -= n
+	d.pcmPos += int64(n)
 	return n, nil
 }
 
+// skipID3v2 skips the ID3v2 tag at the beginning of the source, so it cannot be mistaken for audio data
+func (d *Decoder) skipID3v2() error {
+	header := make([]byte, 10)
+	n, err := io.ReadFull(d.source, header)
+	d.sourcePos += int64(n)
+	if err != nil {
+		// The source is too short for the tag. Its data will be processed by the decoder
+		d.mp3Length = copy(d.mp3, header[:n])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		d.lastError = err
+		return nil
+	}
+
+	tagSize := id3v2Size(header)
+	if tagSize == 0 {
+		d.mp3Length = copy(d.mp3, header)
+		return nil
+	}
+
+	skipped, err := io.CopyN(io.Discard, d.source, tagSize-int64(len(header)))
+	d.sourcePos += skipped
+	if err != nil {
+		d.lastError = err
+	}
+	return nil
+}
+
+// SetSourceInfo sets the size of the mp3 source and allows to read the whole source to build an exact frame index.
+// A full scan should only be allowed for local sources, since it requires reading all the data
+func (d *Decoder) SetSourceInfo(size int64, fullScan bool) {
+	d.sourceSize = size
+	d.fullScan = fullScan
+}
+
+// SetFrameIndex sets the frame index that was previously built for the same source
+func (d *Decoder) SetFrameIndex(index *FrameIndex) {
+	d.index = index
+}
+
+// FrameIndex returns the frame index of the source. If the index does not exist yet, it will be built.
+// The source must support the io.Seeker interface.
+func (d *Decoder) FrameIndex() (*FrameIndex, error) {
+	if d.index != nil {
+		return d.index, nil
+	}
+
+	seeker, ok := d.source.(io.ReadSeeker)
+	if !ok {
+		return nil, errors.New("source is not seeker")
+	}
+
+	index, err := NewFrameIndex(seeker, d.sourceSize, d.fullScan)
+	// Building the index changes the position of the source. It must be restored
+	if _, e := seeker.Seek(d.sourcePos, io.SeekStart); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.index = index
+	return d.index, nil
+}
+
+// CachedFrameIndex returns the frame index if it has already been built, or nil otherwise
+func (d *Decoder) CachedFrameIndex() *FrameIndex {
+	return d.index
+}
+
 // Seek sets a new position for reading audio data.
-// At least one decoded frame is required to set a new position.
-// If there are no decoded frames, then Seek will return an error.
-// The mp3 data source must support the io.Seeker interface.
-// If the source doesn't support io.Seeker, then Seek will panic.
+// The position is set exactly to the requested sample using the frame index of the source.
+// If the index has not been built yet, it will be built on the first call.
+// The mp3 data source must support the io.Seeker interface. Otherwise Seek will return an error.
 func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
-	seeker, ok := d.source.(io.Seeker)
+	seeker, ok := d.source.(io.ReadSeeker)
 	if !ok {
-		panic("minimp3: d.source is not seeker")
+		return 0, errors.New("source is not seeker")
 	}
 
-	mp3BytesPerMsec := int64(d.info.bitrate_kbps) / 8
-	pcmBytesPerMsec := int64(d.info.channels*C.sizeof_short*d.info.hz) / 1000
-
-	if mp3BytesPerMsec == 0 || pcmBytesPerMsec == 0 {
-		// There is no information about audio data. Probably not a single frame has been decoded yet
-		return 0, errors.New("no frame available")
+	index, err := d.FrameIndex()
+	if err != nil {
+		return 0, err
 	}
 
-	var mp3Offset int64
-	if whence == io.SeekCurrent {
-		// If seeking is performed from the current position, then be aware of buffered audio data
-		offset -= int64(d.pcmLength)
-		mp3Offset = offset / pcmBytesPerMsec * mp3BytesPerMsec
-		mp3Offset -= int64(d.mp3Length)
-	} else {
-		// If seeking is performed from the beginning or the end, then the buffered data does not matter
-		mp3Offset = offset / pcmBytesPerMsec * mp3BytesPerMsec
+	sampleSize := int64(index.channels * C.sizeof_short)
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = d.pcmPos + offset
+	case io.SeekEnd:
+		pos = index.totalSamples*sampleSize + offset
+	default:
+		return 0, errors.New("invalid whence")
 	}
+	if pos < 0 {
+		pos = 0
+	}
+	sample := pos / sampleSize
 
 	// Internal buffers must always be cleared, regardless of the result of calling the Seek method
 	d.mp3Length = 0
 	d.pcmLength = 0
+	d.lastError = nil
+	d.tagChecked = true
+	C.mp3dec_init(&d.decode)
 
-	mp3Pos, err := seeker.Seek(mp3Offset, whence)
+	// Finding the frame reads the source
+	frameOffset, frameSample, err := index.locate(seeker, sample)
 	if err != nil {
+		d.lastError = err
 		return 0, err
 	}
 
-	pcmPos := mp3Pos / mp3BytesPerMsec * pcmBytesPerMsec
-	return pcmPos, nil
+	if _, err := seeker.Seek(frameOffset, io.SeekStart); err != nil {
+		d.lastError = err
+		return 0, err
+	}
+	d.sourcePos = frameOffset
+
+	// Samples between the beginning of the frame and the requested position will be decoded and discarded.
+	// They are counted by the frames, since the frame that primes the bit reservoir gives no samples
+	d.frameSample = frameSample
+	d.skipTo = sample
+	d.pcmPos = sample * sampleSize
+	return d.pcmPos, nil
 }
 
 // SampleRate returns the sample rate of the last decoded frame.
@@ -126,3 +265,9 @@ func (d *Decoder) Channels() int {
 func (d *Decoder) Bitrate() int {
 	return int(d.info.bitrate_kbps)
 }
+
+// Skipped returns the number of bytes of the source that were skipped because they are not part of any mp3 frame.
+// This includes damaged frames and the incomplete frame at the end of a truncated stream.
+func (d *Decoder) Skipped() int64 {
+	return d.skipped
+}
@@ -0,0 +1,657 @@
+// Package mp4 reads the audio track and chapters of mp4 files (m4a, m4b)
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// The object type of the AAC audio in the decoder config descriptor
+const objectTypeAAC = 0x40
+
+var (
+	ErrNoAudioTrack = errors.New("mp4 file has no aac audio track")
+	errInvalidBox   = errors.New("invalid mp4 box")
+)
+
+// Chapter is a named part of the audio track
+type Chapter struct {
+	Title string
+	Start time.Duration
+}
+
+type chunk struct {
+	offset      int64
+	firstSample int
+}
+
+type timeRun struct {
+	count int
+	delta int64
+}
+
+// Movie describes the audio track of an mp4 file.
+// Edit lists (the elst box) and the priming samples of the encoder are not applied, so the times of the samples, chapters and seek positions
+// are measured from the first decoded sample and are later than the presentation times by the decoder delay (usually 1024 or 2112 samples)
+type Movie struct {
+	// Config is the AudioSpecificConfig of the AAC stream
+	Config     []byte
+	SampleRate int
+	Channels   int
+	// Timescale is the number of time units of the track per second
+	Timescale int64
+	Chapters  []Chapter
+	// Title is the title of the movie from its tags
+	Title string
+	// Number of samples and their size, if all samples have the same size. Otherwise the sizes are in the table
+	count       int
+	defaultSize uint32
+	sizes       []uint32
+	chunks      []chunk
+	times       []timeRun
+}
+
+type track struct {
+	id        uint32
+	handler   string
+	timescale int64
+	chapterID uint32
+	config    []byte
+	channels  int
+	rate      int
+	stbl      stbl
+}
+
+// stbl contains the raw sample tables of the track
+type stbl struct {
+	stsz, stsc, stco, stts []byte
+	co64                   bool
+}
+
+// box is the header of an mp4 box with the data that follows it
+type box struct {
+	typ  string
+	data []byte
+}
+
+// boxes splits the contents of a box into child boxes
+func boxes(b []byte) ([]box, error) {
+	var list []box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errInvalidBox
+		}
+		size := uint64(binary.BigEndian.Uint32(b))
+		typ := string(b[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return nil, errInvalidBox
+			}
+			size = binary.BigEndian.Uint64(b[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(b)) {
+			return nil, errInvalidBox
+		}
+		list = append(list, box{typ, b[header:size]})
+		b = b[size:]
+	}
+	return list, nil
+}
+
+func child(b []byte, path ...string) []byte {
+	for _, typ := range path {
+		list, err := boxes(b)
+		if err != nil {
+			return nil
+		}
+		b = nil
+		for _, bx := range list {
+			if bx.typ == typ {
+				b = bx.data
+				break
+			}
+		}
+		if b == nil {
+			return nil
+		}
+	}
+	return b
+}
+
+// readMoov finds the moov box at the top level of the file and reads it into memory.
+// The moov box can be located after the media data, so the media data is skipped by seeking
+func readMoov(r io.ReadSeeker, size int64) ([]byte, error) {
+	var pos int64
+	header := make([]byte, 16)
+	for size <= 0 || pos < size {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, errors.New("mp4 file has no moov box")
+			}
+			return nil, err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		headerSize := int64(8)
+		if boxSize == 1 {
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		typ := string(header[4:8])
+		if boxSize == 0 && size > 0 {
+			boxSize = size - pos
+		}
+		if boxSize < headerSize {
+			return nil, errInvalidBox
+		}
+		if typ == "moov" {
+			// The sample tables of very long books take a few megabytes
+			if boxSize > 256<<20 || (size > 0 && boxSize > size-pos) {
+				return nil, errors.New("mp4 moov box is too large")
+			}
+			moov := make([]byte, boxSize-headerSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return nil, err
+			}
+			return moov, nil
+		}
+		pos += boxSize
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("mp4 file has no moov box")
+}
+
+// Parse reads the description of the first AAC audio track and the chapters of the file.
+// The size of the file may be unknown
+func Parse(r io.ReadSeeker, size int64) (*Movie, error) {
+	moov, err := readMoov(r, size)
+	if err != nil {
+		return nil, err
+	}
+	list, err := boxes(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*track
+	var udta []byte
+	for _, bx := range list {
+		switch bx.typ {
+		case "trak":
+			tracks = append(tracks, parseTrack(bx.data))
+		case "udta":
+			udta = bx.data
+		}
+	}
+
+	var audio *track
+	for _, t := range tracks {
+		if t.handler == "soun" && t.config != nil {
+			audio = t
+			break
+		}
+	}
+	if audio == nil {
+		return nil, ErrNoAudioTrack
+	}
+
+	m := &Movie{
+		Config:     audio.config,
+		SampleRate: audio.rate,
+		Channels:   audio.channels,
+		Timescale:  audio.timescale,
+	}
+	if rate, channels := parseAudioConfig(audio.config); rate != 0 {
+		m.SampleRate = rate
+		if channels != 0 {
+			m.Channels = channels
+		}
+	}
+	if m.Timescale == 0 || m.SampleRate == 0 || m.Channels == 0 {
+		return nil, errors.New("invalid mp4 audio track")
+	}
+	if err := m.buildTables(&audio.stbl, size); err != nil {
+		return nil, err
+	}
+
+	// Nero chapters take precedence over the QuickTime chapter track, because they do not require reading the media data
+	m.Chapters = parseNeroChapters(child(udta, "chpl"))
+	if m.Chapters == nil && audio.chapterID != 0 {
+		for _, t := range tracks {
+			if t.id == audio.chapterID {
+				m.Chapters, err = readTextTrack(r, size, t)
+				if err != nil {
+					return nil, fmt.Errorf("reading chapter track: %w", err)
+				}
+				break
+			}
+		}
+	}
+	m.Title = parseTitle(udta)
+	return m, nil
+}
+
+func parseTrack(b []byte) *track {
+	t := &track{}
+	if tkhd := child(b, "tkhd"); len(tkhd) >= 24 {
+		if tkhd[0] == 1 {
+			if len(tkhd) >= 32 {
+				t.id = binary.BigEndian.Uint32(tkhd[20:])
+			}
+		} else {
+			t.id = binary.BigEndian.Uint32(tkhd[12:])
+		}
+	}
+	if chap := child(b, "tref", "chap"); len(chap) >= 4 {
+		t.chapterID = binary.BigEndian.Uint32(chap)
+	}
+	if mdhd := child(b, "mdia", "mdhd"); len(mdhd) >= 24 {
+		if mdhd[0] == 1 {
+			if len(mdhd) >= 32 {
+				t.timescale = int64(binary.BigEndian.Uint32(mdhd[20:]))
+			}
+		} else {
+			t.timescale = int64(binary.BigEndian.Uint32(mdhd[12:]))
+		}
+	}
+	if hdlr := child(b, "mdia", "hdlr"); len(hdlr) >= 12 {
+		t.handler = string(hdlr[8:12])
+	}
+
+	stblBox := child(b, "mdia", "minf", "stbl")
+	if stblBox == nil {
+		return t
+	}
+	t.stbl.stsz = child(stblBox, "stsz")
+	t.stbl.stsc = child(stblBox, "stsc")
+	t.stbl.stts = child(stblBox, "stts")
+	t.stbl.stco = child(stblBox, "stco")
+	if t.stbl.stco == nil {
+		t.stbl.stco = child(stblBox, "co64")
+		t.stbl.co64 = true
+	}
+	if t.handler == "soun" {
+		t.parseSampleDescription(child(stblBox, "stsd"))
+	}
+	return t
+}
+
+// parseSampleDescription finds the AAC sample entry and its decoder config
+func (t *track) parseSampleDescription(stsd []byte) {
+	if len(stsd) < 8 {
+		return
+	}
+	entries, err := boxes(stsd[8:])
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.typ != "mp4a" || len(e.data) < 28 {
+			continue
+		}
+		// The version of the QuickTime sound description determines the size of the entry
+		skip := 28
+		switch binary.BigEndian.Uint16(e.data[8:]) {
+		case 1:
+			skip += 16
+		case 2:
+			skip += 36
+		}
+		if len(e.data) < skip {
+			continue
+		}
+		t.channels = int(binary.BigEndian.Uint16(e.data[16:]))
+		t.rate = int(binary.BigEndian.Uint32(e.data[24:]) >> 16)
+		esds := child(e.data[skip:], "esds")
+		if esds == nil {
+			esds = child(e.data[skip:], "wave", "esds")
+		}
+		if len(esds) > 4 {
+			t.config = parseESDescriptor(esds[4:])
+		}
+		if t.config != nil {
+			return
+		}
+	}
+}
+
+// descriptor reads the tag and contents of the MPEG-4 descriptor
+func descriptor(b []byte) (tag byte, data, rest []byte, ok bool) {
+	if len(b) < 2 {
+		return 0, nil, nil, false
+	}
+	tag = b[0]
+	size := 0
+	i := 1
+	for ; i < len(b) && i <= 4; i++ {
+		size = size<<7 | int(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			break
+		}
+	}
+	i++
+	if i+size > len(b) {
+		return 0, nil, nil, false
+	}
+	return tag, b[i : i+size], b[i+size:], true
+}
+
+// parseESDescriptor returns the AudioSpecificConfig from the elementary stream descriptor
+func parseESDescriptor(b []byte) []byte {
+	tag, es, _, ok := descriptor(b)
+	if !ok || tag != 0x03 || len(es) < 3 {
+		return nil
+	}
+	flags := es[2]
+	es = es[3:]
+	if flags&0x80 != 0 && len(es) >= 2 {
+		es = es[2:]
+	}
+	if flags&0x40 != 0 && len(es) >= 1+int(es[0]) {
+		es = es[1+int(es[0]):]
+	}
+	if flags&0x20 != 0 && len(es) >= 2 {
+		es = es[2:]
+	}
+	for len(es) > 0 {
+		tag, data, rest, ok := descriptor(es)
+		if !ok {
+			return nil
+		}
+		es = rest
+		if tag != 0x04 || len(data) < 13 || data[0] != objectTypeAAC {
+			continue
+		}
+		for data = data[13:]; len(data) > 0; {
+			tag, info, rest, ok := descriptor(data)
+			if !ok {
+				return nil
+			}
+			if tag == 0x05 && len(info) >= 2 {
+				return info
+			}
+			data = rest
+		}
+	}
+	return nil
+}
+
+var aacSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseAudioConfig returns the sample rate and the number of channels of the core AAC stream
+func parseAudioConfig(config []byte) (rate, channels int) {
+	var bits uint64
+	for i := 0; i < 8; i++ {
+		bits <<= 8
+		if i < len(config) {
+			bits |= uint64(config[i])
+		}
+	}
+	read := func(n int) int {
+		v := int(bits >> (64 - n))
+		bits <<= n
+		return v
+	}
+	if read(5) == 31 {
+		read(6)
+	}
+	if index := read(4); index == 15 {
+		rate = read(24)
+	} else if index < len(aacSampleRates) {
+		rate = aacSampleRates[index]
+	}
+	channels = read(4)
+	// Channel configuration 7 is the 7.1 layout
+	if channels == 7 {
+		channels = 8
+	}
+	return rate, channels
+}
+
+// fits reports whether the box contains the specified number of entries of the size after the header.
+// The counts are taken from the file, so they are checked before anything is allocated by them
+func fits(b []byte, header int, count, entrySize uint32) bool {
+	return len(b) >= header && uint64(len(b)-header) >= uint64(count)*uint64(entrySize)
+}
+
+// buildTables converts the sample tables of the track into the form convenient for finding samples. The size of the file limits the number of samples
+func (m *Movie) buildTables(t *stbl, size int64) error {
+	if len(t.stsz) < 12 || len(t.stsc) < 8 || len(t.stco) < 8 || len(t.stts) < 8 {
+		return errors.New("mp4 audio track has no sample tables")
+	}
+
+	// Sample sizes. The table is made only if the sizes differ, and then it is limited by the size of the box
+	m.defaultSize = binary.BigEndian.Uint32(t.stsz[4:])
+	count := binary.BigEndian.Uint32(t.stsz[8:])
+	if m.defaultSize == 0 {
+		if !fits(t.stsz, 12, count, 4) {
+			return errors.New("invalid mp4 stsz box")
+		}
+		m.sizes = make([]uint32, count)
+		for i := range m.sizes {
+			m.sizes[i] = binary.BigEndian.Uint32(t.stsz[12+i*4:])
+		}
+	} else if size > 0 && uint64(count)*uint64(m.defaultSize) > uint64(size) {
+		return errors.New("invalid mp4 stsz box")
+	}
+	m.count = int(count)
+
+	// Chunk offsets
+	entrySize := uint32(4)
+	if t.co64 {
+		entrySize = 8
+	}
+	if !fits(t.stco, 8, binary.BigEndian.Uint32(t.stco[4:]), entrySize) {
+		return errors.New("invalid mp4 chunk offset box")
+	}
+	chunkCount := int(binary.BigEndian.Uint32(t.stco[4:]))
+	m.chunks = make([]chunk, chunkCount)
+	for i := range m.chunks {
+		if t.co64 {
+			m.chunks[i].offset = int64(binary.BigEndian.Uint64(t.stco[8+i*8:]))
+		} else {
+			m.chunks[i].offset = int64(binary.BigEndian.Uint32(t.stco[8+i*4:]))
+		}
+	}
+
+	// Samples to chunks. Each entry applies to the chunks up to the first chunk of the next entry
+	if !fits(t.stsc, 8, binary.BigEndian.Uint32(t.stsc[4:]), 12) {
+		return errors.New("invalid mp4 stsc box")
+	}
+	entries := int(binary.BigEndian.Uint32(t.stsc[4:]))
+	sample := 0
+	for i := 0; i < entries; i++ {
+		e := t.stsc[8+i*12:]
+		first := int(binary.BigEndian.Uint32(e)) - 1
+		perChunk := int(binary.BigEndian.Uint32(e[4:]))
+		last := chunkCount
+		if i+1 < entries {
+			last = int(binary.BigEndian.Uint32(t.stsc[8+(i+1)*12:])) - 1
+		}
+		if first < 0 || last > chunkCount {
+			return errors.New("invalid mp4 stsc box")
+		}
+		for c := first; c < last; c++ {
+			m.chunks[c].firstSample = sample
+			sample += perChunk
+		}
+	}
+	if sample < m.count {
+		return errors.New("mp4 chunks do not contain all samples")
+	}
+
+	// Sample durations
+	if !fits(t.stts, 8, binary.BigEndian.Uint32(t.stts[4:]), 8) {
+		return errors.New("invalid mp4 stts box")
+	}
+	runs := int(binary.BigEndian.Uint32(t.stts[4:]))
+	m.times = make([]timeRun, runs)
+	for i := range m.times {
+		m.times[i].count = int(binary.BigEndian.Uint32(t.stts[8+i*8:]))
+		m.times[i].delta = int64(binary.BigEndian.Uint32(t.stts[12+i*8:]))
+	}
+	return nil
+}
+
+// Samples returns the number of samples (AAC frames) in the track
+func (m *Movie) Samples() int {
+	return m.count
+}
+
+// Sample returns the offset and size of the sample in the file
+func (m *Movie) Sample(index int) (int64, int) {
+	c := sort.Search(len(m.chunks), func(i int) bool { return m.chunks[i].firstSample > index }) - 1
+	offset := m.chunks[c].offset
+	if m.sizes == nil {
+		offset += int64(index-m.chunks[c].firstSample) * int64(m.defaultSize)
+		return offset, int(m.defaultSize)
+	}
+	for i := m.chunks[c].firstSample; i < index; i++ {
+		offset += int64(m.sizes[i])
+	}
+	return offset, int(m.sizes[index])
+}
+
+// SampleTime returns the start time of the sample in units of the timescale
+func (m *Movie) SampleTime(index int) int64 {
+	var t int64
+	for _, run := range m.times {
+		if index <= run.count {
+			return t + int64(index)*run.delta
+		}
+		t += int64(run.count) * run.delta
+		index -= run.count
+	}
+	return t
+}
+
+// SampleAt returns the index of the sample that contains the specified time in units of the timescale
+func (m *Movie) SampleAt(t int64) int {
+	index := 0
+	for _, run := range m.times {
+		length := int64(run.count) * run.delta
+		if t < length && run.delta > 0 {
+			index += int(t / run.delta)
+			break
+		}
+		t -= length
+		index += run.count
+	}
+	if index > m.count {
+		index = m.count
+	}
+	return index
+}
+
+// Duration returns the duration of the audio track
+func (m *Movie) Duration() time.Duration {
+	return m.timeToDuration(m.SampleTime(m.count))
+}
+
+func (m *Movie) timeToDuration(t int64) time.Duration {
+	return time.Duration(t) * time.Second / time.Duration(m.Timescale)
+}
+
+// parseNeroChapters parses the list of chapters stored in the chpl box
+func parseNeroChapters(chpl []byte) []Chapter {
+	if len(chpl) < 9 {
+		return nil
+	}
+	b := chpl[4:]
+	if chpl[0] != 0 {
+		b = b[4:]
+	}
+	if len(b) < 1 {
+		return nil
+	}
+	count := int(b[0])
+	b = b[1:]
+	var chapters []Chapter
+	for i := 0; i < count && len(b) >= 9; i++ {
+		// The start is stored in units of 100 nanoseconds
+		start := time.Duration(binary.BigEndian.Uint64(b)) * 100
+		length := int(b[8])
+		b = b[9:]
+		if len(b) < length {
+			break
+		}
+		chapters = append(chapters, Chapter{Title: validString(b[:length]), Start: start})
+		b = b[length:]
+	}
+	return chapters
+}
+
+// readTextTrack reads the samples of the QuickTime text track. Each sample is a chapter title
+func readTextTrack(r io.ReadSeeker, size int64, t *track) ([]Chapter, error) {
+	if t.timescale == 0 {
+		return nil, nil
+	}
+	m := &Movie{Timescale: t.timescale}
+	if err := m.buildTables(&t.stbl, size); err != nil {
+		return nil, err
+	}
+	var chapters []Chapter
+	for i := 0; i < m.Samples(); i++ {
+		offset, size := m.Sample(i)
+		if size < 2 || size > 4096 {
+			continue
+		}
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		sample := make([]byte, size)
+		if _, err := io.ReadFull(r, sample); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(sample))
+		if length > size-2 {
+			length = size - 2
+		}
+		chapters = append(chapters, Chapter{Title: validString(sample[2 : 2+length]), Start: m.timeToDuration(m.SampleTime(i))})
+	}
+	return chapters, nil
+}
+
+// parseTitle returns the title from the iTunes tags
+func parseTitle(udta []byte) string {
+	meta := child(udta, "meta")
+	// In mp4 files the meta box has the version and flags, but in QuickTime files it does not
+	if len(meta) >= 8 && string(meta[4:8]) != "hdlr" {
+		meta = meta[4:]
+	}
+	data := child(meta, "ilst", "\xa9nam", "data")
+	if len(data) < 8 {
+		return ""
+	}
+	return validString(data[8:])
+}
+
+func validString(b []byte) string {
+	if !utf8.Valid(b) {
+		return ""
+	}
+	return string(b)
+}
+
+// ReadTitle reads the title of the file from its tags
+func ReadTitle(r io.ReadSeeker, size int64) (string, error) {
+	moov, err := readMoov(r, size)
+	if err != nil {
+		return "", err
+	}
+	return parseTitle(child(moov, "udta")), nil
+}
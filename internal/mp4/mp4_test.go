@@ -0,0 +1,53 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// table builds the full box with the version, flags and the 32-bit values
+func table(values ...uint32) []byte {
+	b := make([]byte, 4+len(values)*4)
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[4+i*4:], v)
+	}
+	return b
+}
+
+func TestBuildTables(t *testing.T) {
+	// One chunk at offset 1000 that contains all samples, each lasting 1024 units
+	stco := table(1, 1000)
+	stts := table(1, 10, 1024)
+	tests := []struct {
+		name    string
+		stsz    []byte
+		stsc    []byte
+		size    int64
+		wantErr bool
+		// Offset and size of the last sample
+		offset int64
+		length int
+	}{
+		{"same sizes", table(100, 10), table(1, 1, 10, 1), 10000, false, 1900, 100},
+		{"different sizes", table(0, 3, 10, 20, 30), table(1, 1, 3, 1), 10000, false, 1030, 30},
+		{"same sizes beyond the file", table(100, 0xFFFFFFFF), table(1, 1, 0xFFFFFFFF, 1), 10000, true, 0, 0},
+		{"sizes beyond the box", table(0, 0xFFFFFFFF, 10), table(1, 1, 10, 1), 10000, true, 0, 0},
+		{"samples beyond the chunks", table(100, 10), table(1, 1, 5, 1), 10000, true, 0, 0},
+		{"stsc entries beyond the box", table(100, 10), table(0xFFFFFFFF, 1, 10, 1), 10000, true, 0, 0},
+	}
+	for _, tt := range tests {
+		m := &Movie{Timescale: 44100}
+		err := m.buildTables(&stbl{stsz: tt.stsz, stsc: tt.stsc, stco: stco, stts: stts}, tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		offset, length := m.Sample(m.Samples() - 1)
+		if offset != tt.offset || length != tt.length {
+			t.Errorf("%v: last sample at %d of %d bytes, want at %d of %d bytes", tt.name, offset, length, tt.offset, tt.length)
+		}
+	}
+}
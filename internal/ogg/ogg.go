@@ -0,0 +1,408 @@
+// Package ogg reads pages and packets of the Ogg container
+package ogg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	headerSize  = 27
+	maxPageSize = headerSize + 255 + 255*255
+)
+
+// Flags of the page header
+const (
+	flagContinued = 0x01
+	flagFirst     = 0x02
+	flagLast      = 0x04
+)
+
+var capturePattern = []byte("OggS")
+
+var ErrNoPage = errors.New("ogg page not found")
+
+// Page is a page of the Ogg stream
+type Page struct {
+	Continued bool
+	First     bool
+	Last      bool
+	// Granule is the position of the last packet completed on the page, or -1 if no packet is completed
+	Granule  int64
+	Serial   uint32
+	Sequence uint32
+	// Lacing values of the segments
+	Segments []byte
+	Data     []byte
+	// Offset of the page in the source
+	Offset int64
+}
+
+// Size returns the size of the page including its header
+func (p *Page) Size() int {
+	return headerSize + len(p.Segments) + len(p.Data)
+}
+
+var crcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func crc(crc uint32, b []byte) uint32 {
+	for _, v := range b {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+// Reader reads the pages of the Ogg stream. Invalid data between pages is skipped
+type Reader struct {
+	src io.ReadSeeker
+	r   *bufio.Reader
+	// Offset of the next byte of the buffered reader in the source
+	pos int64
+}
+
+// NewReader creates a reader of the source positioned at its beginning
+func NewReader(src io.ReadSeeker) *Reader {
+	return &Reader{src: src, r: bufio.NewReader(src)}
+}
+
+// Offset returns the position in the source from which the next page is searched for
+func (r *Reader) Offset() int64 {
+	return r.pos
+}
+
+// SeekTo sets the position from which the next page is searched for
+func (r *Reader) SeekTo(offset int64) error {
+	if _, err := r.src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r.r.Reset(r.src)
+	r.pos = offset
+	return nil
+}
+
+// sync skips the data up to the next capture pattern
+func (r *Reader) sync() error {
+	for {
+		b, err := r.r.Peek(len(capturePattern))
+		if bytes.Equal(b, capturePattern) {
+			return nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = ErrNoPage
+			}
+			return err
+		}
+		r.r.Discard(1)
+		r.pos++
+	}
+}
+
+// ReadPage reads the next valid page
+func (r *Reader) ReadPage() (*Page, error) {
+	for {
+		if err := r.sync(); err != nil {
+			return nil, err
+		}
+		p, err := r.readPage()
+		if err == nil {
+			return p, nil
+		}
+		if err != errInvalidPage {
+			return nil, err
+		}
+	}
+}
+
+var errInvalidPage = errors.New("invalid ogg page")
+
+func (r *Reader) readPage() (*Page, error) {
+	offset := r.pos
+	header, err := r.r.Peek(headerSize)
+	if err != nil {
+		if err == io.EOF {
+			err = ErrNoPage
+		}
+		return nil, err
+	}
+	if header[4] != 0 {
+		// Unknown version of the stream structure. It may be a false capture pattern
+		r.r.Discard(1)
+		r.pos++
+		return nil, errInvalidPage
+	}
+	segments := int(header[26])
+	buf := make([]byte, headerSize+segments, maxPageSize)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return nil, r.eof(err)
+	}
+	dataSize := 0
+	for _, v := range buf[headerSize:] {
+		dataSize += int(v)
+	}
+	buf = buf[:headerSize+segments+dataSize]
+	if _, err := io.ReadFull(r.r, buf[headerSize+segments:]); err != nil {
+		return nil, r.eof(err)
+	}
+
+	// The checksum is calculated with the checksum field set to zero
+	sum := binary.LittleEndian.Uint32(buf[22:])
+	binary.LittleEndian.PutUint32(buf[22:], 0)
+	if crc(0, buf) != sum {
+		// The page is damaged or the capture pattern was found in the data. Searching continues after it
+		if err := r.SeekTo(offset + 1); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidPage
+	}
+	r.pos += int64(len(buf))
+
+	flags := buf[5]
+	return &Page{
+		Continued: flags&flagContinued != 0,
+		First:     flags&flagFirst != 0,
+		Last:      flags&flagLast != 0,
+		Granule:   int64(binary.LittleEndian.Uint64(buf[6:])),
+		Serial:    binary.LittleEndian.Uint32(buf[14:]),
+		Sequence:  binary.LittleEndian.Uint32(buf[18:]),
+		Segments:  buf[headerSize : headerSize+segments],
+		Data:      buf[headerSize+segments:],
+		Offset:    offset,
+	}, nil
+}
+
+func (r *Reader) eof(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrNoPage
+	}
+	return err
+}
+
+// PacketReader assembles the packets of one logical stream from the pages
+type PacketReader struct {
+	pages  *Reader
+	serial uint32
+	known  bool
+	page   *Page
+	// Index of the next segment of the current page and the offset of its data
+	segment, dataPos int
+	partial          []byte
+	// The beginning of a packet that was started before seeking must be dropped
+	dropContinued bool
+}
+
+// NewPacketReader creates a reader of packets of the first logical stream found by the page reader
+func NewPacketReader(pages *Reader) *PacketReader {
+	return &PacketReader{pages: pages}
+}
+
+// Serial returns the serial number of the logical stream
+func (pr *PacketReader) Serial() uint32 {
+	return pr.serial
+}
+
+// SeekTo moves to the first page after the specified offset. A packet that is continued on that page is skipped
+func (pr *PacketReader) SeekTo(offset int64) error {
+	pr.page = nil
+	pr.partial = nil
+	pr.dropContinued = true
+	return pr.pages.SeekTo(offset)
+}
+
+// Offset returns the offset of the first page that has not been read yet
+func (pr *PacketReader) Offset() int64 {
+	return pr.pages.Offset()
+}
+
+func (pr *PacketReader) nextPage() error {
+	for {
+		page, err := pr.pages.ReadPage()
+		if err != nil {
+			if err == ErrNoPage {
+				return io.EOF
+			}
+			return err
+		}
+		if !pr.known {
+			pr.serial = page.Serial
+			pr.known = true
+		}
+		if page.Serial != pr.serial {
+			continue
+		}
+		pr.page = page
+		pr.segment = 0
+		pr.dataPos = 0
+		if page.Continued && pr.dropContinued {
+			// Skipping the segments of the packet started on the previous pages
+			for pr.segment < len(page.Segments) {
+				lacing := int(page.Segments[pr.segment])
+				pr.segment++
+				pr.dataPos += lacing
+				if lacing < 255 {
+					break
+				}
+			}
+			if n := len(page.Segments); pr.segment == n && (n == 0 || page.Segments[n-1] == 255) {
+				// The packet continues on the next page
+				continue
+			}
+		} else if !page.Continued {
+			pr.partial = pr.partial[:0]
+		}
+		pr.dropContinued = false
+		return nil
+	}
+}
+
+// ReadPacket returns the next packet. If it is the last packet completed on its page, the granule position of the page is returned, otherwise -1.
+// The packet is valid until the next call
+func (pr *PacketReader) ReadPacket() ([]byte, int64, error) {
+	for {
+		if pr.page == nil || pr.segment == len(pr.page.Segments) {
+			if err := pr.nextPage(); err != nil {
+				return nil, -1, err
+			}
+			continue
+		}
+		page := pr.page
+		start := pr.dataPos
+		complete := false
+		for pr.segment < len(page.Segments) {
+			lacing := int(page.Segments[pr.segment])
+			pr.segment++
+			pr.dataPos += lacing
+			if lacing < 255 {
+				complete = true
+				break
+			}
+		}
+		pr.partial = append(pr.partial, page.Data[start:pr.dataPos]...)
+		if !complete {
+			continue
+		}
+		packet := pr.partial
+		pr.partial = pr.partial[:0]
+
+		granule := int64(-1)
+		if !pr.packetEndsLater() {
+			granule = page.Granule
+		}
+		return packet, granule, nil
+	}
+}
+
+// packetEndsLater reports whether another packet is completed on the current page
+func (pr *PacketReader) packetEndsLater() bool {
+	for _, lacing := range pr.page.Segments[pr.segment:] {
+		if lacing < 255 {
+			return true
+		}
+	}
+	return false
+}
+
+// LastGranule returns the granule position of the last page of the stream with the specified serial number.
+// Only the end of the source is read. The position of the reader is changed
+func (r *Reader) LastGranule(serial uint32, start, size int64) (int64, error) {
+	for window := int64(maxPageSize); ; window *= 2 {
+		offset := size - window
+		if offset < start {
+			offset = start
+		}
+		if err := r.SeekTo(offset); err != nil {
+			return -1, err
+		}
+		granule := int64(-1)
+		for {
+			page, err := r.ReadPage()
+			if err == ErrNoPage {
+				break
+			}
+			if err != nil {
+				return -1, err
+			}
+			if page.Serial == serial && page.Granule != -1 {
+				granule = page.Granule
+			}
+		}
+		if granule != -1 || offset == start {
+			return granule, nil
+		}
+	}
+}
+
+// FindGranule returns the offset of the page that follows the last page of the stream with a granule position not greater than the specified one.
+// Pages are searched by bisection between the start and the end of the source
+func (r *Reader) FindGranule(serial uint32, granule, start, end int64) (int64, error) {
+	// Offset of the end of the last page found before the granule position
+	found := start
+	lo, hi := start, end
+	for hi-lo > maxPageSize {
+		mid := lo + (hi-lo)/2
+		if err := r.SeekTo(mid); err != nil {
+			return 0, err
+		}
+		page, err := r.pageWithGranule(serial, hi)
+		if err != nil {
+			return 0, err
+		}
+		if page == nil || page.Granule > granule {
+			hi = mid
+			continue
+		}
+		lo = page.Offset
+		found = page.Offset + int64(page.Size())
+	}
+
+	// The remaining interval is scanned linearly
+	if err := r.SeekTo(lo); err != nil {
+		return 0, err
+	}
+	for {
+		page, err := r.pageWithGranule(serial, end)
+		if err != nil {
+			return 0, err
+		}
+		if page == nil || page.Granule > granule {
+			return found, nil
+		}
+		found = page.Offset + int64(page.Size())
+	}
+}
+
+// pageWithGranule reads pages up to the limit until a page of the stream with a known granule position is found
+func (r *Reader) pageWithGranule(serial uint32, limit int64) (*Page, error) {
+	for {
+		page, err := r.ReadPage()
+		if err == ErrNoPage {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if page.Offset >= limit {
+			return nil, nil
+		}
+		if page.Serial == serial && page.Granule != -1 {
+			return page, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package opus decodes Opus packets by libopus
+package opus
+
+//#cgo LDFLAGS: -lopus
+//#include <opus/opus_multistream.h>
+//
+//static int set_gain(OpusMSDecoder *dec, int gain) {
+//	return opus_multistream_decoder_ctl(dec, OPUS_SET_GAIN(gain));
+//}
+//
+//static void reset(OpusMSDecoder *dec) {
+//	opus_multistream_decoder_ctl(dec, OPUS_RESET_STATE);
+//}
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+const (
+	// Opus streams are always decoded at 48 kHz
+	SampleRate = 48000
+	// The maximum duration of a packet is 120 ms
+	maxFrameSamples = SampleRate * 120 / 1000
+)
+
+type Decoder struct {
+	dec      *C.OpusMSDecoder
+	channels int
+	pcm      []byte
+}
+
+// NewDecoder creates a decoder of the multistream packets. For single streams streams is 1 and mapping is {0} or {0, 1}.
+// Gain is the output gain in Q7.8 dB from the OpusHead header
+func NewDecoder(channels, streams, coupled int, mapping []byte, gain int) (*Decoder, error) {
+	if channels == 0 || len(mapping) < channels {
+		return nil, fmt.Errorf("invalid opus channel mapping")
+	}
+	var result C.int
+	dec := C.opus_multistream_decoder_create(C.opus_int32(SampleRate), C.int(channels), C.int(streams), C.int(coupled), (*C.uchar)(unsafe.Pointer(&mapping[0])), &result)
+	if result != C.OPUS_OK {
+		return nil, fmt.Errorf("creating opus decoder: %v", C.GoString(C.opus_strerror(result)))
+	}
+	if result := C.set_gain(dec, C.int(gain)); result != C.OPUS_OK {
+		C.opus_multistream_decoder_destroy(dec)
+		return nil, fmt.Errorf("setting opus gain: %v", C.GoString(C.opus_strerror(result)))
+	}
+
+	d := &Decoder{
+		dec:      dec,
+		channels: channels,
+		pcm:      make([]byte, maxFrameSamples*channels*C.sizeof_short),
+	}
+	runtime.SetFinalizer(d, func(d *Decoder) { C.opus_multistream_decoder_destroy(d.dec) })
+	return d, nil
+}
+
+func (d *Decoder) Channels() int {
+	return d.channels
+}
+
+// Decode decodes the packet and returns 16-bit PCM data. The data is valid until the next call
+func (d *Decoder) Decode(packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, nil
+	}
+	samples := C.opus_multistream_decode(d.dec,
+		(*C.uchar)(unsafe.Pointer(&packet[0])), C.opus_int32(len(packet)),
+		(*C.opus_int16)(unsafe.Pointer(&d.pcm[0])), C.int(maxFrameSamples), 0,
+	)
+	if samples < 0 {
+		return nil, fmt.Errorf("decoding opus packet: %v", C.GoString(C.opus_strerror(samples)))
+	}
+	return d.pcm[:int(samples)*d.channels*C.sizeof_short], nil
+}
+
+// Reset discards the state of the decoder before decoding from another position of the stream
+func (d *Decoder) Reset() {
+	C.reset(d.dec)
+}
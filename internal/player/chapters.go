@@ -0,0 +1,98 @@
+package player
+
+import (
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
+	"github.com/kvark128/dodp"
+)
+
+// Chapter is a navigation unit of the book. It is either a chapter embedded in a resource or a whole fragment
+type Chapter struct {
+	// Title is empty for fragments without embedded chapters
+	Title    string
+	Fragment int
+	Position time.Duration
+}
+
+// Chapters returns the chapters of the book in playback order.
+// Embedded chapters of a resource are only known after the resource has been opened or probed
+func (p *Player) Chapters() []Chapter {
+	p.Lock()
+	defer p.Unlock()
+	return p.chapterList()
+}
+
+// Chapter returns the index of the current chapter in the list returned by Chapters
+func (p *Player) Chapter() int {
+	p.Lock()
+	defer p.Unlock()
+	return p.chapter()
+}
+
+func (p *Player) chapter() int {
+	return p.chapterAt(p.fragmentIndex, p.position())
+}
+
+// chapterAt returns the index of the chapter that contains the position in the fragment. Must be called with the player locked
+func (p *Player) chapterAt(fragment int, pos time.Duration) int {
+	current := 0
+	for i, c := range p.chapterList() {
+		if c.Fragment > fragment || (c.Fragment == fragment && c.Position > pos) {
+			break
+		}
+		current = i
+	}
+	return current
+}
+
+// SetChapter moves to the beginning of the chapter with the specified index
+func (p *Player) SetChapter(index int) {
+	p.Lock()
+	defer p.Unlock()
+	chapters := p.chapterList()
+	if index < 0 || index >= len(chapters) {
+		// This chapter does not exist. Don't need to do anything
+		return
+	}
+	p.moveTo(chapters[index].Fragment, chapters[index].Position)
+	if p.timerStop != nil && p.timer.byChapters() {
+		// The chapters of the timer are counted from the selected one
+		p.startTimer()
+	}
+}
+
+func (p *Player) chapterList() []Chapter {
+	var list []Chapter
+	for i, r := range p.playList {
+		chapters := p.chapters[r.LocalURI]
+		if len(chapters) == 0 {
+			list = append(list, Chapter{Fragment: i})
+			continue
+		}
+		for _, c := range chapters {
+			list = append(list, Chapter{Title: c.Title, Fragment: i, Position: c.Start})
+		}
+	}
+	return list
+}
+
+// saveChapters remembers the embedded chapters of the resource, if its decoder supports them
+func (p *Player) saveChapters(uri string, dec decoder.Decoder) {
+	if chapterer, ok := dec.(decoder.Chapterer); ok {
+		chapters := chapterer.Chapters()
+		p.Lock()
+		p.chapters[uri] = chapters
+		p.Unlock()
+	}
+}
+
+// chaptersUnknown reports that the resource can contain embedded chapters, but it has not been opened yet.
+// Must be called with the player locked
+func (p *Player) chaptersUnknown(r dodp.Resource) bool {
+	if _, ok := p.chapters[r.LocalURI]; ok {
+		return false
+	}
+	format, err := decoder.Lookup(r.LocalURI, r.MimeType)
+	return err == nil && format.Book
+}
@@ -0,0 +1,307 @@
+package player
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/connection"
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"github.com/kvark128/OnlineLibrary/internal/util/buffer"
+	"github.com/kvark128/dodp"
+)
+
+// SetDurations sets the previously measured durations of the resources, by their local URI
+func (p *Player) SetDurations(durations map[string]time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	for i, r := range p.playList {
+		if d, ok := durations[r.LocalURI]; ok && d > 0 {
+			p.durations[i] = d
+		}
+	}
+	p.byterateValid = false
+}
+
+// Durations returns the measured durations of the resources, by their local URI
+func (p *Player) Durations() map[string]time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	durations := make(map[string]time.Duration)
+	for i, r := range p.playList {
+		if p.durations[i] > 0 {
+			durations[r.LocalURI] = p.durations[i]
+		}
+	}
+	return durations
+}
+
+// FragmentDuration returns the duration of the current fragment
+func (p *Player) FragmentDuration() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.fragmentDuration(p.fragmentIndex)
+}
+
+// BookDuration returns the duration of the whole book.
+// Durations of the resources that have not been measured yet are estimated by their size
+func (p *Player) BookDuration() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.bookDuration()
+}
+
+// BookPosition returns the position from the beginning of the book
+func (p *Player) BookPosition() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.bookElapsedTime(p.fragmentIndex, p.position())
+}
+
+// SetBookPosition sets the position from the beginning of the book. The fragment containing this position becomes the current one
+func (p *Player) SetBookPosition(pos time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.moveTo(p.locate(pos))
+}
+
+// moveTo sets the position in the fragment with the specified index. Must be called with the player locked
+func (p *Player) moveTo(index int, offset time.Duration) {
+	if index == p.fragmentIndex {
+		p.setPosition(offset)
+		return
+	}
+	p.fragmentIndex = index
+	if p.playing.Load() {
+		p.stopPlayback()
+		p.offset = offset
+		p.startPlayback()
+		return
+	}
+	p.offset = offset
+}
+
+// locate returns the index of the fragment containing the specified book position and the offset from the beginning of this fragment
+func (p *Player) locate(pos time.Duration) (int, time.Duration) {
+	if len(p.playList) == 0 || p.bookDuration() == 0 {
+		// Durations of the fragments are unknown. The position can only be set in the current fragment
+		return p.fragmentIndex, pos - p.bookElapsedTime(p.fragmentIndex, 0)
+	}
+	if pos < 0 {
+		return 0, 0
+	}
+	last := len(p.playList) - 1
+	for index := 0; index < last; index++ {
+		d := p.fragmentDuration(index)
+		if pos < d {
+			return index, pos
+		}
+		pos -= d
+	}
+	if d := p.fragmentDuration(last); pos > d {
+		pos = d
+	}
+	return last, pos
+}
+
+// TimeLeft returns the time remaining until the end of the book at the current speed
+func (p *Player) TimeLeft() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.timeLeft(p.bookElapsedTime(p.fragmentIndex, p.position()))
+}
+
+func (p *Player) position() time.Duration {
+	if p.fragment != nil {
+		return p.fragment.Position()
+	}
+	return p.offset
+}
+
+// Average number of bytes per second for the measured resources. Used to estimate the duration of the remaining ones.
+// The result is cached until the durations change, since the book duration is calculated on every position event
+func (p *Player) byterate() float64 {
+	if p.byterateValid {
+		return p.byterateCache
+	}
+	p.byterateCache = p.measuredByterate()
+	p.byterateValid = true
+	return p.byterateCache
+}
+
+func (p *Player) measuredByterate() float64 {
+	var size int64
+	var duration time.Duration
+	for i, r := range p.playList {
+		if p.durations[i] > 0 {
+			size += r.Size
+			duration += p.durations[i]
+		}
+	}
+	if duration == 0 {
+		return 0
+	}
+	return float64(size) / duration.Seconds()
+}
+
+func (p *Player) fragmentDuration(index int) time.Duration {
+	if index < 0 || index >= len(p.playList) {
+		return 0
+	}
+	if p.durations[index] > 0 {
+		return p.durations[index]
+	}
+	if byterate := p.byterate(); byterate > 0 {
+		return time.Duration(float64(p.playList[index].Size) / byterate * float64(time.Second))
+	}
+	if p.fragment != nil && p.fragment.Bitrate > 0 {
+		// Nothing has been measured yet. Only the bitrate of the playing fragment is known
+		return time.Second * time.Duration(p.playList[index].Size) / time.Duration(p.fragment.Bitrate*1000/8)
+	}
+	return 0
+}
+
+func (p *Player) bookDuration() time.Duration {
+	var total time.Duration
+	for i := range p.playList {
+		total += p.fragmentDuration(i)
+	}
+	return total
+}
+
+func (p *Player) bookElapsedTime(index int, pos time.Duration) time.Duration {
+	var elapsed time.Duration
+	for i := 0; i < index && i < len(p.playList); i++ {
+		elapsed += p.fragmentDuration(i)
+	}
+	return elapsed + pos
+}
+
+func (p *Player) timeLeft(elapsed time.Duration) time.Duration {
+	left := p.bookDuration() - elapsed
+	if left < 0 {
+		left = 0
+	}
+	return time.Duration(float64(left) / p.speed)
+}
+
+// setDuration stores the measured duration of the resource with the specified local URI
+func (p *Player) setDuration(uri string, d time.Duration) {
+	for i, r := range p.playList {
+		if r.LocalURI == uri && p.durations[i] == 0 {
+			p.durations[i] = d
+			p.byterateValid = false
+		}
+	}
+}
+
+// startProbe starts measuring durations of all resources in the background, if it is not already running
+func (p *Player) startProbe() {
+	if p.probeCtx != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.probeCtx = ctx
+	p.probeCancel = cancel
+	go p.probe(ctx)
+}
+
+func (p *Player) stopProbe() {
+	if p.probeCancel != nil {
+		p.probeCancel()
+	}
+	p.probeCtx = nil
+	p.probeCancel = nil
+}
+
+func (p *Player) probe(ctx context.Context) {
+	defer func() {
+		p.Lock()
+		defer p.Unlock()
+		if p.probeCtx == ctx {
+			p.stopProbe()
+		}
+	}()
+
+	for i, r := range p.playList {
+		p.Lock()
+		known := p.durations[i] > 0 && !p.chaptersUnknown(r)
+		p.Unlock()
+		if known {
+			continue
+		}
+
+		d, index, err := p.probeResource(ctx, r)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.logger.Warning("Probing duration of %v: %v", r.LocalURI, err)
+			continue
+		}
+
+		p.Lock()
+		if _, ok := p.indexes[r.LocalURI]; !ok && index != nil {
+			p.indexes[r.LocalURI] = index
+		}
+		p.setDuration(r.LocalURI, d)
+		p.Unlock()
+		p.logger.Debug("Duration of %v: %v", r.LocalURI, d)
+	}
+
+	p.analyzeLoudness(ctx)
+}
+
+// probeResource measures the duration of the resource and returns the seek table built by the decoder, if any. Embedded chapters are saved on the way
+// Local resources are scanned completely, for remote ones only the headers are read
+func (p *Player) probeResource(ctx context.Context, r dodp.Resource) (time.Duration, decoder.Index, error) {
+	src, dec, err := p.openDecoder(ctx, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer src.Close()
+	p.saveChapters(r.LocalURI, dec)
+	d, err := dec.Duration()
+	if err != nil {
+		return 0, nil, err
+	}
+	var index decoder.Index
+	if indexer, ok := dec.(decoder.Indexer); ok {
+		index = indexer.Index()
+	}
+	return d, index, nil
+}
+
+// openDecoder opens the decoder of the resource for the background work. The local copy is used if it exists
+func (p *Player) openDecoder(ctx context.Context, r dodp.Resource) (io.Closer, decoder.Decoder, error) {
+	var src io.ReadSeekCloser
+	localPath := filepath.Join(p.bookDir, r.LocalURI)
+	local := util.FileIsExist(localPath, r.Size)
+
+	if local {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		src = f
+	} else {
+		p.Lock()
+		transport := p.transport
+		p.Unlock()
+		conn, err := connection.NewConnectionWithContext(ctx, r.URI, transport, p.logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		src = conn
+	}
+
+	dec, err := decoder.Open(r.LocalURI, r.MimeType, decoder.Source{ReadSeeker: buffer.NewReader(src), Size: r.Size, Local: local})
+	if err != nil {
+		src.Close()
+		return nil, nil, err
+	}
+	return src, dec, nil
+}
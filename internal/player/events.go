@@ -0,0 +1,178 @@
+package player
+
+import (
+	"time"
+)
+
+// EventType is the kind of change of the playback state
+type EventType int
+
+const (
+	// The sound has started, either at the beginning of playback or after a pause
+	EventStarted EventType = iota
+	// Playback has been paused by the user or by the pause timer
+	EventPaused
+	// Playback has been stopped by the user or by moving to another fragment
+	EventStopped
+	// Playing of the next fragment has begun
+	EventFragmentChanged
+	// The position has changed during playback or by seeking
+	EventPosition
+	// The last fragment of the book has been played to the end
+	EventFinished
+	// Playback has been interrupted by an error
+	EventError
+	// The pause timer has paused playback
+	EventTimerExpired
+)
+
+// State is the snapshot of the playback state
+type State struct {
+	// Playback is in progress. It can be paused at the same time
+	Playing bool
+	Paused  bool
+	// Index of the current fragment and the number of fragments in the book
+	Fragment  int
+	Fragments int
+	// Position in the current fragment and its duration
+	Position         time.Duration
+	FragmentDuration time.Duration
+	// Position from the beginning of the book and the duration of the book. The duration is zero if it is unknown
+	BookPosition time.Duration
+	BookDuration time.Duration
+	BookPercent  int
+	// Time remaining until the end of the book at the current speed
+	TimeLeft time.Duration
+	// Index of the current chapter in the list returned by Chapters
+	Chapter int
+	Speed   float64
+	Pitch   float64
+	Volume  float64
+	// The pause timer and the loop are running
+	TimerRunning bool
+	Looping      bool
+	// The fragment is streamed from the network, and the fill level of its read-ahead buffer in percent
+	Streaming bool
+	Buffered  int
+}
+
+// Event is a change of the playback state
+type Event struct {
+	Type EventType
+	// State of the player at the moment of the event
+	State State
+	// Error that interrupted playback, for EventError
+	Err error
+}
+
+// PlaybackObserver receives the events of the player.
+// Events are delivered in order from a separate goroutine without the player locked, so the observer can call the player
+type PlaybackObserver interface {
+	PlaybackEvent(e Event)
+}
+
+// ObserverFunc is a function that is used as a playback observer
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) PlaybackEvent(e Event) {
+	f(e)
+}
+
+// AddObserver subscribes the observer to the events of the player. The returned function unsubscribes it
+func (p *Player) AddObserver(o PlaybackObserver) func() {
+	p.Lock()
+	defer p.Unlock()
+	id := p.nextObserver
+	p.nextObserver++
+	p.observers[id] = o
+	return func() {
+		p.Lock()
+		defer p.Unlock()
+		delete(p.observers, id)
+	}
+}
+
+// State returns the current playback state
+func (p *Player) State() State {
+	p.Lock()
+	defer p.Unlock()
+	return p.state()
+}
+
+func (p *Player) state() State {
+	pos := p.position()
+	elapsed := p.bookElapsedTime(p.fragmentIndex, pos)
+	duration := p.bookDuration()
+	s := State{
+		Playing:          p.playing.Load(),
+		Paused:           p.fragment != nil && p.fragment.IsPause(),
+		Fragment:         p.fragmentIndex,
+		Fragments:        len(p.playList),
+		Position:         pos,
+		FragmentDuration: p.fragmentDuration(p.fragmentIndex),
+		BookPosition:     elapsed,
+		BookDuration:     duration,
+		TimeLeft:         p.timeLeft(elapsed),
+		Chapter:          p.chapter(),
+		Speed:            p.speed,
+		Pitch:            p.pitch,
+		Volume:           p.volume,
+		TimerRunning:     p.timerStop != nil,
+		Looping:          p.looping,
+	}
+	if duration > 0 {
+		s.BookPercent = int(elapsed * 100 / duration)
+	}
+	if p.fragment != nil && p.fragment.readAhead != nil {
+		s.Streaming = true
+		s.Buffered = p.fragment.readAhead.Level()
+	}
+	return s
+}
+
+// emit queues the event for the observers. Must be called with the player locked
+func (p *Player) emit(t EventType, err error) {
+	if len(p.observers) == 0 {
+		return
+	}
+	p.events = append(p.events, Event{Type: t, State: p.state(), Err: err})
+	if !p.dispatching {
+		p.dispatching = true
+		go p.dispatch()
+	}
+}
+
+// dispatch delivers the queued events to the observers until the queue is empty
+func (p *Player) dispatch() {
+	for {
+		p.Lock()
+		if len(p.events) == 0 {
+			p.dispatching = false
+			p.Unlock()
+			return
+		}
+		e := p.events[0]
+		p.events = p.events[1:]
+		observers := make([]PlaybackObserver, 0, len(p.observers))
+		for _, o := range p.observers {
+			observers = append(observers, o)
+		}
+		p.Unlock()
+		for _, o := range observers {
+			o.PlaybackEvent(e)
+		}
+	}
+}
+
+// setActive emits the event of the sound starting or pausing, if it has changed. Must be called with the player locked
+func (p *Player) setActive(active bool) {
+	if p.active == active {
+		return
+	}
+	p.active = active
+	if active {
+		p.emit(EventStarted, nil)
+	} else {
+		p.emit(EventPaused, nil)
+	}
+}
@@ -4,93 +4,134 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/kvark128/OnlineLibrary/internal/minimp3"
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
+	"github.com/kvark128/OnlineLibrary/internal/equalizer"
+	"github.com/kvark128/OnlineLibrary/internal/loudness"
 	"github.com/kvark128/OnlineLibrary/internal/sonic"
+	"github.com/kvark128/OnlineLibrary/internal/util/buffer"
 	"github.com/kvark128/OnlineLibrary/internal/util/syncio"
-	"github.com/kvark128/OnlineLibrary/internal/waveout"
 )
 
 type Fragment struct {
 	sync.Mutex
-	paused         bool
-	stream         *sonic.Stream
-	dec            *minimp3.Decoder
+	paused  bool
+	stream  *sonic.Stream
+	dec     decoder.Decoder
+	skipper *silenceSkipper
+	eq      *equalizer.Equalizer
+	limiter *loudness.Limiter
+	// Measures the loudness of the fragment while it is played from the beginning without seeking
+	meter    *loudness.Meter
+	loudness float64
+	measured bool
+	volume   float64
+	// Multiplier of the volume while the pause timer fades out the playback
+	fade float64
+	// Normalization gain in dB
+	normGain       float64
+	channels       int
+	sampleRate     int
 	pcmBytesPerSec int
 	wpBufSize      int
 	Bitrate        int
-	wp             *waveout.WavePlayer
+	wp             AudioSink
 	willBeStopped  bool
 	pos            time.Duration
+	// Buffer of the fragment streamed from the network. Nil if the fragment is local
+	readAhead *buffer.ReadAhead
 }
 
 const BufferDuration = time.Millisecond * 400
 
-func NewFragment(mp3Source io.Reader, devName string) (*Fragment, error) {
-	dec := minimp3.NewDecoder(mp3Source)
-	// Reading into an empty buffer will fill the internal buffer of the decoder, so you can get the audio data parameters
-	if _, err := dec.Read(nil); err != nil {
-		return nil, err
-	}
-
+// NewFragment creates a fragment from the audio decoder. The fragment can only be played after connecting it to the audio sink
+func NewFragment(dec decoder.Decoder) (*Fragment, error) {
 	sampleRate := dec.SampleRate()
 	channels := dec.Channels()
-	bitrate := dec.Bitrate()
 	pcmBytesPerSec := sampleRate * channels * 2
 
-	if pcmBytesPerSec == 0 || bitrate == 0 {
-		return nil, fmt.Errorf("invalid mp3")
+	if pcmBytesPerSec == 0 {
+		return nil, fmt.Errorf("invalid audio stream")
 	}
 
-	wpBufSize := int(time.Duration(pcmBytesPerSec) * BufferDuration / time.Second)
-	wp, err := waveout.NewWavePlayer(channels, sampleRate, 16, wpBufSize, devName)
-	if err != nil {
-		return nil, err
+	var bitrate int
+	if b, ok := dec.(decoder.Bitrater); ok {
+		bitrate = b.Bitrate()
 	}
 
+	wpBufSize := int(time.Duration(pcmBytesPerSec) * BufferDuration / time.Second)
+
 	f := &Fragment{
+		channels:       channels,
+		sampleRate:     sampleRate,
 		pcmBytesPerSec: pcmBytesPerSec,
 		wpBufSize:      wpBufSize,
 		Bitrate:        bitrate,
 		stream:         sonic.NewStream(sampleRate, channels),
 		dec:            dec,
-		wp:             wp,
+		meter:          loudness.NewMeter(sampleRate, channels),
+		volume:         1,
+		fade:           1,
 	}
+	f.skipper = newSilenceSkipper(io.TeeReader(dec, fragmentMeter{f}), sampleRate, channels)
+	f.eq = equalizer.NewReader(f.skipper, sampleRate, channels)
+	// Volume is applied by the limiter, so the boosted signal never clips
+	f.limiter = loudness.NewLimiter(f.stream, sampleRate, channels)
 
 	return f, nil
 }
 
+// fragmentMeter passes the decoded data to the loudness meter of the fragment, while the measurement is valid
+type fragmentMeter struct {
+	f *Fragment
+}
+
+func (m fragmentMeter) Write(p []byte) (int, error) {
+	if m.f.meter != nil {
+		m.f.meter.Write(p)
+	}
+	return len(p), nil
+}
+
 func (f *Fragment) play(playing *atomic.Bool, elapsedTimeCallback func(time.Duration)) error {
 	var p time.Duration
 	wp := bufio.NewWriterSize(f.wp, f.wpBufSize)
 	stream := syncio.NewReadWriter(f.stream, f)
-	dec := syncio.NewReader(f.dec, f)
+	src := syncio.NewReader(f.eq, f)
+	out := syncio.NewReader(f.limiter, f)
 
 	for playing.Load() {
 		elapsedTimeCallback(f.Position())
-		_, err := io.CopyN(stream, dec, int64(f.wpBufSize))
+		_, err := io.CopyN(stream, src, int64(f.wpBufSize))
 		if err != nil {
 			if err != io.EOF {
 				f.wp.Stop()
-				return fmt.Errorf("copying from mp3 decoder to sonic stream: %w", err)
+				return fmt.Errorf("copying from decoder to sonic stream: %w", err)
 			}
 			f.Lock()
 			f.stream.Flush()
+			f.limiter.Drain()
+			if f.meter != nil {
+				f.loudness, f.measured = f.meter.Integrated()
+			}
 			f.Unlock()
 		}
-		if _, err := wp.ReadFrom(stream); err != nil {
+		if _, err := wp.ReadFrom(out); err != nil {
 			return fmt.Errorf("copying from sonic stream to wave player: %w", err)
 		}
 		f.Lock()
+		// The position is advanced by the amount of decoded data, including the silence removed by the skipper
+		consumed := f.skipper.takeConsumed()
 		if f.willBeStopped {
 			p = 0
 			f.willBeStopped = false
 		} else {
 			f.pos += p
-			p = BufferDuration
+			p = time.Second * time.Duration(consumed) / time.Duration(f.pcmBytesPerSec)
 		}
 		f.Unlock()
 
@@ -101,7 +142,7 @@ func (f *Fragment) play(playing *atomic.Bool, elapsedTimeCallback func(time.Dura
 		}
 	}
 
-	f.wp.Sync()
+	// The sink is not synchronized here, so that the next fragment can continue writing to it without a gap
 	f.Lock()
 	f.pos += p
 	f.Unlock()
@@ -109,16 +150,90 @@ func (f *Fragment) play(playing *atomic.Bool, elapsedTimeCallback func(time.Dura
 	return nil
 }
 
+// setIndex passes the previously built seek table of the source to the decoder, if the decoder uses it
+func (f *Fragment) setIndex(index decoder.Index) {
+	f.Lock()
+	defer f.Unlock()
+	if indexer, ok := f.dec.(decoder.Indexer); ok && index != nil {
+		indexer.SetIndex(index)
+	}
+}
+
+// index returns the seek table of the decoder, or nil if it has not been built
+func (f *Fragment) index() decoder.Index {
+	f.Lock()
+	defer f.Unlock()
+	if indexer, ok := f.dec.(decoder.Indexer); ok {
+		return indexer.Index()
+	}
+	return nil
+}
+
+func (f *Fragment) setSink(wp AudioSink) {
+	f.Lock()
+	defer f.Unlock()
+	f.wp = wp
+}
+
 func (f *Fragment) setSpeed(speed float64) {
 	f.Lock()
 	defer f.Unlock()
 	f.stream.SetSpeed(speed)
 }
 
+func (f *Fragment) setPitch(pitch float64) {
+	f.Lock()
+	defer f.Unlock()
+	f.stream.SetPitch(pitch)
+}
+
 func (f *Fragment) setVolume(volume float64) {
 	f.Lock()
 	defer f.Unlock()
-	f.stream.SetVolume(volume)
+	f.volume = volume
+	f.updateGain()
+}
+
+// setFade sets the multiplier of the volume from 0 to 1
+func (f *Fragment) setFade(fade float64) {
+	f.Lock()
+	defer f.Unlock()
+	f.fade = fade
+	f.updateGain()
+}
+
+// setNormalizationGain sets the gain in dB that brings the fragment to the target loudness
+func (f *Fragment) setNormalizationGain(gain float64) {
+	f.Lock()
+	defer f.Unlock()
+	f.normGain = gain
+	f.updateGain()
+}
+
+// updateGain passes the resulting gain to the limiter. Must be called with the fragment locked
+func (f *Fragment) updateGain() {
+	f.limiter.SetGain(f.volume * f.fade * math.Pow(10, f.normGain/20))
+}
+
+// measuredLoudness returns the loudness of the fragment in LUFS, if it has been played completely from the beginning
+func (f *Fragment) measuredLoudness() (float64, bool) {
+	f.Lock()
+	defer f.Unlock()
+	return f.loudness, f.measured
+}
+
+// setSkipSilence enables or disables removing of the long pauses. threshold is the level of silence in dBFS
+func (f *Fragment) setSkipSilence(enabled bool, threshold float64, minPause time.Duration) {
+	f.Lock()
+	defer f.Unlock()
+	f.skipper.enabled = enabled
+	f.skipper.setParams(threshold, minPause, f.pcmBytesPerSec)
+}
+
+func (f *Fragment) setEqualizer(bands []equalizer.Band) {
+	f.Lock()
+	defer f.Unlock()
+	f.eq.SetBands(bands)
 }
 
 func (f *Fragment) SetPosition(pos time.Duration) error {
@@ -135,8 +250,11 @@ func (f *Fragment) SetPosition(pos time.Duration) error {
 		return nil
 	}
 
-	f.wp.Stop()
-	f.willBeStopped = true
+	if f.wp != nil {
+		// Data already sent to the sink belongs to the old position
+		f.wp.Stop()
+		f.willBeStopped = true
+	}
 	f.stream.Flush()
 	io.ReadAll(f.stream)
 
@@ -145,6 +263,11 @@ func (f *Fragment) SetPosition(pos time.Duration) error {
 	if err != nil {
 		return err
 	}
+	f.skipper.reset()
+	f.eq.Reset()
+	f.limiter.Reset()
+	// The fragment is not played completely, so its loudness can't be measured
+	f.meter = nil
 
 	f.pos = pos
 	return nil
@@ -175,22 +298,18 @@ func (f *Fragment) IsPause() bool {
 	return f.paused
 }
 
-func (f *Fragment) SetOutputDevice(devName string) error {
-	return f.wp.SetOutputDevice(devName)
-}
-
-func (f *Fragment) stop() {
-	f.wp.Stop()
-}
-
+// Close releases the decoder and the sonic stream. The audio sink is owned by the player and remains open
 func (f *Fragment) Close() error {
 	f.Lock()
 	defer f.Unlock()
-	f.wp.Stop()
-	err := f.wp.Close()
 	f.stream.Flush()
 	io.ReadAll(f.stream)
 	f.stream = nil
 	f.dec = nil
-	return err
+	f.skipper = nil
+	f.eq = nil
+	f.limiter = nil
+	f.meter = nil
+	f.wp = nil
+	return nil
 }
@@ -0,0 +1,122 @@
+package player
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	LoopStartNotMarked = errors.New("loop start is not marked")
+	InvalidLoop        = errors.New("loop end must be after its start")
+)
+
+// Loop is a passage of the book that is played repeatedly. The passage can span several fragments
+type Loop struct {
+	StartFragment int
+	Start         time.Duration
+	EndFragment   int
+	End           time.Duration
+}
+
+func (l Loop) valid(fragments int) bool {
+	if l.StartFragment < 0 || l.EndFragment >= fragments {
+		return false
+	}
+	return l.EndFragment > l.StartFragment || (l.EndFragment == l.StartFragment && l.End > l.Start)
+}
+
+// MarkLoopStart remembers the current position as the beginning of the next loop
+func (p *Player) MarkLoopStart() {
+	p.Lock()
+	defer p.Unlock()
+	p.loopMark = Loop{StartFragment: p.fragmentIndex, Start: p.position()}
+	p.loopMarked = true
+	p.logger.Debug("Loop start marked at fragment %v, position %v", p.loopMark.StartFragment, p.loopMark.Start)
+}
+
+// MarkLoopEnd uses the current position as the end of the loop, whose beginning was marked before, and starts the loop
+func (p *Player) MarkLoopEnd() error {
+	p.Lock()
+	defer p.Unlock()
+	if !p.loopMarked {
+		return LoopStartNotMarked
+	}
+	loop := p.loopMark
+	loop.EndFragment = p.fragmentIndex
+	loop.End = p.position()
+	return p.setLoop(loop)
+}
+
+// SetLoop starts playing the loop from its beginning
+func (p *Player) SetLoop(loop Loop) error {
+	p.Lock()
+	defer p.Unlock()
+	return p.setLoop(loop)
+}
+
+func (p *Player) setLoop(loop Loop) error {
+	if !loop.valid(len(p.playList)) {
+		return InvalidLoop
+	}
+	p.loop = loop
+	p.looping = true
+	p.loopPlayed = 1
+	p.loopMarked = false
+	p.logger.Debug("Loop set to %+v", loop)
+	p.moveTo(loop.StartFragment, loop.Start)
+	return nil
+}
+
+// Loop returns the loop that is being played
+func (p *Player) Loop() (Loop, bool) {
+	p.Lock()
+	defer p.Unlock()
+	return p.loop, p.looping
+}
+
+// CancelLoop stops repeating the loop. Playback continues from the current position
+func (p *Player) CancelLoop() {
+	p.Lock()
+	defer p.Unlock()
+	p.looping = false
+	p.loopMarked = false
+}
+
+// SetLoopRepeat sets how many times the loop is played and the pause between repeats. Zero count means the loop is played until it is cancelled
+func (p *Player) SetLoopRepeat(count int, pause time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.loopCount = count
+	p.loopPause = pause
+}
+
+// loopEndReached reports whether the position in the fragment with the specified index is beyond the end of the loop.
+// Must be called with the player locked
+func (p *Player) loopEndReached(index int, pos time.Duration) bool {
+	if !p.looping {
+		return false
+	}
+	return index > p.loop.EndFragment || (index == p.loop.EndFragment && pos >= p.loop.End)
+}
+
+// waitLoopRepeat waits until the end of the loop has been played and the pause between repeats has passed
+func (p *Player) waitLoopRepeat(sink AudioSink, pause time.Duration) {
+	sink.Sync()
+	for end := time.Now().Add(pause); p.playing.Load() && time.Now().Before(end); {
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// repeatLoop moves to the beginning of the loop, or finishes the loop after the last repeat. Must be called with the player locked
+func (p *Player) repeatLoop() {
+	if !p.looping {
+		return
+	}
+	if p.loopCount > 0 && p.loopPlayed >= p.loopCount {
+		p.looping = false
+		p.logger.Debug("Loop finished after %v repeats", p.loopPlayed)
+		return
+	}
+	p.loopPlayed++
+	p.moveTo(p.loop.StartFragment, p.loop.Start)
+}
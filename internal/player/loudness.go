@@ -0,0 +1,161 @@
+package player
+
+import (
+	"context"
+	"io"
+	"math"
+	"path/filepath"
+
+	"github.com/kvark128/OnlineLibrary/internal/loudness"
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"github.com/kvark128/dodp"
+)
+
+const (
+	DEFAULT_LOUDNESS_TARGET = -18.0 // LUFS
+	// Maximum gain in dB by which the loudness of a fragment is corrected
+	MAX_NORMALIZATION_GAIN = 12.0
+)
+
+func (p *Player) Normalization() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.normalize
+}
+
+// SetNormalization enables or disables bringing the fragments to the target loudness in LUFS
+func (p *Player) SetNormalization(enabled bool, target float64) {
+	p.Lock()
+	defer p.Unlock()
+	if target >= 0 {
+		target = DEFAULT_LOUDNESS_TARGET
+	}
+	p.normalize = enabled
+	p.loudnessTarget = target
+	if p.fragment != nil {
+		p.fragment.setNormalizationGain(p.normalizationGain(p.playList[p.fragmentIndex].LocalURI))
+	}
+	if enabled && p.playing.Load() {
+		// Loudness of the local resources is analyzed by the probe
+		p.startProbe()
+	}
+}
+
+// SetLoudness sets the previously measured loudness of the resources, by their local URI
+func (p *Player) SetLoudness(values map[string]float64) {
+	p.Lock()
+	defer p.Unlock()
+	for _, r := range p.playList {
+		if lufs, ok := values[r.LocalURI]; ok {
+			p.loudness[r.LocalURI] = lufs
+		}
+	}
+}
+
+// Loudness returns the measured loudness of the resources, by their local URI
+func (p *Player) Loudness() map[string]float64 {
+	p.Lock()
+	defer p.Unlock()
+	values := make(map[string]float64, len(p.loudness))
+	for uri, lufs := range p.loudness {
+		values[uri] = lufs
+	}
+	return values
+}
+
+// normalizationGain returns the gain in dB for the resource with the specified local URI.
+// Resources that have not been measured yet are corrected by the loudness of the measured part of the book
+func (p *Player) normalizationGain(uri string) float64 {
+	if !p.normalize {
+		return 0
+	}
+	lufs, ok := p.loudness[uri]
+	if !ok {
+		if lufs, ok = p.bookLoudness(); !ok {
+			return 0
+		}
+	}
+	gain := p.loudnessTarget - lufs
+	return math.Max(math.Min(gain, MAX_NORMALIZATION_GAIN), -MAX_NORMALIZATION_GAIN)
+}
+
+// bookLoudness returns the loudness of the measured resources, weighted by their durations
+func (p *Player) bookLoudness() (float64, bool) {
+	var energy, weight float64
+	for i, r := range p.playList {
+		lufs, ok := p.loudness[r.LocalURI]
+		if !ok {
+			continue
+		}
+		w := p.fragmentDuration(i).Seconds()
+		if w == 0 {
+			w = 1
+		}
+		energy += w * math.Pow(10, lufs/10)
+		weight += w
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return 10 * math.Log10(energy/weight), true
+}
+
+// analyzeLoudness measures the loudness of the local resources by decoding them completely.
+// Remote resources are measured while they are played
+func (p *Player) analyzeLoudness(ctx context.Context) {
+	for _, r := range p.playList {
+		p.Lock()
+		_, known := p.loudness[r.LocalURI]
+		enabled := p.normalize
+		p.Unlock()
+		if !enabled {
+			return
+		}
+		if known {
+			continue
+		}
+
+		lufs, ok, err := p.analyzeResource(ctx, r)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.logger.Warning("Analyzing loudness of %v: %v", r.LocalURI, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		p.Lock()
+		p.loudness[r.LocalURI] = lufs
+		p.Unlock()
+		p.logger.Debug("Loudness of %v: %.1f LUFS", r.LocalURI, lufs)
+	}
+}
+
+func (p *Player) analyzeResource(ctx context.Context, r dodp.Resource) (float64, bool, error) {
+	if !util.FileIsExist(filepath.Join(p.bookDir, r.LocalURI), r.Size) {
+		return 0, false, nil
+	}
+	src, dec, err := p.openDecoder(ctx, r)
+	if err != nil {
+		return 0, false, err
+	}
+	defer src.Close()
+
+	meter := loudness.NewMeter(dec.SampleRate(), dec.Channels())
+	buf := make([]byte, 1024*64)
+	for ctx.Err() == nil {
+		n, err := dec.Read(buf)
+		meter.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	lufs, ok := meter.Integrated()
+	return lufs, ok, nil
+}
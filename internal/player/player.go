@@ -1,18 +1,19 @@
 package player
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/kvark128/OnlineLibrary/internal/cache"
 	"github.com/kvark128/OnlineLibrary/internal/connection"
-	"github.com/kvark128/OnlineLibrary/internal/gui"
-	"github.com/kvark128/OnlineLibrary/internal/lkf"
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
+	"github.com/kvark128/OnlineLibrary/internal/equalizer"
 	"github.com/kvark128/OnlineLibrary/internal/log"
 	"github.com/kvark128/OnlineLibrary/internal/util"
 	"github.com/kvark128/OnlineLibrary/internal/util/buffer"
@@ -25,105 +26,144 @@ const (
 	MAX_SPEED     = 3.0
 	STEP_SPEED    = 0.1
 
+	DEFAULT_PITCH = 1.0
+	MIN_PITCH     = 0.5
+	MAX_PITCH     = 2.0
+	STEP_PITCH    = 0.05
+
 	DEFAULT_VOLUME = 0.8
 	MIN_VOLUME     = 0.08
 	MAX_VOLUME     = 1.6
 	STEP_VOLUME    = 0.08
 )
 
-// Extensions of supported formats
-const (
-	LKF_EXT = ".lkf"
-	MP3_EXT = ".mp3"
-)
-
 // Error returned when stopping playback at user request
 var PlaybackStopped = fmt.Errorf("playback stopped")
 
 type Player struct {
-	logger    *log.Logger
-	statusBar *gui.StatusBar
+	logger *log.Logger
 	sync.Mutex
-	playList      []dodp.Resource
-	playListSize  int64
-	bookDir       string
-	playing       *atomic.Bool
-	wg            *sync.WaitGroup
-	fragment      *Fragment
-	outputDevice  string
-	speed         float64
-	volume        float64
-	fragmentIndex int
-	offset        time.Duration
-	timerDuration time.Duration
-	pauseTimer    *time.Timer
-}
-
-func NewPlayer(bookDir string, resources []dodp.Resource, outputDevice string, logger *log.Logger, statusBar *gui.StatusBar) *Player {
+	playList       []dodp.Resource
+	bookDir        string
+	playing        *atomic.Bool
+	wg             *sync.WaitGroup
+	fragment       *Fragment
+	outputDevice   string
+	newSink        SinkFactory
+	sink           AudioSink
+	sinkChannels   int
+	sinkSampleRate int
+	speed          float64
+	pitch          float64
+	volume         float64
+	skipSilence    bool
+	eqBands        []equalizer.Band
+	normalize      bool
+	// Target loudness in LUFS
+	loudnessTarget float64
+	// Measured loudness of resources in LUFS, by resource local URI
+	loudness map[string]float64
+	// Level of silence in dBFS and the length to which long pauses are shortened
+	silenceThreshold float64
+	silenceMinPause  time.Duration
+	fragmentIndex    int
+	offset           time.Duration
+	timer            Timer
+	// Closed to stop the running timer. Nil if the timer is not running
+	timerStop chan struct{}
+	// Moment at which the running timer expires in the duration mode
+	timerDeadline time.Time
+	// Index of the chapter at which the running timer expires in the chapter modes
+	timerChapter int
+	// Multiplier of the volume while the timer fades out the playback
+	fade float64
+	// Rules of the smart rewind, sorted by the length of the pause
+	rewindRules []RewindRule
+	// Moment at which the current fragment was paused
+	pausedAt time.Time
+	// Loop being played, and the beginning of the next loop marked by the user
+	loop       Loop
+	looping    bool
+	loopMark   Loop
+	loopMarked bool
+	// Number of times the loop is played, the pause between repeats and the number of times it has already been played
+	loopCount  int
+	loopPause  time.Duration
+	loopPlayed int
+	// The sound is playing. Changes are reported to the observers
+	active bool
+	// Observers of the playback events by their ids, and the events waiting to be delivered to them
+	observers    map[int]PlaybackObserver
+	nextObserver int
+	events       []Event
+	dispatching  bool
+	// Size of the read-ahead buffer for streamed fragments in bytes, or in time if the duration of the fragment is known
+	readAheadBytes int64
+	readAheadTime  time.Duration
+	// Limiters of the streaming rate
+	limiters []*connection.Limiter
+	// Transport of the service from which the fragments are streamed. Nil means the default transport
+	transport *connection.Transport
+	// Cache in which the fragments streamed from the network are kept. Nil if the cache is not used
+	cache *cache.Cache
+	// Seek tables of resources that have already been built, by resource local URI
+	indexes map[string]decoder.Index
+	// Embedded chapters of resources that have already been opened, by resource local URI
+	chapters map[string][]decoder.Chapter
+	// Measured durations of resources. Zero value means that the duration is not known yet
+	durations []time.Duration
+	// Cached result of byterate. It is invalidated whenever the durations change
+	byterateCache float64
+	byterateValid bool
+	probeCtx      context.Context
+	probeCancel   context.CancelFunc
+}
+
+func NewPlayer(bookDir string, resources []dodp.Resource, outputDevice string, newSink SinkFactory, logger *log.Logger) *Player {
 	p := &Player{
-		logger:       logger,
-		statusBar:    statusBar,
-		playing:      new(atomic.Bool),
-		wg:           new(sync.WaitGroup),
-		bookDir:      bookDir,
-		speed:        DEFAULT_SPEED,
-		volume:       DEFAULT_VOLUME,
-		outputDevice: outputDevice,
-	}
-
-	// Player supports only LKF and MP3 resources. Unsupported resources must not be uploaded to the player
-	// Some services specify an incorrect r.MimeType value, so we check the resource type by extension from the r.LocalURI field
+		logger:           logger,
+		observers:        make(map[int]PlaybackObserver),
+		playing:          new(atomic.Bool),
+		wg:               new(sync.WaitGroup),
+		bookDir:          bookDir,
+		speed:            DEFAULT_SPEED,
+		pitch:            DEFAULT_PITCH,
+		volume:           DEFAULT_VOLUME,
+		fade:             1,
+		silenceThreshold: DEFAULT_SILENCE_THRESHOLD,
+		silenceMinPause:  DEFAULT_SILENCE_MIN_PAUSE,
+		outputDevice:     outputDevice,
+		newSink:          newSink,
+		indexes:          make(map[string]decoder.Index),
+		chapters:         make(map[string][]decoder.Chapter),
+		loudnessTarget:   DEFAULT_LOUDNESS_TARGET,
+		loudness:         make(map[string]float64),
+	}
+
+	// Unsupported resources must not be uploaded to the player
 	for _, r := range resources {
-		ext := strings.ToLower(filepath.Ext(r.LocalURI))
-		if ext == LKF_EXT || ext == MP3_EXT {
+		if decoder.Supported(r.LocalURI, r.MimeType) {
 			p.playList = append(p.playList, r)
-			p.playListSize += r.Size
 		}
 	}
+	p.durations = make([]time.Duration, len(p.playList))
 
 	return p
 }
 
-func (p *Player) SetTimerDuration(d time.Duration) {
-	p.Lock()
-	defer p.Unlock()
-	p.timerDuration = d
-	p.logger.Debug("Playback timer set to %v", d)
-	if p.playing.Load() && p.fragment != nil && !p.fragment.IsPause() {
-		p.updateTimer(p.timerDuration)
-	}
-}
-
-func (p *Player) TimerDuration() time.Duration {
-	p.Lock()
-	defer p.Unlock()
-	return p.timerDuration
-}
-
-func (p *Player) updateTimer(d time.Duration) {
-	if p.pauseTimer != nil {
-		p.pauseTimer.Stop()
-		p.pauseTimer = nil
-		p.logger.Debug("Playback timer stopped")
-	}
-	if d > 0 {
-		p.pauseTimer = time.AfterFunc(d, func() { p.Pause(true) })
-		p.logger.Debug("Playback timer started on %v", d)
-	}
-}
-
 func (p *Player) Position() time.Duration {
 	p.Lock()
 	defer p.Unlock()
-	if p.fragment != nil {
-		return p.fragment.Position()
-	}
-	return p.offset
+	return p.position()
 }
 
 func (p *Player) SetPosition(pos time.Duration) {
 	p.Lock()
 	defer p.Unlock()
+	p.setPosition(pos)
+}
+
+func (p *Player) setPosition(pos time.Duration) {
 	if !p.playing.Load() {
 		p.offset = pos
 		return
@@ -133,7 +173,7 @@ func (p *Player) SetPosition(pos time.Duration) {
 			p.logger.Error("Set fragment position: %v", err)
 			return
 		}
-		p.statusBar.SetElapsedTime(p.fragment.Position())
+		p.emit(EventPosition, nil)
 	}
 }
 
@@ -173,11 +213,34 @@ func (p *Player) SetOutputDevice(outputDevice string) {
 		return
 	}
 	p.outputDevice = outputDevice
-	if p.fragment != nil {
-		p.fragment.SetOutputDevice(p.outputDevice)
+	if p.sink != nil {
+		if err := p.sink.SetOutputDevice(p.outputDevice); err != nil {
+			p.logger.Warning("Set output device: %v", err)
+		}
 	}
 }
 
+// SetLimiters restricts the rate of streaming by the limiters. The fragments that are already opened are not affected
+func (p *Player) SetLimiters(limiters ...*connection.Limiter) {
+	p.Lock()
+	defer p.Unlock()
+	p.limiters = limiters
+}
+
+// SetTransport sets the transport through which the fragments are streamed
+func (p *Player) SetTransport(t *connection.Transport) {
+	p.Lock()
+	defer p.Unlock()
+	p.transport = t
+}
+
+// SetCache sets the cache in which the fragments streamed from the network are kept
+func (p *Player) SetCache(c *cache.Cache) {
+	p.Lock()
+	defer p.Unlock()
+	p.cache = c
+}
+
 func (p *Player) Speed() float64 {
 	p.Lock()
 	defer p.Unlock()
@@ -199,6 +262,27 @@ func (p *Player) SetSpeed(speed float64) {
 	}
 }
 
+func (p *Player) Pitch() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.pitch
+}
+
+func (p *Player) SetPitch(pitch float64) {
+	p.Lock()
+	defer p.Unlock()
+	switch {
+	case pitch < MIN_PITCH:
+		pitch = MIN_PITCH
+	case pitch > MAX_PITCH:
+		pitch = MAX_PITCH
+	}
+	p.pitch = pitch
+	if p.fragment != nil {
+		p.fragment.setPitch(p.pitch)
+	}
+}
+
 func (p *Player) Volume() float64 {
 	p.Lock()
 	defer p.Unlock()
@@ -220,6 +304,16 @@ func (p *Player) SetVolume(volume float64) {
 	}
 }
 
+// SetEqualizer sets the bands of the equalizer. With no bands the equalizer is disabled
+func (p *Player) SetEqualizer(bands []equalizer.Band) {
+	p.Lock()
+	defer p.Unlock()
+	p.eqBands = bands
+	if p.fragment != nil {
+		p.fragment.setEqualizer(p.eqBands)
+	}
+}
+
 func (p *Player) Pause(state bool) bool {
 	p.Lock()
 	defer p.Unlock()
@@ -231,10 +325,10 @@ func (p *Player) Pause(state bool) bool {
 		return true
 	}
 	if p.fragment != nil {
-		p.updateTimer(0)
-		ok := p.fragment.pause(state)
+		p.stopTimer()
+		ok := p.pauseFragment(state)
 		if !p.fragment.IsPause() {
-			p.updateTimer(p.timerDuration)
+			p.startTimer()
 		}
 		return ok
 	}
@@ -251,26 +345,210 @@ func (p *Player) Stop() {
 	p.Lock()
 	defer p.Unlock()
 	p.stopPlayback()
+	p.stopProbe()
 }
 
 func (p *Player) startPlayback() {
+	p.startProbe()
 	go p.playback(p.fragmentIndex)
 }
 
 func (p *Player) stopPlayback() {
 	p.playing.Store(false)
 	p.offset = 0
-	if p.fragment != nil {
-		p.fragment.stop()
+	if p.sink != nil {
+		p.sink.Stop()
 	}
 }
 
-func (p *Player) sizeof(rsrc []dodp.Resource) int64 {
-	var size int64
-	for _, r := range rsrc {
-		size += r.Size
+// Fragment that was opened in advance and is waiting for its turn to play
+type preparedFragment struct {
+	index    int
+	src      io.Closer
+	fragment *Fragment
+	err      error
+}
+
+func (pf *preparedFragment) Close() {
+	if pf.fragment != nil {
+		pf.fragment.Close()
+	}
+	if pf.src != nil {
+		pf.src.Close()
+	}
+}
+
+// configureFragment applies the current playback settings to the fragment of the resource with the specified local URI.
+// Must be called with the player locked
+func (p *Player) configureFragment(fragment *Fragment, uri string) {
+	fragment.setSpeed(p.speed)
+	fragment.setPitch(p.pitch)
+	fragment.setVolume(p.volume)
+	fragment.setFade(p.fade)
+	fragment.setNormalizationGain(p.normalizationGain(uri))
+	fragment.setEqualizer(p.eqBands)
+	fragment.setSkipSilence(p.skipSilence, p.silenceThreshold, p.silenceMinPause)
+}
+
+// saveIndex caches the seek table of the fragment, so it does not need to be built again when the resource is reopened
+func (p *Player) saveIndex(uri string, fragment *Fragment) {
+	if index := fragment.index(); index != nil {
+		p.Lock()
+		p.indexes[uri] = index
+		p.setDuration(uri, index.Duration())
+		p.Unlock()
+	}
+}
+
+// prepareFragment opens the fragment with the specified index in the background
+func (p *Player) prepareFragment(index int, pos time.Duration) <-chan *preparedFragment {
+	result := make(chan *preparedFragment, 1)
+	go func() {
+		pf := &preparedFragment{index: index}
+		pf.fragment, pf.src, pf.err = p.openFragment(index, pos)
+		result <- pf
+	}()
+	return result
+}
+
+func (p *Player) openFragment(index int, pos time.Duration) (*Fragment, io.Closer, error) {
+	r := p.playList[index]
+	p.logger.Debug("Fetching resource: %v\r\nMimeType: %v\r\nSize: %v", r.LocalURI, r.MimeType, r.Size)
+
+	var src io.ReadSeekCloser
+	localPath := filepath.Join(p.bookDir, r.LocalURI)
+	local := util.FileIsExist(localPath, r.Size)
+
+	if local {
+		// The fragment already exists on the local disk
+		// We must use it to avoid making network requests
+		var err error
+		src, err = os.Open(localPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting a local fragment: %w", err)
+		}
+		p.logger.Debug("Opening local fragment from %v", localPath)
+	} else {
+		// There is no fragment on the local disc. Trying to get it from the network
+		p.Lock()
+		transport := p.transport
+		p.Unlock()
+		conn, err := connection.NewConnection(r.URI, transport, p.logger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getting a remote fragment: %w", err)
+		}
+		p.Lock()
+		conn.SetLimiters(p.limiters...)
+		p.Unlock()
+		src = conn
+		p.logger.Debug("Fetching fragment by network from %v", r.URI)
+	}
+
+	p.Lock()
+	c := p.cache
+	readAhead := p.readAheadSize(index)
+	p.Unlock()
+	if c != nil {
+		if local {
+			c.Used(localPath)
+		} else {
+			// The fragment read to the end is kept in the book directory, so next time it is opened from the local disk
+			src = c.Tee(src, filepath.Base(p.bookDir), r.LocalURI, localPath, r.Size)
+		}
+	}
+
+	// The streamed fragment is read ahead in the background, so network stalls do not interrupt the sound
+	var ra *buffer.ReadAhead
+	var rs io.ReadSeeker = buffer.NewReader(src)
+	if !local && readAhead > 0 {
+		ra = buffer.NewReadAhead(src, readAhead)
+		src, rs = ra, ra
+	}
+
+	fragment, err := func(rs io.ReadSeeker) (*Fragment, error) {
+		dec, err := decoder.Open(r.LocalURI, r.MimeType, decoder.Source{ReadSeeker: rs, Size: r.Size, Local: local})
+		if err != nil {
+			return nil, fmt.Errorf("opening a decoder: %w", err)
+		}
+		p.saveChapters(r.LocalURI, dec)
+
+		fragment, err := NewFragment(dec)
+		if err != nil {
+			return nil, fmt.Errorf("creating a new fragment: %w", err)
+		}
+
+		fragment.readAhead = ra
+
+		p.Lock()
+		fragment.setIndex(p.indexes[r.LocalURI])
+		p.Unlock()
+
+		if err := fragment.SetPosition(pos); err != nil {
+			fragment.Close()
+			return nil, fmt.Errorf("setting fragment position: %w", err)
+		}
+		p.saveIndex(r.LocalURI, fragment)
+
+		p.Lock()
+		p.configureFragment(fragment, r.LocalURI)
+		p.Unlock()
+		return fragment, nil
+	}(rs)
+
+	if err != nil {
+		src.Close()
+		return nil, nil, err
+	}
+	return fragment, src, nil
+}
+
+// setSink connects the fragment to the audio output device.
+// The current device is reused if it supports the fragment format. Otherwise it is replaced by a new one
+func (p *Player) setSink(fragment *Fragment) error {
+	p.Lock()
+	if p.sink != nil && p.sinkChannels == fragment.channels && p.sinkSampleRate == fragment.sampleRate {
+		fragment.setSink(p.sink)
+		p.Unlock()
+		return nil
+	}
+	p.Unlock()
+
+	// The previous fragment must be played to the end before changing the device
+	p.closeSink()
+	if !p.playing.Load() {
+		return PlaybackStopped
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	sink, err := p.newSink(fragment.channels, fragment.sampleRate, 16, fragment.wpBufSize, p.outputDevice)
+	if err != nil {
+		return err
+	}
+	p.sink = sink
+	p.sinkChannels = fragment.channels
+	p.sinkSampleRate = fragment.sampleRate
+	fragment.setSink(sink)
+	return nil
+}
+
+// closeSink waits until the remaining audio data is played and closes the device.
+// While waiting, the device is still available to Stop, so the user can interrupt it
+func (p *Player) closeSink() {
+	p.Lock()
+	sink := p.sink
+	p.Unlock()
+	if sink == nil {
+		return
+	}
+
+	sink.Sync()
+	p.Lock()
+	defer p.Unlock()
+	p.sink = nil
+	if err := sink.Close(); err != nil {
+		p.logger.Warning("Closing audio sink: %v", err)
 	}
-	return size
 }
 
 func (p *Player) playback(startFragment int) {
@@ -281,89 +559,116 @@ func (p *Player) playback(startFragment int) {
 	p.wg.Add(1)
 	p.playing.Store(true)
 	defer p.wg.Done()
-	defer p.playing.Store(false)
 
-	p.updateTimer(p.timerDuration)
-	defer p.updateTimer(0)
+	p.Lock()
+	p.startTimer()
+	p.Unlock()
+
+	// Error that ended playback. Without an error the book has been played to the end
+	var result error
+	defer func() {
+		p.Lock()
+		defer p.Unlock()
+		p.playing.Store(false)
+		p.stopTimer()
+		p.active = false
+		switch result {
+		case nil:
+			p.emit(EventFinished, nil)
+		case PlaybackStopped:
+			p.emit(EventStopped, nil)
+		default:
+			p.emit(EventError, result)
+		}
+	}()
 
-	for index, r := range p.playList[startFragment:] {
-		p.logger.Debug("Fetching resource: %v\r\nMimeType: %v\r\nSize: %v", r.LocalURI, r.MimeType, r.Size)
+	defer p.closeSink()
 
-		err := func(r dodp.Resource) error {
-			var src io.ReadSeekCloser
-			localPath := filepath.Join(p.bookDir, r.LocalURI)
+	next := p.prepareFragment(startFragment, p.Position())
+	defer func() {
+		// The fragment prepared in advance is no longer needed
+		if next != nil {
+			go func(next <-chan *preparedFragment) { (<-next).Close() }(next)
+		}
+	}()
 
-			if util.FileIsExist(localPath, r.Size) {
-				// The fragment already exists on the local disk
-				// We must use it to avoid making network requests
-				var err error
-				src, err = os.Open(localPath)
-				if err != nil {
-					return fmt.Errorf("getting a local fragment: %w", err)
-				}
-				p.logger.Debug("Opening local fragment from %v", localPath)
-			} else {
-				// There is no fragment on the local disc. Trying to get it from the network
-				var err error
-				src, err = connection.NewConnection(r.URI, p.logger)
-				if err != nil {
-					return fmt.Errorf("getting a remote fragment: %w", err)
-				}
-				p.logger.Debug("Fetching fragment by network from %v", r.URI)
-			}
-			defer src.Close()
+	for next != nil {
+		pf := <-next
+		next = nil
+		r := p.playList[pf.index]
 
-			fragment, err := func(src io.ReadSeeker) (*Fragment, error) {
-				src = buffer.NewReader(src)
-				if strings.ToLower(filepath.Ext(r.LocalURI)) == LKF_EXT {
-					src = lkf.NewReader(src)
-				}
+		err := func(pf *preparedFragment) error {
+			defer pf.Close()
+			if pf.err != nil {
+				return pf.err
+			}
+			fragment := pf.fragment
+			defer p.saveIndex(r.LocalURI, fragment)
 
-				fragment, err := NewFragment(src, p.OutputDevice())
-				if err != nil {
-					return nil, fmt.Errorf("creating a new fragment: %w", err)
-				}
+			// Fragment creation is an I/O operation and can be time consuming. We have to check that the fragment was not stopped by the user
+			if !p.playing.Load() {
+				return PlaybackStopped
+			}
 
-				if err := fragment.SetPosition(p.Position()); err != nil {
-					return nil, fmt.Errorf("setting fragment position: %w", err)
+			if err := p.setSink(fragment); err != nil {
+				if err == PlaybackStopped {
+					return err
 				}
+				return fmt.Errorf("opening audio sink: %w", err)
+			}
 
-				fragment.setSpeed(p.Speed())
-				fragment.setVolume(p.Volume())
-				return fragment, nil
-			}(src)
-
-			if err != nil {
-				return err
+			// While this fragment is playing, the next one is being prepared
+			if pf.index+1 < len(p.playList) {
+				next = p.prepareFragment(pf.index+1, 0)
 			}
-			defer fragment.Close()
 
-			// Fragment creation is an I/O operation and can be time consuming. We have to check that the fragment was not stopped by the user
+			p.Lock()
 			if !p.playing.Load() {
+				// Playback was stopped while the audio sink was being opened
+				p.Unlock()
 				return PlaybackStopped
 			}
-
-			p.Lock()
 			p.fragment = fragment
-			p.fragmentIndex = startFragment + index
-			prevFragmentsSize := p.sizeof(p.playList[:p.fragmentIndex])
-			byterate := int64(p.fragment.Bitrate * 1000 / 8)
-			p.statusBar.SetElapsedTime(p.fragment.Position())
-			p.statusBar.SetTotalTime(time.Second * time.Duration(r.Size/byterate))
-			p.statusBar.SetFragments(p.fragmentIndex+1, len(p.playList))
+			p.fragmentIndex = pf.index
+			p.configureFragment(p.fragment, r.LocalURI)
 			p.offset = 0
+			p.setActive(true)
+			p.emit(EventFragmentChanged, nil)
 			p.Unlock()
 
 			elapsedTimeCallback := func(d time.Duration) {
-				prevSize := byterate * int64(d.Seconds())
-				percent := (prevFragmentsSize + prevSize) * 100 / p.playListSize
-				p.statusBar.SetElapsedTime(d)
-				p.statusBar.SetBookPercent(int(percent))
+				p.Lock()
+				if p.loopEndReached(pf.index, d) {
+					pause := p.loopPause
+					p.Unlock()
+					p.waitLoopRepeat(fragment.wp, pause)
+					p.Lock()
+					// While waiting, the user could move to another place of the book
+					if p.fragment == fragment {
+						p.repeatLoop()
+					}
+					p.Unlock()
+					return
+				}
+				if p.timerChapterReached(pf.index, d) {
+					// Nothing of the next chapter has been written to the sink yet. The end of the previous one must be heard before the pause
+					p.Unlock()
+					fragment.wp.Sync()
+					p.Lock()
+					if p.fragment == fragment && p.timerChapterReached(pf.index, d) {
+						p.expireTimer()
+					}
+				}
+				p.emit(EventPosition, nil)
+				p.Unlock()
 			}
 
-			err = fragment.play(p.playing, elapsedTimeCallback)
+			err := fragment.play(p.playing, elapsedTimeCallback)
 			p.Lock()
 			p.fragment = nil
+			if lufs, ok := fragment.measuredLoudness(); ok {
+				p.loudness[r.LocalURI] = lufs
+			}
 			p.Unlock()
 
 			if err != nil {
@@ -374,10 +679,11 @@ func (p *Player) playback(startFragment int) {
 				return PlaybackStopped
 			}
 			return nil
-		}(r)
+		}(pf)
 
 		if err != nil {
 			p.logger.Warning("Resource %v: %v", r.LocalURI, err)
+			result = err
 			break
 		}
 	}
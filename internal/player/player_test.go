@@ -0,0 +1,75 @@
+package player_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/log"
+	"github.com/kvark128/OnlineLibrary/internal/player"
+	"github.com/kvark128/OnlineLibrary/internal/sink"
+	"github.com/kvark128/dodp"
+)
+
+// writeSilence creates a WAV file with the silence of the specified length
+func writeSilence(t *testing.T, path string, d time.Duration) dodp.Resource {
+	t.Helper()
+	const sampleRate = 8000
+	wf, err := sink.NewWaveFile(path, 1, sampleRate, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wf.Write(make([]byte, int(d.Seconds()*sampleRate)*2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dodp.Resource{LocalURI: filepath.Base(path), MimeType: "audio/wav", Size: info.Size()}
+}
+
+func TestPlaybackThroughNullSink(t *testing.T) {
+	dir := t.TempDir()
+	rsrc := []dodp.Resource{
+		writeSilence(t, filepath.Join(dir, "01.wav"), time.Second),
+		writeSilence(t, filepath.Join(dir, "02.wav"), time.Second),
+	}
+
+	p := player.NewPlayer(dir, rsrc, "", sink.NullFactory, log.New(io.Discard, log.Error, ""))
+	done := make(chan player.Event, 1)
+	fragments := make(chan int, len(rsrc))
+	p.AddObserver(player.ObserverFunc(func(e player.Event) {
+		switch e.Type {
+		case player.EventFragmentChanged:
+			fragments <- e.State.Fragment
+		case player.EventFinished, player.EventError:
+			done <- e
+		}
+	}))
+	p.Pause(false)
+
+	select {
+	case e := <-done:
+		if e.Type != player.EventFinished {
+			t.Fatalf("playback ended with event %v: %v", e.Type, e.Err)
+		}
+	case <-time.After(time.Second * 10):
+		p.Stop()
+		t.Fatal("playback did not finish")
+	}
+
+	close(fragments)
+	var played []int
+	for f := range fragments {
+		played = append(played, f)
+	}
+	if len(played) != len(rsrc) || played[0] != 0 || played[1] != 1 {
+		t.Errorf("played fragments %v, want [0 1]", played)
+	}
+}
@@ -0,0 +1,30 @@
+package player
+
+import (
+	"time"
+)
+
+// SetReadAhead sets the size of the buffer into which the fragments streamed from the network are read in advance.
+// The time of playback is used if the duration of the fragment is known, and the size in bytes otherwise. Zero size and time turn the read-ahead off
+func (p *Player) SetReadAhead(size int64, d time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.readAheadBytes = size
+	p.readAheadTime = d
+}
+
+// readAheadSize returns the size of the read-ahead buffer for the fragment with the specified index in bytes. Must be called with the player locked
+func (p *Player) readAheadSize(index int) int {
+	r := p.playList[index]
+	size := p.readAheadBytes
+	if p.readAheadTime > 0 {
+		if d := p.fragmentDuration(index); d > 0 {
+			size = int64(float64(r.Size) * p.readAheadTime.Seconds() / d.Seconds())
+		}
+	}
+	// The buffer larger than the fragment is useless
+	if size > r.Size {
+		size = r.Size
+	}
+	return int(size)
+}
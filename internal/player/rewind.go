@@ -0,0 +1,98 @@
+package player
+
+import (
+	"sort"
+	"time"
+)
+
+// RewindRule sets the rewind on resume after a pause of the specified length.
+// Between the rules the rewind is interpolated, and after the longest pause it does not grow any more
+type RewindRule struct {
+	Pause  time.Duration
+	Rewind time.Duration
+}
+
+// Rules of the smart rewind that are used when the user has not set their own
+var DefaultRewindRules = []RewindRule{
+	{Pause: time.Second * 5, Rewind: time.Second * 2},
+	{Pause: time.Minute, Rewind: time.Second * 5},
+	{Pause: time.Minute * 10, Rewind: time.Second * 15},
+	{Pause: time.Hour, Rewind: time.Second * 30},
+}
+
+// SetRewindRules sets the rules of the smart rewind. With no rules the position is not changed on resume
+func (p *Player) SetRewindRules(rules []RewindRule) {
+	p.Lock()
+	defer p.Unlock()
+	p.rewindRules = append([]RewindRule(nil), rules...)
+	sort.Slice(p.rewindRules, func(i, j int) bool { return p.rewindRules[i].Pause < p.rewindRules[j].Pause })
+}
+
+// RewindAfter returns the rewind for a pause of the specified length
+func (p *Player) RewindAfter(pause time.Duration) time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.rewindAfter(pause)
+}
+
+func (p *Player) rewindAfter(pause time.Duration) time.Duration {
+	rules := p.rewindRules
+	if len(rules) == 0 || pause < rules[0].Pause {
+		return 0
+	}
+	for i := 1; i < len(rules); i++ {
+		prev, next := rules[i-1], rules[i]
+		if pause < next.Pause {
+			k := float64(pause-prev.Pause) / float64(next.Pause-prev.Pause)
+			return prev.Rewind + time.Duration(k*float64(next.Rewind-prev.Rewind))
+		}
+	}
+	return rules[len(rules)-1].Rewind
+}
+
+// Rewind moves the position back by the specified time. If the current fragment is too short, the rewind continues into the previous ones
+func (p *Player) Rewind(d time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	p.rewind(d)
+}
+
+func (p *Player) rewind(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	index, pos := p.fragmentIndex, p.position()-d
+	for pos < 0 && index > 0 {
+		duration := p.fragmentDuration(index - 1)
+		if duration == 0 {
+			// Durations are unknown. The rewind stops at the beginning of the current fragment
+			break
+		}
+		index--
+		pos += duration
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	p.logger.Debug("Rewinding by %v to fragment %v, position %v", d, index, pos)
+	p.moveTo(index, pos)
+}
+
+// pauseFragment pauses or resumes the current fragment. On resume the position is rewound according to the length of the pause.
+// Must be called with the player locked
+func (p *Player) pauseFragment(state bool) bool {
+	if !p.fragment.pause(state) {
+		return false
+	}
+	p.setActive(!state)
+	if state {
+		p.pausedAt = time.Now()
+		return true
+	}
+	if !p.pausedAt.IsZero() {
+		// The fragment is already resumed, so moving to another fragment restarts playback from an unpaused device
+		p.rewind(p.rewindAfter(time.Since(p.pausedAt)))
+		p.pausedAt = time.Time{}
+	}
+	return true
+}
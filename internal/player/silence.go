@@ -0,0 +1,137 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	DEFAULT_SILENCE_THRESHOLD = -40.0 // dBFS
+	DEFAULT_SILENCE_MIN_PAUSE = time.Millisecond * 300
+)
+
+// Audio data is analyzed by windows of this duration
+const silenceWindow = time.Millisecond * 10
+
+// silenceSkipper removes the long pauses from the 16-bit PCM stream.
+// Pauses shorter than minPause are passed unchanged, longer ones are shortened to minPause.
+type silenceSkipper struct {
+	src       io.Reader
+	enabled   bool
+	threshold int
+	minPause  int64
+	window    []byte
+	out       []byte
+	silence   int64
+	consumed  int64
+	lastErr   error
+}
+
+func newSilenceSkipper(src io.Reader, sampleRate, channels int) *silenceSkipper {
+	sampleSize := channels * 2
+	windowSize := int(time.Duration(sampleRate)*silenceWindow/time.Second) * sampleSize
+	s := &silenceSkipper{
+		src:    src,
+		window: make([]byte, windowSize),
+	}
+	s.setParams(DEFAULT_SILENCE_THRESHOLD, DEFAULT_SILENCE_MIN_PAUSE, sampleRate*sampleSize)
+	return s
+}
+
+// setParams sets the threshold of silence in dBFS and the minimum length of the pause that is left in place
+func (s *silenceSkipper) setParams(threshold float64, minPause time.Duration, bytesPerSec int) {
+	s.threshold = int(math.Pow(10, threshold/20) * 32768)
+	s.minPause = int64(time.Duration(bytesPerSec) * minPause / time.Second)
+}
+
+// reset discards the buffered data. Must be called after changing the position of the source
+func (s *silenceSkipper) reset() {
+	s.out = nil
+	s.silence = 0
+	s.consumed = 0
+	s.lastErr = nil
+}
+
+// takeConsumed returns the number of bytes read from the source since the previous call.
+// This is the amount of the media data that has been played, including the removed silence
+func (s *silenceSkipper) takeConsumed() int64 {
+	consumed := s.consumed
+	s.consumed = 0
+	return consumed
+}
+
+func (s *silenceSkipper) isSilent(chunk []byte) bool {
+	for i := 0; i+1 < len(chunk); i += 2 {
+		sample := int(int16(binary.LittleEndian.Uint16(chunk[i:])))
+		if sample > s.threshold || -sample > s.threshold {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *silenceSkipper) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.lastErr != nil {
+			return 0, s.lastErr
+		}
+
+		n, err := io.ReadFull(s.src, s.window)
+		s.consumed += int64(n)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		s.lastErr = err
+
+		chunk := s.window[:n]
+		if s.enabled && s.isSilent(chunk) {
+			s.silence += int64(n)
+			if s.silence > s.minPause {
+				// This part of the pause is too long. Just drop it
+				continue
+			}
+		} else {
+			s.silence = 0
+		}
+		s.out = chunk
+	}
+
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+func (p *Player) SkipSilence() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.skipSilence
+}
+
+// SetSkipSilence enables or disables shortening of the long pauses. The position of the player remains in real media time
+func (p *Player) SetSkipSilence(enabled bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.skipSilence = enabled
+	if p.fragment != nil {
+		p.fragment.setSkipSilence(p.skipSilence, p.silenceThreshold, p.silenceMinPause)
+	}
+}
+
+// SetSilenceParams sets the level of silence in dBFS and the length to which the longer pauses are shortened
+func (p *Player) SetSilenceParams(threshold float64, minPause time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+	if threshold >= 0 {
+		threshold = DEFAULT_SILENCE_THRESHOLD
+	}
+	if minPause <= 0 {
+		minPause = DEFAULT_SILENCE_MIN_PAUSE
+	}
+	p.silenceThreshold = threshold
+	p.silenceMinPause = minPause
+	if p.fragment != nil {
+		p.fragment.setSkipSilence(p.skipSilence, p.silenceThreshold, p.silenceMinPause)
+	}
+}
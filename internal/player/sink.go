@@ -0,0 +1,15 @@
+package player
+
+// AudioSink receives decoded PCM audio data and plays it or stores it somewhere.
+// Write must block while the sink is paused. Stop must discard all buffered data and unblock waiting writes.
+type AudioSink interface {
+	Write(p []byte) (int, error)
+	Pause(pauseState bool)
+	Stop()
+	Sync()
+	Close() error
+	SetOutputDevice(devName string) error
+}
+
+// SinkFactory opens a new audio sink for PCM data with the specified format
+type SinkFactory func(channels, samplesPerSec, bitsPerSample, bufSize int, devName string) (AudioSink, error)
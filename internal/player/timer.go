@@ -0,0 +1,201 @@
+package player
+
+import (
+	"time"
+)
+
+// TimerMode defines the moment at which the pause timer stops playback
+type TimerMode string
+
+const (
+	// Playback is paused after the specified time
+	TimerModeDuration TimerMode = "duration"
+	// Playback is paused at the end of the current chapter
+	TimerModeChapterEnd TimerMode = "chapter_end"
+	// Playback is paused after the specified number of chapters
+	TimerModeChapters TimerMode = "chapters"
+)
+
+const (
+	// Interval at which the running timer checks whether it has expired in the duration mode and updates the fade
+	timerTick = time.Millisecond * 250
+	// Time before the pause during which the volume fades out
+	timerFadeDuration = time.Minute
+)
+
+// Timer is the settings of the pause timer. Fragments without embedded chapters are counted as chapters
+type Timer struct {
+	Mode TimerMode
+	// Time after which playback is paused in the duration mode
+	Duration time.Duration
+	// Number of chapters that are played in the chapters mode
+	Chapters int
+	// The volume gradually fades out before the pause
+	Fade bool
+}
+
+// Enabled reports whether the timer pauses playback
+func (t Timer) Enabled() bool {
+	switch t.Mode {
+	case TimerModeChapterEnd:
+		return true
+	case TimerModeChapters:
+		return t.Chapters > 0
+	}
+	return t.Duration > 0
+}
+
+func (t Timer) byChapters() bool {
+	return t.Mode == TimerModeChapterEnd || t.Mode == TimerModeChapters
+}
+
+// SetTimer sets the pause timer. If playback is in progress, the timer starts immediately
+func (p *Player) SetTimer(t Timer) {
+	p.Lock()
+	defer p.Unlock()
+	old := p.timer
+	p.timer = t
+	p.logger.Debug("Pause timer set to %+v", t)
+	old.Fade = t.Fade
+	if p.timerStop != nil && old == t {
+		// Only the fade has changed, so the running timer continues
+		if !t.Fade {
+			p.setFade(1)
+		}
+		return
+	}
+	p.stopTimer()
+	if p.playing.Load() && p.fragment != nil && !p.fragment.IsPause() {
+		p.startTimer()
+	}
+}
+
+func (p *Player) Timer() Timer {
+	p.Lock()
+	defer p.Unlock()
+	return p.timer
+}
+
+// ExtendTimer postpones the running timer. The time is added in the duration mode, and one more chapter is played in the chapter modes.
+// Returns false if the timer is not running
+func (p *Player) ExtendTimer(d time.Duration) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.timerStop == nil {
+		return false
+	}
+	if p.timer.byChapters() {
+		p.timerChapter++
+	} else {
+		p.timerDeadline = p.timerDeadline.Add(d)
+	}
+	// The fade is recalculated by the timer on the next check
+	p.setFade(1)
+	p.logger.Debug("Pause timer extended")
+	return true
+}
+
+// startTimer starts the timer from the current position. Must be called with the player locked
+func (p *Player) startTimer() {
+	p.stopTimer()
+	if !p.timer.Enabled() {
+		return
+	}
+	p.timerDeadline = time.Now().Add(p.timer.Duration)
+	p.timerChapter = p.chapter() + 1
+	if p.timer.Mode == TimerModeChapters {
+		p.timerChapter = p.chapter() + p.timer.Chapters
+	}
+	stop := make(chan struct{})
+	p.timerStop = stop
+	go p.runTimer(stop)
+	p.logger.Debug("Pause timer started")
+}
+
+// stopTimer stops the running timer and restores the volume. Must be called with the player locked
+func (p *Player) stopTimer() {
+	if p.timerStop == nil {
+		return
+	}
+	close(p.timerStop)
+	p.timerStop = nil
+	p.setFade(1)
+	p.logger.Debug("Pause timer stopped")
+}
+
+func (p *Player) runTimer(stop chan struct{}) {
+	ticker := time.NewTicker(timerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.Lock()
+		if p.timerStop != stop {
+			p.Unlock()
+			return
+		}
+		// Between fragments there is nothing to pause, so the timer waits for the next fragment.
+		// In the chapter modes the boundary of the chapter is checked by the playback loop
+		if p.fragment != nil && !p.timer.byChapters() && p.timerExpired() {
+			p.expireTimer()
+			p.Unlock()
+			return
+		}
+		if p.timer.Fade {
+			p.setFade(float64(p.timerLeft()) / float64(timerFadeDuration))
+		}
+		p.Unlock()
+	}
+}
+
+// timerExpired reports whether the deadline of the running timer has passed in the duration mode. Must be called with the player locked
+func (p *Player) timerExpired() bool {
+	return !time.Now().Before(p.timerDeadline)
+}
+
+// timerChapterReached reports whether the running timer of the chapter modes must pause playback before the position of the fragment is played.
+// Must be called with the player locked
+func (p *Player) timerChapterReached(fragment int, pos time.Duration) bool {
+	return p.timerStop != nil && p.timer.byChapters() && p.chapterAt(fragment, pos) >= p.timerChapter
+}
+
+// expireTimer pauses playback by the timer. Must be called with the player locked
+func (p *Player) expireTimer() {
+	p.pauseFragment(true)
+	p.stopTimer()
+	p.emit(EventTimerExpired, nil)
+	p.logger.Debug("Playback paused by timer")
+}
+
+// timerLeft returns the real time remaining until the running timer expires. Must be called with the player locked
+func (p *Player) timerLeft() time.Duration {
+	if !p.timer.byChapters() {
+		return time.Until(p.timerDeadline)
+	}
+	// The chapters are played to the end of the book, if there are not enough of them
+	end := p.bookDuration()
+	if chapters := p.chapterList(); p.timerChapter < len(chapters) {
+		c := chapters[p.timerChapter]
+		end = p.bookElapsedTime(c.Fragment, c.Position)
+	}
+	left := end - p.bookElapsedTime(p.fragmentIndex, p.position())
+	return time.Duration(float64(left) / p.speed)
+}
+
+// setFade sets the multiplier of the volume from 0 to 1. Must be called with the player locked
+func (p *Player) setFade(fade float64) {
+	switch {
+	case fade < 0:
+		fade = 0
+	case fade > 1:
+		fade = 1
+	}
+	p.fade = fade
+	if p.fragment != nil {
+		p.fragment.setFade(p.fade)
+	}
+}
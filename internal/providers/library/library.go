@@ -5,19 +5,26 @@ import (
 	"fmt"
 
 	"github.com/kvark128/OnlineLibrary/internal/config"
+	"github.com/kvark128/OnlineLibrary/internal/connection"
 	"github.com/kvark128/OnlineLibrary/internal/content"
+	"github.com/kvark128/OnlineLibrary/internal/dodpclient"
 	"github.com/kvark128/dodp"
 )
 
 type Library struct {
-	*dodp.Client
+	*dodpclient.Client
 	service           *config.Service
+	transport         *connection.Transport
 	serviceAttributes *dodp.ServiceAttributes
 	conf              *config.Config
 }
 
 func NewLibrary(conf *config.Config, service *config.Service) (*Library, error) {
-	client := dodp.NewClient(service.URL, config.HTTPTimeout)
+	transport, err := connection.ServiceTransport(service)
+	if err != nil {
+		return nil, fmt.Errorf("transport: %w", err)
+	}
+	client := dodpclient.NewClient(service.URL, transport, transport.Timeout())
 	success, err := client.LogOn(service.Username, service.Password)
 	if err != nil {
 		return nil, err
@@ -44,6 +51,7 @@ func NewLibrary(conf *config.Config, service *config.Service) (*Library, error)
 	library := &Library{
 		Client:            client,
 		service:           service,
+		transport:         transport,
 		serviceAttributes: serviceAttributes,
 		conf:              conf,
 	}
@@ -51,6 +59,11 @@ func NewLibrary(conf *config.Config, service *config.Service) (*Library, error)
 	return library, nil
 }
 
+// Transport returns the transport through which the requests to the service are sent
+func (l *Library) Transport() *connection.Transport {
+	return l.transport
+}
+
 func (l *Library) ContentList(id string) (*content.List, error) {
 	contentList, err := l.GetContentList(id, 0, -1)
 	if err != nil {
@@ -2,12 +2,18 @@ package localstorage
 
 import (
 	"encoding/xml"
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/kvark128/OnlineLibrary/internal/config"
+	"github.com/kvark128/OnlineLibrary/internal/content"
+	"github.com/kvark128/OnlineLibrary/internal/mp4"
 	"github.com/kvark128/OnlineLibrary/internal/player"
+	"github.com/kvark128/OnlineLibrary/internal/util"
 	"github.com/kvark128/dodp"
 )
 
@@ -15,7 +21,11 @@ type ContentItem struct {
 	storage   *LocalStorage
 	resources []dodp.Resource
 	metadata  *dodp.ContentMetadata
+	manifest  *content.Manifest
 	conf      config.Book
+	// The book is a single file in the storage directory instead of a directory
+	file  bool
+	title string
 }
 
 func NewContentItem(storage *LocalStorage, id string) *ContentItem {
@@ -29,7 +39,18 @@ func (ci *ContentItem) path() string {
 	return filepath.Join(ci.storage.path, ci.conf.ID)
 }
 
+// Dir returns the directory containing the resources of the book
+func (ci *ContentItem) Dir() string {
+	if ci.file {
+		return ci.storage.path
+	}
+	return ci.path()
+}
+
 func (ci *ContentItem) Name() (string, error) {
+	if ci.file {
+		return ci.Label(), nil
+	}
 	label := ci.Label()
 	if dir, err := config.BookDir(label); err == nil && dir == ci.path() {
 		return label, nil
@@ -38,6 +59,9 @@ func (ci *ContentItem) Name() (string, error) {
 }
 
 func (ci *ContentItem) Label() string {
+	if ci.file {
+		return ci.fileTitle()
+	}
 	md, err := ci.ContentMetadata()
 	if err != nil {
 		return ci.conf.ID
@@ -45,6 +69,23 @@ func (ci *ContentItem) Label() string {
 	return md.Metadata.Title
 }
 
+// fileTitle returns the title from the tags of the book file or the file name without the extension
+func (ci *ContentItem) fileTitle() string {
+	if ci.title != "" {
+		return ci.title
+	}
+	ci.title = strings.TrimSuffix(ci.conf.ID, filepath.Ext(ci.conf.ID))
+	if f, err := os.Open(ci.path()); err == nil {
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			if title, err := mp4.ReadTitle(f, info.Size()); err == nil && strings.TrimSpace(title) != "" {
+				ci.title = title
+			}
+		}
+	}
+	return ci.title
+}
+
 func (ci *ContentItem) ID() string {
 	return ci.conf.ID
 }
@@ -56,6 +97,32 @@ func (ci *ContentItem) Resources() ([]dodp.Resource, error) {
 	path := ci.path()
 	rsrc := make([]dodp.Resource, 0)
 
+	if ci.file {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		rsrc = append(rsrc, dodp.Resource{LocalURI: ci.conf.ID, Size: info.Size()})
+		ci.resources = rsrc
+		return ci.resources, nil
+	}
+
+	// The book downloaded from the library has the list of its resources in the order of the library.
+	// The URIs of the library expire, so only the fragments present on the disk are played
+	if mf, err := ci.Manifest(); err == nil {
+		for _, r := range mf.Resources {
+			info, err := os.Stat(filepath.Join(path, r.LocalURI))
+			if err != nil || info.IsDir() {
+				continue
+			}
+			r.URI = ""
+			r.Size = info.Size()
+			rsrc = append(rsrc, r)
+		}
+		ci.resources = rsrc
+		return ci.resources, nil
+	}
+
 	walker := func(targpath string, info fs.FileInfo, err error) error {
 		if err != nil || info.IsDir() {
 			return err
@@ -75,6 +142,10 @@ func (ci *ContentItem) Resources() ([]dodp.Resource, error) {
 	if err := filepath.Walk(path, walker); err != nil {
 		return nil, err
 	}
+	// Names of the files in hand-made folders are usually numbered without leading zeros
+	sort.SliceStable(rsrc, func(i, j int) bool {
+		return util.NaturalLess(rsrc[i].LocalURI, rsrc[j].LocalURI)
+	})
 	ci.resources = rsrc
 	return ci.resources, nil
 }
@@ -83,6 +154,9 @@ func (ci *ContentItem) ContentMetadata() (*dodp.ContentMetadata, error) {
 	if ci.metadata != nil {
 		return ci.metadata, nil
 	}
+	if ci.file {
+		return nil, errors.New("the book file has no metadata")
+	}
 	path := filepath.Join(ci.path(), config.MetadataFileName)
 	f, err := os.Open(path)
 	if err != nil {
@@ -98,6 +172,22 @@ func (ci *ContentItem) ContentMetadata() (*dodp.ContentMetadata, error) {
 	return ci.metadata, nil
 }
 
+// Manifest returns the manifest saved with the book when it was downloaded from the library
+func (ci *ContentItem) Manifest() (*content.Manifest, error) {
+	if ci.manifest != nil {
+		return ci.manifest, nil
+	}
+	if ci.file {
+		return nil, errors.New("the book file has no manifest")
+	}
+	mf, err := content.ReadManifest(ci.path())
+	if err != nil {
+		return nil, err
+	}
+	ci.manifest = mf
+	return ci.manifest, nil
+}
+
 func (ci *ContentItem) Config() *config.Book {
 	return &ci.conf
 }
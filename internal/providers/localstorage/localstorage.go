@@ -6,6 +6,7 @@ import (
 
 	"github.com/kvark128/OnlineLibrary/internal/config"
 	"github.com/kvark128/OnlineLibrary/internal/content"
+	"github.com/kvark128/OnlineLibrary/internal/decoder"
 	"github.com/kvark128/dodp"
 	"github.com/leonelquinteros/gotext"
 )
@@ -34,9 +35,20 @@ func (s *LocalStorage) ContentList(string) (*content.List, error) {
 	}
 
 	for _, e := range entrys {
+		if e.Name() == config.CacheDirName || e.Name() == config.WaveOutputDirName {
+			// Partially streamed fragments and the audio stored by the wavefile sink are not books
+			continue
+		}
 		if e.IsDir() {
 			item := NewContentItem(s, e.Name())
 			lst.Items = append(lst.Items, item)
+			continue
+		}
+		// Some formats keep the whole book with its chapters in a single file
+		if format, err := decoder.Lookup(e.Name(), ""); err == nil && format.Book {
+			item := NewContentItem(s, e.Name())
+			item.file = true
+			lst.Items = append(lst.Items, item)
 		}
 	}
 
@@ -0,0 +1,29 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/kvark128/OnlineLibrary/internal/player"
+)
+
+// NullFactory opens a null sink for any format. It is used to play books without an audio device
+func NullFactory(channels, samplesPerSec, bitsPerSample, bufSize int, devName string) (player.AudioSink, error) {
+	return NewNull(), nil
+}
+
+// WaveFileFactory returns a factory that stores the audio of every opened sink in a new WAV file in the directory.
+// The sink is reused by consecutive fragments of the same format, so a file holds the audio of one sink rather than of one fragment.
+// The files are numbered in the order the sinks are opened
+func WaveFileFactory(dir string) player.SinkFactory {
+	var n atomic.Int64
+	return func(channels, samplesPerSec, bitsPerSample, bufSize int, devName string) (player.AudioSink, error) {
+		if err := os.MkdirAll(dir, os.ModeDir); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%04d.wav", n.Add(1)))
+		return NewWaveFile(path, channels, samplesPerSec, bitsPerSample)
+	}
+}
@@ -0,0 +1,42 @@
+package sink
+
+import "sync"
+
+// gate blocks writers while the sink is paused, just like the real audio device does
+type gate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	stops  int
+}
+
+func newGate() *gate {
+	g := new(gate)
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// wait blocks until the gate is opened. Returns false if the sink was stopped while waiting
+func (g *gate) wait() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stops := g.stops
+	for g.paused && g.stops == stops {
+		g.cond.Wait()
+	}
+	return g.stops == stops
+}
+
+func (g *gate) pause(pauseState bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.paused = pauseState
+	g.cond.Broadcast()
+}
+
+func (g *gate) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stops++
+	g.cond.Broadcast()
+}
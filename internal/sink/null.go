@@ -0,0 +1,34 @@
+package sink
+
+// Null is an audio sink that discards all data written to it
+type Null struct {
+	gate *gate
+}
+
+func NewNull() *Null {
+	return &Null{gate: newGate()}
+}
+
+func (n *Null) Write(p []byte) (int, error) {
+	n.gate.wait()
+	return len(p), nil
+}
+
+func (n *Null) Pause(pauseState bool) {
+	n.gate.pause(pauseState)
+}
+
+func (n *Null) Stop() {
+	n.gate.stop()
+}
+
+func (n *Null) Sync() {}
+
+func (n *Null) Close() error {
+	n.gate.stop()
+	return nil
+}
+
+func (n *Null) SetOutputDevice(devName string) error {
+	return nil
+}
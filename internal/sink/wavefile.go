@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+)
+
+const waveHeaderSize = 44
+
+// WaveFile is an audio sink that stores all data written to it in a WAV file
+type WaveFile struct {
+	mu            sync.Mutex
+	gate          *gate
+	f             *os.File
+	channels      int
+	samplesPerSec int
+	bitsPerSample int
+	dataSize      int64
+}
+
+func NewWaveFile(path string, channels, samplesPerSec, bitsPerSample int) (*WaveFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wf := &WaveFile{
+		gate:          newGate(),
+		f:             f,
+		channels:      channels,
+		samplesPerSec: samplesPerSec,
+		bitsPerSample: bitsPerSample,
+	}
+
+	// The header will be rewritten with the correct sizes when the file is closed
+	if err := wf.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return wf, nil
+}
+
+func (wf *WaveFile) writeHeader() error {
+	blockAlign := wf.channels * wf.bitsPerSample / 8
+	header := make([]byte, waveHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(waveHeaderSize-8+wf.dataSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(wf.channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(wf.samplesPerSec))
+	binary.LittleEndian.PutUint32(header[28:], uint32(wf.samplesPerSec*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], uint16(wf.bitsPerSample))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(wf.dataSize))
+	_, err := wf.f.WriteAt(header, 0)
+	return err
+}
+
+func (wf *WaveFile) Write(p []byte) (int, error) {
+	if !wf.gate.wait() {
+		// Stop was called while waiting. The data must be discarded
+		return len(p), nil
+	}
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	if wf.f == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := wf.f.WriteAt(p, waveHeaderSize+wf.dataSize)
+	wf.dataSize += int64(n)
+	return n, err
+}
+
+func (wf *WaveFile) Pause(pauseState bool) {
+	wf.gate.pause(pauseState)
+}
+
+func (wf *WaveFile) Stop() {
+	wf.gate.stop()
+}
+
+func (wf *WaveFile) Sync() {}
+
+func (wf *WaveFile) Close() error {
+	wf.gate.stop()
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	if wf.f == nil {
+		return os.ErrClosed
+	}
+	err := wf.writeHeader()
+	if e := wf.f.Close(); err == nil {
+		err = e
+	}
+	wf.f = nil
+	return err
+}
+
+func (wf *WaveFile) SetOutputDevice(devName string) error {
+	return nil
+}
+
+// DataSize returns the number of bytes of PCM data written to the file
+func (wf *WaveFile) DataSize() int64 {
+	wf.mu.Lock()
+	defer wf.mu.Unlock()
+	return wf.dataSize
+}
@@ -0,0 +1,237 @@
+// Package stats keeps the history of listening to books
+package stats
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kvark128/OnlineLibrary/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// A session that begins shortly after the previous one of the same book continues it.
+// So seeking to another fragment or a short pause does not split the session
+const sessionGap = time.Second * 10
+
+// Session is a continuous listening to a book
+type Session struct {
+	Book  string    `yaml:"book"`
+	Start time.Time `yaml:"start"`
+	// End of the last playback in the session. Zero in the history saved by the previous versions
+	End time.Time `yaml:"end,omitempty"`
+	// Real time of listening. Pauses within the session are not counted
+	Duration time.Duration `yaml:"duration"`
+	// Playback speed at the end of the session
+	Speed float64 `yaml:"speed"`
+	// Position in the book at the end of the session in percent. Zero if the duration of the book is unknown
+	Percent float64 `yaml:"percent,omitempty"`
+}
+
+func (s Session) end() time.Time {
+	if s.End.IsZero() {
+		return s.Start.Add(s.Duration)
+	}
+	return s.End
+}
+
+// Statistics is the listening history. It is safe for concurrent use
+type Statistics struct {
+	mu sync.Mutex
+	// Titles of the books by their ID
+	Titles   map[string]string `yaml:"titles,omitempty"`
+	Sessions []Session         `yaml:"sessions,omitempty"`
+	// Index of the session in progress, or -1
+	current int
+	// Moment up to which the session in progress has been counted
+	counted time.Time
+}
+
+func New() *Statistics {
+	return &Statistics{Titles: make(map[string]string), current: -1}
+}
+
+func (st *Statistics) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := yaml.NewDecoder(f).Decode(st); err != nil {
+		return err
+	}
+	if st.Titles == nil {
+		st.Titles = make(map[string]string)
+	}
+	return nil
+}
+
+// Save writes the history to the file. The session in progress is saved up to the current moment
+func (st *Statistics) Save(path string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.update(time.Now())
+	f, err := util.CreateSecureFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yaml.NewEncoder(f).Encode(st); err != nil {
+		f.Corrupted()
+		return err
+	}
+	return nil
+}
+
+// Start begins a listening session of the book
+func (st *Statistics) Start(bookID, title string, speed, percent float64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now()
+	st.stop(now, speed, percent)
+	st.Titles[bookID] = title
+	if n := len(st.Sessions); n > 0 {
+		last := st.Sessions[n-1]
+		if last.Book == bookID && now.Sub(last.end()) < sessionGap {
+			st.current = n - 1
+			st.counted = now
+			return
+		}
+	}
+	st.Sessions = append(st.Sessions, Session{Book: bookID, Start: now, End: now, Speed: speed, Percent: percent})
+	st.current = len(st.Sessions) - 1
+	st.counted = now
+}
+
+// Stop ends the session in progress
+func (st *Statistics) Stop(speed, percent float64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.stop(time.Now(), speed, percent)
+}
+
+func (st *Statistics) stop(now time.Time, speed, percent float64) {
+	if st.current < 0 {
+		return
+	}
+	st.update(now)
+	s := &st.Sessions[st.current]
+	s.Speed = speed
+	if percent > 0 {
+		s.Percent = percent
+	}
+	st.current = -1
+}
+
+// update adds the time played since the last update to the session in progress
+func (st *Statistics) update(now time.Time) {
+	if st.current >= 0 {
+		s := &st.Sessions[st.current]
+		s.Duration += now.Sub(st.counted)
+		s.End = now
+		st.counted = now
+	}
+}
+
+// BookSummary is the listening history of one book
+type BookSummary struct {
+	ID, Title string
+	Listened  time.Duration
+	Sessions  int
+	// Average speed weighted by the listening time
+	Speed float64
+	// Position at the end of the last session in percent
+	Percent float64
+	Last    time.Time
+}
+
+// Books returns the summaries of the books, the most recently listened first
+func (st *Statistics) Books() []BookSummary {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.update(time.Now())
+	index := make(map[string]int)
+	var books []BookSummary
+	for _, s := range st.Sessions {
+		i, ok := index[s.Book]
+		if !ok {
+			i = len(books)
+			index[s.Book] = i
+			books = append(books, BookSummary{ID: s.Book, Title: st.Titles[s.Book]})
+		}
+		b := &books[i]
+		if total := b.Listened + s.Duration; total > 0 {
+			b.Speed = (b.Speed*b.Listened.Seconds() + s.Speed*s.Duration.Seconds()) / total.Seconds()
+		}
+		b.Listened += s.Duration
+		b.Sessions++
+		if s.Percent > 0 {
+			b.Percent = s.Percent
+		}
+		if s.end().After(b.Last) {
+			b.Last = s.end()
+		}
+	}
+	sort.SliceStable(books, func(i, j int) bool { return books[i].Last.After(books[j].Last) })
+	return books
+}
+
+// DaySummary is the listening history of one day
+type DaySummary struct {
+	Date     time.Time
+	Listened time.Duration
+	Sessions int
+}
+
+// Days returns the summaries of the days on which there was listening, the latest first.
+// A session is counted on the day it began
+func (st *Statistics) Days() []DaySummary {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.update(time.Now())
+	index := make(map[time.Time]int)
+	var days []DaySummary
+	for _, s := range st.Sessions {
+		local := s.Start.Local()
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		i, ok := index[date]
+		if !ok {
+			i = len(days)
+			index[date] = i
+			days = append(days, DaySummary{Date: date})
+		}
+		days[i].Listened += s.Duration
+		days[i].Sessions++
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date.After(days[j].Date) })
+	return days
+}
+
+// WriteCSV writes all sessions in the CSV format
+func (st *Statistics) WriteCSV(w io.Writer) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.update(time.Now())
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "start", "book_id", "title", "minutes", "speed", "percent"})
+	for _, s := range st.Sessions {
+		local := s.Start.Local()
+		cw.Write([]string{
+			local.Format("2006-01-02"),
+			local.Format("15:04:05"),
+			s.Book,
+			st.Titles[s.Book],
+			strconv.FormatFloat(s.Duration.Minutes(), 'f', 1, 64),
+			strconv.FormatFloat(s.Speed, 'f', 2, 64),
+			strconv.FormatFloat(s.Percent, 'f', 0, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,185 @@
+package buffer
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	ReaderWasClosed = errors.New("reader was closed")
+)
+
+const (
+	readahead_chunk_size = 1024 * 32
+	// The buffer keeps a quarter of its size of the data already read, so seeking back within it does not touch the source.
+	// The buffer is compacted when another quarter has been read, to avoid moving its data on every chunk
+	readahead_parts = 4
+)
+
+// ReadAhead reads the source into a large buffer in the background, so short stalls of the source are not noticed by the reader.
+// Seeking within the buffer is done without accessing the source
+type ReadAhead struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// Serializes access to the source between the background reading and seeking outside the buffer
+	srcMu  sync.Mutex
+	source io.ReadSeekCloser
+	buf    []byte
+	// Offset of the first byte of the buffer in the source, and the number of bytes in the buffer
+	start int64
+	n     int
+	pos   int64
+	// Error of the last reading from the source. Reported to the reader after the buffered data
+	err    error
+	closed bool
+}
+
+// NewReadAhead starts reading the source into a buffer of the specified size in bytes
+func NewReadAhead(src io.ReadSeekCloser, size int) *ReadAhead {
+	if size < readahead_chunk_size*readahead_parts {
+		size = readahead_chunk_size * readahead_parts
+	}
+	r := &ReadAhead{source: src, buf: make([]byte, size)}
+	r.cond = sync.NewCond(&r.mu)
+	go r.fill()
+	return r
+}
+
+// fill reads the source while there is room in the buffer
+func (r *ReadAhead) fill() {
+	chunk := make([]byte, readahead_chunk_size)
+	for {
+		r.mu.Lock()
+		for !r.closed && (r.err != nil || !r.makeRoom()) {
+			r.cond.Wait()
+		}
+		r.mu.Unlock()
+
+		r.srcMu.Lock()
+		r.mu.Lock()
+		// The buffer could be reset by seeking while the source was being locked
+		if r.closed || r.err != nil || !r.makeRoom() {
+			closed := r.closed
+			r.mu.Unlock()
+			r.srcMu.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+		free := len(r.buf) - r.n
+		r.mu.Unlock()
+
+		if free > len(chunk) {
+			free = len(chunk)
+		}
+		n, err := r.source.Read(chunk[:free])
+
+		r.mu.Lock()
+		r.n += copy(r.buf[r.n:], chunk[:n])
+		if err != nil {
+			r.err = err
+		}
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		r.srcMu.Unlock()
+	}
+}
+
+// makeRoom reports whether there is free space in the buffer, discarding the data that is too far behind the position. Must be called with the mutex locked
+func (r *ReadAhead) makeRoom() bool {
+	if r.n < len(r.buf) {
+		return true
+	}
+	keep := len(r.buf) / readahead_parts
+	drop := int(r.pos-r.start) - keep
+	if drop < keep {
+		return false
+	}
+	r.n = copy(r.buf, r.buf[drop:r.n])
+	r.start += int64(drop)
+	return true
+}
+
+func (r *ReadAhead) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for !r.closed && r.err == nil && r.pos >= r.start+int64(r.n) {
+		r.cond.Wait()
+	}
+	if r.closed {
+		return 0, ReaderWasClosed
+	}
+	if r.pos >= r.start+int64(r.n) {
+		return 0, r.err
+	}
+	n := copy(p, r.buf[r.pos-r.start:r.n])
+	r.pos += int64(n)
+	r.cond.Broadcast()
+	return n, nil
+}
+
+func (r *ReadAhead) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, ReaderWasClosed
+	}
+	pos := offset
+	if whence == io.SeekCurrent {
+		pos += r.pos
+	}
+	if whence != io.SeekEnd && pos >= r.start && pos <= r.start+int64(r.n) {
+		// The position is within the buffer
+		r.pos = pos
+		r.cond.Broadcast()
+		r.mu.Unlock()
+		return pos, nil
+	}
+	r.mu.Unlock()
+
+	// Seeking outside the buffer resets it
+	r.srcMu.Lock()
+	defer r.srcMu.Unlock()
+	if whence == io.SeekCurrent {
+		offset, whence = pos, io.SeekStart
+	}
+	pos, err := r.source.Seek(offset, whence)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start, r.n, r.pos = pos, 0, pos
+	r.err = err
+	r.cond.Broadcast()
+	return pos, err
+}
+
+// Level returns the fill level of the buffer ahead of the position in percent.
+// If the source has been read to the end, the level is 100
+func (r *ReadAhead) Level() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == io.EOF {
+		return 100
+	}
+	ahead := r.start + int64(r.n) - r.pos
+	return int(ahead * 100 / int64(len(r.buf)))
+}
+
+// Close stops reading and closes the source. The source is closed in the background, since it may be blocked in reading
+func (r *ReadAhead) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ReaderWasClosed
+	}
+	r.closed = true
+	r.cond.Broadcast()
+	go func() {
+		r.srcMu.Lock()
+		defer r.srcMu.Unlock()
+		r.source.Close()
+	}()
+	return nil
+}
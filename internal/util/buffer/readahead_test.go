@@ -0,0 +1,76 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// seekCounter counts the seeks of the source
+type seekCounter struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+	return s.Reader.Seek(offset, whence)
+}
+
+func (s *seekCounter) Close() error {
+	return nil
+}
+
+func TestReadAheadSeek(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	src := &seekCounter{Reader: bytes.NewReader(data)}
+	r := NewReadAhead(src, 0)
+	defer r.Close()
+
+	// The steps are done in order. Before seeking, the specified number of bytes is read from the current position
+	steps := []struct {
+		name       string
+		read       int
+		offset     int64
+		whence     int
+		wantPos    int64
+		wantSource bool
+	}{
+		{"back within the buffer", 1000, 10, io.SeekStart, 10, false},
+		{"forward within the buffer", 0, 400, io.SeekCurrent, 510, false},
+		{"forward outside the buffer", 0, 900000, io.SeekStart, 900000, true},
+		{"back outside the buffer", 0, 0, io.SeekStart, 0, true},
+		{"relative outside the buffer", 200, 500000, io.SeekCurrent, 500300, true},
+		{"from the end", 0, -100, io.SeekEnd, int64(len(data)) - 100, true},
+	}
+	buf := make([]byte, 100)
+	for _, step := range steps {
+		if _, err := io.ReadFull(r, make([]byte, step.read)); err != nil {
+			t.Fatalf("%v: reading before seek: %v", step.name, err)
+		}
+		seeks := src.seeks
+		pos, err := r.Seek(step.offset, step.whence)
+		if err != nil {
+			t.Fatalf("%v: %v", step.name, err)
+		}
+		if pos != step.wantPos {
+			t.Errorf("%v: position %d, want %d", step.name, pos, step.wantPos)
+		}
+		if got := src.seeks > seeks; got != step.wantSource {
+			t.Errorf("%v: source seeked %v, want %v", step.name, got, step.wantSource)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("%v: reading after seek: %v", step.name, err)
+		}
+		if !bytes.Equal(buf, data[step.wantPos:step.wantPos+int64(len(buf))]) {
+			t.Errorf("%v: wrong data after seek", step.name)
+		}
+	}
+
+	if n, err := r.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("reading at the end returned %d, %v, want 0, EOF", n, err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Replaces all forbidden characters in s string with sign "_"
@@ -55,6 +57,41 @@ func FileIsExist(path string, size int64) bool {
 	return false
 }
 
+// NaturalLess reports whether a goes before b in the natural order: the numbers inside the strings are compared by value,
+// so "2.mp3" goes before "10.mp3". Letters are compared case-insensitively
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		if la, lb := unicode.ToLower(ra), unicode.ToLower(rb); la != lb {
+			return la < lb
+		}
+		a, b = a[sizeA:], b[sizeB:]
+	}
+	return len(a) < len(b)
+}
+
+// digitPrefix returns the decimal digits at the beginning of s
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
 func SaveXMLFile(path string, v any) error {
 	f, err := CreateSecureFile(path)
 	if err != nil {
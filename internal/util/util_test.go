@@ -0,0 +1,49 @@
+package util
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"", "", false},
+		{"", "a", true},
+		{"a", "", false},
+		{"2.mp3", "10.mp3", true},
+		{"10.mp3", "2.mp3", false},
+		{"track9", "track10", true},
+		{"track10", "track9", false},
+		{"007.mp3", "10.mp3", true},
+		{"01.mp3", "1.mp3", false},
+		{"1.mp3", "01.mp3", false},
+		{"part1_2", "part1_10", true},
+		{"part2_1", "part10_1", true},
+		{"Chapter", "chapter 1", true},
+		{"Глава 2", "глава 10", true},
+		{"a", "b", true},
+		{"b", "a", false},
+		{"abc", "abd", true},
+		{"abc", "ab", false},
+		{"99999999999999999999", "100000000000000000000", true},
+	}
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNaturalSort(t *testing.T) {
+	names := []string{"10.mp3", "1.mp3", "sample.mp3", "2.mp3", "Intro.mp3", "100.mp3", "02a.mp3"}
+	want := []string{"1.mp3", "2.mp3", "02a.mp3", "10.mp3", "100.mp3", "Intro.mp3", "sample.mp3"}
+	sort.Slice(names, func(i, j int) bool { return NaturalLess(names[i], names[j]) })
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("sorted %q, want %q", names, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package vorbis decodes Vorbis packets by libvorbis
+package vorbis
+
+//#cgo LDFLAGS: -lvorbis -logg
+//#include <stdlib.h>
+//#include <vorbis/codec.h>
+//
+//typedef struct {
+//	vorbis_info info;
+//	vorbis_comment comment;
+//	vorbis_dsp_state dsp;
+//	vorbis_block block;
+//	int dsp_ready;
+//	ogg_int64_t packetno;
+//} decoder;
+//
+//static ogg_packet make_packet(decoder *d, unsigned char *data, long size) {
+//	ogg_packet op = {0};
+//	op.packet = data;
+//	op.bytes = size;
+//	op.b_o_s = d->packetno == 0;
+//	op.granulepos = -1;
+//	op.packetno = d->packetno++;
+//	return op;
+//}
+//
+//static decoder *create(void) {
+//	decoder *d = calloc(1, sizeof(decoder));
+//	if (d != NULL) {
+//		vorbis_info_init(&d->info);
+//		vorbis_comment_init(&d->comment);
+//	}
+//	return d;
+//}
+//
+//static int header(decoder *d, unsigned char *data, long size) {
+//	ogg_packet op = make_packet(d, data, size);
+//	return vorbis_synthesis_headerin(&d->info, &d->comment, &op);
+//}
+//
+//static int start(decoder *d) {
+//	int result = vorbis_synthesis_init(&d->dsp, &d->info);
+//	if (result == 0) {
+//		vorbis_block_init(&d->dsp, &d->block);
+//		d->dsp_ready = 1;
+//	}
+//	return result;
+//}
+//
+//// Decodes the packet and converts the samples to interleaved 16-bit ones. Returns the number of samples per channel or a negative error code
+//static int decode(decoder *d, unsigned char *data, long size, short *out, int max_samples) {
+//	ogg_packet op = make_packet(d, data, size);
+//	int result = vorbis_synthesis(&d->block, &op);
+//	if (result != 0) {
+//		return result;
+//	}
+//	vorbis_synthesis_blockin(&d->dsp, &d->block);
+//	int channels = d->info.channels;
+//	int total = 0;
+//	float **pcm;
+//	int samples;
+//	while (total < max_samples && (samples = vorbis_synthesis_pcmout(&d->dsp, &pcm)) > 0) {
+//		if (samples > max_samples - total) {
+//			samples = max_samples - total;
+//		}
+//		for (int i = 0; i < samples; i++) {
+//			for (int c = 0; c < channels; c++) {
+//				float v = pcm[c][i] * 32768.0f;
+//				if (v > 32767.0f) v = 32767.0f;
+//				if (v < -32768.0f) v = -32768.0f;
+//				out[(total + i) * channels + c] = (short)v;
+//			}
+//		}
+//		vorbis_synthesis_read(&d->dsp, samples);
+//		total += samples;
+//	}
+//	return total;
+//}
+//
+//static void destroy(decoder *d) {
+//	if (d->dsp_ready) {
+//		vorbis_block_clear(&d->block);
+//		vorbis_dsp_clear(&d->dsp);
+//	}
+//	vorbis_comment_clear(&d->comment);
+//	vorbis_info_clear(&d->info);
+//	free(d);
+//}
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+type Decoder struct {
+	dec *C.decoder
+	pcm []byte
+}
+
+// NewDecoder creates a decoder from the identification, comment and setup headers of the stream
+func NewDecoder(headers ...[]byte) (*Decoder, error) {
+	if len(headers) != 3 {
+		return nil, errors.New("vorbis stream requires three headers")
+	}
+	dec := C.create()
+	if dec == nil {
+		return nil, errors.New("creating vorbis decoder: out of memory")
+	}
+	d := &Decoder{dec: dec}
+	runtime.SetFinalizer(d, func(d *Decoder) { C.destroy(d.dec) })
+
+	for i, h := range headers {
+		if len(h) == 0 {
+			return nil, fmt.Errorf("vorbis header %d is empty", i+1)
+		}
+		if result := C.header(d.dec, (*C.uchar)(unsafe.Pointer(&h[0])), C.long(len(h))); result != 0 {
+			return nil, fmt.Errorf("vorbis header %d: error %d", i+1, int(result))
+		}
+	}
+	if result := C.start(d.dec); result != 0 {
+		return nil, fmt.Errorf("starting vorbis decoder: error %d", int(result))
+	}
+	d.pcm = make([]byte, d.MaxBlockSize()*d.Channels()*C.sizeof_short)
+	return d, nil
+}
+
+func (d *Decoder) SampleRate() int {
+	return int(d.dec.info.rate)
+}
+
+func (d *Decoder) Channels() int {
+	return int(d.dec.info.channels)
+}
+
+// MaxBlockSize returns the size of the long block. Each packet produces no more samples
+func (d *Decoder) MaxBlockSize() int {
+	return int(C.vorbis_info_blocksize(&d.dec.info, 1))
+}
+
+// Decode decodes the packet and returns 16-bit PCM data. The data is valid until the next call.
+// The first packet after the beginning or the reset produces no data, because each block overlaps the previous one
+func (d *Decoder) Decode(packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, nil
+	}
+	maxSamples := len(d.pcm) / (d.Channels() * C.sizeof_short)
+	samples := C.decode(d.dec,
+		(*C.uchar)(unsafe.Pointer(&packet[0])), C.long(len(packet)),
+		(*C.short)(unsafe.Pointer(&d.pcm[0])), C.int(maxSamples),
+	)
+	if samples < 0 {
+		return nil, fmt.Errorf("decoding vorbis packet: error %d", int(samples))
+	}
+	return d.pcm[:int(samples)*d.Channels()*C.sizeof_short], nil
+}
+
+// Reset discards the state of the decoder before decoding from another position of the stream
+func (d *Decoder) Reset() {
+	C.vorbis_synthesis_restart(&d.dec.dsp)
+}